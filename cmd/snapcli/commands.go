@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg" // 注册 JPEG 解码器
+	_ "image/png"  // 注册 PNG 解码器
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"snapcli/internal/storage"
+	"snapcli/internal/vision"
+)
+
+// command 子命令（snapcli <命令> [参数...]）
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands 所有子命令
+var commands = map[string]command{
+	"info":    {"snapcli info <图片>...  显示图片尺寸和各模型的 token 估算", cmdInfo},
+	"meta":    {"snapcli meta <图片>...  显示 PNG 中保存的截图元数据", cmdMeta},
+	"list":    {"snapcli list [-n 数量]  列出最近的截图", cmdList},
+	"search":  {"snapcli search [--tag 标签]... [--since 2d|日期] [--until 日期] [--window 文字] [-n 数量] [关键词]  搜索截图", cmdSearch},
+	"tag":     {"snapcli tag [--note 备注] <文件> [标签|+标签|-标签]...  添加或移除标签、设置备注", cmdTag},
+	"index":   {"snapcli index  扫描保存目录，补全索引并移除已删除的文件", cmdIndex},
+	"dedupe":  {"snapcli dedupe [--dry-run] [--distance 0-64] [--delete] [--all]  合并重复的截图（保留最早的一张）", cmdDedupe},
+	"gallery": {"snapcli gallery [-o 文件] [--day 日期|today] [--since 7d] [--tag 标签]... [--embed]  生成按天分组的 HTML 图库", cmdGallery},
+	"clean":   {"snapcli clean [--dry-run] [--days 天数] [--count 数量] [--size MB]  按保留策略清理旧截图", cmdClean},
+}
+
+// runCommand 执行子命令，返回是否为子命令
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+	if err := cmd.run(args[1:]); err != nil {
+		fmt.Println("错误:", err)
+		fmt.Println("用法:", cmd.usage)
+		os.Exit(1)
+	}
+	return true
+}
+
+// cmdInfo 显示图片尺寸、文件大小和各模型的 token 估算，
+// 配置了尺寸限制时同时显示缩小后的估算
+func cmdInfo(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少图片路径")
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println("加载配置失败:", err)
+	}
+
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		ic, format, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(path)
+		fmt.Printf("  尺寸: %dx%d (%.2f MP)  格式: %s  大小: %s\n",
+			ic.Width, ic.Height, float64(ic.Width*ic.Height)/1e6, format, formatBytes(st.Size()))
+		printEstimates(ic.Width, ic.Height)
+
+		w, h := storage.FitSize(ic.Width, ic.Height, cfg.Storage.MaxEdge, cfg.Storage.MaxMegapixels)
+		if w != ic.Width || h != ic.Height {
+			fmt.Printf("  按存储配置缩小后: %dx%d (%.2f MP)\n", w, h, float64(w*h)/1e6)
+			printEstimates(w, h)
+		}
+	}
+	return nil
+}
+
+// cmdMeta 显示 PNG 文本块中的元数据（JSON 内容格式化后显示）
+func cmdMeta(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少图片路径")
+	}
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		meta, err := storage.ReadMetadata(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		fmt.Println(path)
+		if len(meta) == 0 {
+			fmt.Println("  （无元数据）")
+			continue
+		}
+		keys := make([]string, 0, len(meta))
+		for k := range meta {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := meta[k]
+			var buf bytes.Buffer
+			if strings.HasPrefix(v, "[") || strings.HasPrefix(v, "{") {
+				if json.Indent(&buf, []byte(v), "    ", "  ") == nil {
+					v = buf.String()
+				}
+			}
+			fmt.Printf("  %s: %s\n", k, v)
+		}
+	}
+	return nil
+}
+
+// cmdList 列出最近的截图（最新的在最后）
+func cmdList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "显示数量（0 显示全部）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cat, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	entries, err := cat.Entries()
+	if err != nil {
+		return err
+	}
+	printEntries(cat, entries, *limit)
+	return nil
+}
+
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, splitTags(v)...); return nil }
+
+// cmdSearch 按标签、时间范围、窗口标题和关键词（匹配路径、窗口标题、标签和备注）搜索截图
+func cmdSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	var tags stringList
+	fs.Var(&tags, "tag", "标签（可重复，需全部匹配）")
+	since := fs.String("since", "", "起始时间：2d、12h、1w 或 2006-01-02")
+	until := fs.String("until", "", "截止时间：格式同 --since")
+	window := fs.String("window", "", "窗口标题包含的文字")
+	limit := fs.Int("n", 0, "显示数量（0 显示全部）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var from, to time.Time
+	var err error
+	if *since != "" {
+		if from, err = parseTimeArg(*since, now); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if to, err = parseTimeArg(*until, now); err != nil {
+			return err
+		}
+	}
+	keyword := strings.ToLower(strings.Join(fs.Args(), " "))
+
+	cat, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	entries, err := cat.Entries()
+	if err != nil {
+		return err
+	}
+	var matched []storage.Entry
+	for _, e := range entries {
+		if !from.IsZero() && e.Time.Before(from) || !to.IsZero() && !e.Time.Before(to) {
+			continue
+		}
+		if *window != "" && !strings.Contains(strings.ToLower(e.Window), strings.ToLower(*window)) {
+			continue
+		}
+		if !hasTags(&e, tags) {
+			continue
+		}
+		if keyword != "" {
+			text := strings.ToLower(strings.Join(append([]string{e.Path, e.Window, e.Note}, e.Tags...), "\n"))
+			if !strings.Contains(text, keyword) {
+				continue
+			}
+		}
+		matched = append(matched, e)
+	}
+	if len(matched) == 0 {
+		fmt.Println("没有匹配的截图")
+		return nil
+	}
+	printEntries(cat, matched, *limit)
+	return nil
+}
+
+// cmdTag 添加或移除截图的标签（-标签 表示移除），设置备注
+func cmdTag(args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	note := fs.String("note", "", "备注")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("缺少文件路径")
+	}
+	path := fs.Arg(0)
+	noteSet := false
+	fs.Visit(func(f *flag.Flag) { noteSet = noteSet || f.Name == "note" })
+	if fs.NArg() == 1 && !noteSet {
+		return errors.New("缺少标签")
+	}
+
+	cat, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	rel, ok := cat.Rel(path)
+	if !ok {
+		// 也可以是相对保存目录的路径
+		if rel, ok = cat.Rel(cat.Abs(path)); !ok {
+			return fmt.Errorf("%s 不在保存目录 %s 下", path, cat.Dir())
+		}
+	}
+	if _, err := os.Stat(cat.Abs(rel)); err != nil {
+		return err
+	}
+
+	// 不在索引中的文件先加入索引
+	entries, err := cat.Entries()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, e := range entries {
+		found = found || e.Path == rel
+	}
+	if !found {
+		e, err := storage.ScanFile(cat.Abs(rel))
+		if err != nil {
+			return err
+		}
+		e.Path = rel
+		if err := cat.Add(e); err != nil {
+			return err
+		}
+	}
+
+	var result storage.Entry
+	err = cat.Update(rel, func(e *storage.Entry) {
+		for _, arg := range fs.Args()[1:] {
+			remove := strings.HasPrefix(arg, "-")
+			for _, t := range splitTags(strings.TrimLeft(arg, "+-")) {
+				if remove {
+					e.Tags = removeTag(e.Tags, t)
+				} else if !e.HasTag(t) {
+					e.Tags = append(e.Tags, t)
+				}
+			}
+		}
+		if noteSet {
+			e.Note = *note
+		}
+		result = *e
+	})
+	if err != nil {
+		return err
+	}
+	printEntries(cat, []storage.Entry{result}, 0)
+	return nil
+}
+
+// cmdIndex 扫描保存目录，将未建立索引的图片加入索引（如升级前保存的截图），并移除已删除的文件
+func cmdIndex(args []string) error {
+	cat, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	added, removed, err := cat.Sync()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("索引已更新: 新增 %d，移除 %d（%s）\n", added, removed, cat.Dir())
+	return nil
+}
+
+// cmdClean 按保留策略清理截图（参数覆盖配置中的限制），--dry-run 时只列出将被清理的截图
+func cmdClean(args []string) error {
+	c, _ := loadConfig()
+	r := c.Retention
+	fs := flag.NewFlagSet("clean", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "只列出将被清理的截图")
+	fs.IntVar(&r.MaxAgeDays, "days", r.MaxAgeDays, "保留天数")
+	fs.IntVar(&r.MaxCount, "count", r.MaxCount, "最多保留的截图数")
+	fs.IntVar(&r.MaxSizeMB, "size", r.MaxSizeMB, "截图总大小上限（MB）")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	policy := retentionPolicy(r)
+	if !policy.Enabled() {
+		return errors.New("未设置保留策略（配置文件 retention 或 --days/--count/--size）")
+	}
+
+	st := storage.NewStorage(storage.Options{Directory: c.Storage.Directory})
+	entries, err := st.Cleanup(policy, *dryRun)
+	var size int64
+	for _, e := range entries {
+		size += e.Size
+	}
+	switch {
+	case len(entries) == 0 && err == nil:
+		fmt.Println("没有需要清理的截图")
+	case *dryRun:
+		printEntries(st.Catalog(), entries, 0)
+		fmt.Printf("将清理 %d 张截图，共 %s\n", len(entries), formatBytes(size))
+	default:
+		action := "删除"
+		if policy.Trash {
+			action = "移到回收站 " + filepath.Join(c.Storage.Directory, storage.TrashDir)
+		}
+		fmt.Printf("已%s %d 张截图，共 %s\n", action, len(entries), formatBytes(size))
+	}
+	return err
+}
+
+// cmdDedupe 合并保存目录中的重复截图：每组保留最早的一张（合并标签和备注），
+// 其余移到回收站（--delete 时直接删除）。默认只合并像素完全相同的截图，
+// 且只处理 SnapCLI 保存的截图，--all 时包括扫描目录发现的其他图片
+func cmdDedupe(args []string) error {
+	fs := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "只列出重复的截图")
+	distance := fs.Int("distance", 0, "感知哈希距离不超过该值时也视为重复（0 只合并完全相同的截图）")
+	del := fs.Bool("delete", false, "直接删除而不是移到回收站")
+	all := fs.Bool("all", false, "包括不是由 SnapCLI 保存的图片")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cat, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	// 补全索引和感知哈希（升级前保存的截图、手动放入的图片），--dry-run 时不写入索引
+	var entries []storage.Entry
+	if *dryRun {
+		entries, err = cat.Scan()
+	} else if _, _, err = cat.Sync(); err == nil {
+		entries, err = cat.Entries()
+	}
+	if err != nil {
+		return err
+	}
+	if !*all {
+		captures := entries[:0]
+		for _, e := range entries {
+			if e.Source == storage.SourceCapture {
+				captures = append(captures, e)
+			}
+		}
+		entries = captures
+	}
+	groups := storage.Duplicates(entries, max(0, min(64, *distance)))
+	if len(groups) == 0 {
+		fmt.Println("没有重复的截图")
+		return nil
+	}
+
+	count, size := 0, int64(0)
+	for _, g := range groups {
+		fmt.Println("保留:")
+		printEntries(cat, g[:1], 0)
+		fmt.Println("重复:")
+		printEntries(cat, g[1:], 0)
+		fmt.Println()
+		for _, e := range g[1:] {
+			count++
+			size += e.Size
+		}
+		if *dryRun {
+			continue
+		}
+
+		err := cat.Update(g[0].Path, func(keep *storage.Entry) {
+			for _, e := range g[1:] {
+				for _, t := range e.Tags {
+					if !keep.HasTag(t) {
+						keep.Tags = append(keep.Tags, t)
+					}
+				}
+				if e.Note != "" && !strings.Contains(keep.Note, e.Note) {
+					keep.Note = strings.TrimSpace(keep.Note + "\n" + e.Note)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := cat.Clean(g[1:], !*del); err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		fmt.Printf("共 %d 组，%d 张重复截图，%s\n", len(groups), count, formatBytes(size))
+	} else {
+		fmt.Printf("已合并 %d 组，清理 %d 张重复截图，%s\n", len(groups), count, formatBytes(size))
+	}
+	return nil
+}
+
+// openCatalog 打开保存目录的截图索引
+func openCatalog() (*storage.Catalog, error) {
+	c, _ := loadConfig()
+	if _, err := os.Stat(c.Storage.Directory); err != nil {
+		return nil, err
+	}
+	return storage.NewCatalog(c.Storage.Directory), nil
+}
+
+// printEntries 打印索引记录（limit > 0 时只打印最后 limit 条）
+func printEntries(cat *storage.Catalog, entries []storage.Entry, limit int) {
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	for _, e := range entries {
+		fmt.Printf("%s  %5dx%-5d %9s  %s\n",
+			e.Time.Local().Format("2006-01-02 15:04:05"), e.Width, e.Height, formatBytes(e.Size), cat.Abs(e.Path))
+		var extra []string
+		if len(e.Tags) > 0 {
+			extra = append(extra, "标签: "+strings.Join(e.Tags, ", "))
+		}
+		if e.Window != "" {
+			extra = append(extra, "窗口: "+e.Window)
+		}
+		if e.Note != "" {
+			extra = append(extra, "备注: "+e.Note)
+		}
+		if len(extra) > 0 {
+			fmt.Println("    " + strings.Join(extra, "  "))
+		}
+	}
+}
+
+// parseTimeArg 解析时间参数：相对时间（30m、12h、2d、1w）或日期（2006-01-02、2006-01-02 15:04）
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	units := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if n := len(s); n > 1 {
+		if unit, ok := units[s[n-1]]; ok {
+			if v, err := strconv.Atoi(s[:n-1]); err == nil && v >= 0 {
+				return now.Add(-time.Duration(v) * unit), nil
+			}
+		}
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q（示例：2d、12h、2024-05-01）", s)
+}
+
+// splitTags 拆分逗号分隔的标签
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// hasTags 是否带有全部标签
+func hasTags(e *storage.Entry, tags []string) bool {
+	for _, t := range tags {
+		if !e.HasTag(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeTag 移除标签（不区分大小写）
+func removeTag(tags []string, tag string) []string {
+	out := tags[:0]
+	for _, t := range tags {
+		if !strings.EqualFold(t, tag) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// printEstimates 打印各模型的 token 估算
+func printEstimates(w, h int) {
+	for _, e := range vision.Estimates(w, h) {
+		fmt.Printf("    %-8s %5dx%-5d 约 %d tokens\n", e.Model, e.Width, e.Height, e.Tokens)
+	}
+}
+
+// formatBytes 将字节数格式化为 KB/MB
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"snapcli/internal/storage"
+)
+
+// defaultThumbSize 未配置缩略图尺寸时图库使用的缩略图尺寸
+const defaultThumbSize = 320
+
+// imageMIME 图片扩展名对应的 MIME 类型
+var imageMIME = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".tiff": "image/tiff",
+	".webp": "image/webp",
+}
+
+// galleryItem 图库中的一张截图
+type galleryItem struct {
+	Name        string
+	Link        string       // 截图链接（相对图库文件）
+	Thumb       template.URL // 缩略图（data URI）
+	Full        template.URL // 内嵌的原图（data URI，--embed 时）
+	Time        string
+	Width       int
+	Height      int
+	Size        string
+	Window      string
+	Tags        []string
+	Note        string
+	Annotations int      // 标注数量（PNG 元数据）
+	Texts       []string // 文字标注的内容
+}
+
+// galleryDay 同一天的截图
+type galleryDay struct {
+	Date  string
+	Items []galleryItem
+}
+
+// cmdGallery 生成保存目录的静态 HTML 图库（按天分组，缩略图内嵌在页面中）
+func cmdGallery(args []string) error {
+	c, _ := loadConfig()
+	fs := flag.NewFlagSet("gallery", flag.ContinueOnError)
+	out := fs.String("o", filepath.Join(c.Storage.Directory, "gallery.html"), "输出文件")
+	day := fs.String("day", "", "只包含某一天：2006-01-02 或 today")
+	since := fs.String("since", "", "起始时间：2d、1w 或 2006-01-02")
+	var tags stringList
+	fs.Var(&tags, "tag", "标签（可重复，需全部匹配）")
+	embed := fs.Bool("embed", false, "内嵌原图，生成可单独分享的页面")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var from, to time.Time
+	var err error
+	switch {
+	case *day == "today":
+		from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		to = from.AddDate(0, 0, 1)
+	case *day != "":
+		if from, err = time.ParseInLocation("2006-01-02", *day, time.Local); err != nil {
+			return fmt.Errorf("无法解析日期 %q", *day)
+		}
+		to = from.AddDate(0, 0, 1)
+	case *since != "":
+		if from, err = parseTimeArg(*since, now); err != nil {
+			return err
+		}
+	}
+
+	cat, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	if _, _, err := cat.Sync(); err != nil {
+		return err
+	}
+	entries, err := cat.Entries()
+	if err != nil {
+		return err
+	}
+	size := c.Storage.ThumbSize
+	if size <= 0 {
+		size = defaultThumbSize
+	}
+	outDir, err := filepath.Abs(filepath.Dir(*out))
+	if err != nil {
+		return err
+	}
+
+	// 最新的一天在前，同一天内按时间顺序
+	var days []galleryDay
+	count := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !from.IsZero() && e.Time.Before(from) || !to.IsZero() && !e.Time.Before(to) || !hasTags(&e, tags) {
+			continue
+		}
+		item, err := newGalleryItem(cat, e, outDir, size, *embed)
+		if err != nil {
+			fmt.Printf("跳过 %s: %v\n", e.Path, err)
+			continue
+		}
+		date := e.Time.Local().Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, galleryDay{Date: date})
+		}
+		d := &days[len(days)-1]
+		d.Items = append([]galleryItem{item}, d.Items...)
+		count++
+	}
+	if count == 0 {
+		return fmt.Errorf("没有符合条件的截图")
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	err = galleryTemplate.Execute(f, map[string]any{
+		"Title": "SnapCLI 截图 " + now.Format("2006-01-02 15:04"),
+		"Days":  days,
+		"Count": count,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已生成图库: %s（%d 张截图）\n", *out, count)
+	return nil
+}
+
+// newGalleryItem 生成图库条目：内嵌缩略图（不存在时生成），读取 PNG 元数据中的标注
+func newGalleryItem(cat *storage.Catalog, e storage.Entry, outDir string, thumbSize int, embed bool) (galleryItem, error) {
+	abs := cat.Abs(e.Path)
+	thumbPath, err := cat.Thumbnail(e.Path, thumbSize)
+	if err != nil {
+		return galleryItem{}, err
+	}
+	thumb, err := dataURI(thumbPath)
+	if err != nil {
+		return galleryItem{}, err
+	}
+
+	item := galleryItem{
+		Name:   path.Base(e.Path),
+		Link:   fileLink(outDir, abs),
+		Thumb:  thumb,
+		Time:   e.Time.Local().Format("15:04:05"),
+		Width:  e.Width,
+		Height: e.Height,
+		Size:   formatBytes(e.Size),
+		Window: e.Window,
+		Tags:   e.Tags,
+		Note:   e.Note,
+	}
+	if embed {
+		if item.Full, err = dataURI(abs); err != nil {
+			return galleryItem{}, err
+		}
+	}
+
+	if f, err := os.Open(abs); err == nil {
+		meta, _ := storage.ReadMetadata(f)
+		f.Close()
+		if anns, err := storage.ReadAnnotations(meta); err == nil {
+			item.Annotations = len(anns)
+			for _, a := range anns {
+				if a.Text != "" {
+					item.Texts = append(item.Texts, a.Text)
+				}
+			}
+		}
+	}
+	return item, nil
+}
+
+// dataURI 读取文件生成 data URI
+func dataURI(file string) (template.URL, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	typ, ok := imageMIME[strings.ToLower(filepath.Ext(file))]
+	if !ok {
+		typ = "application/octet-stream"
+	}
+	return template.URL("data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// fileLink 文件相对图库所在目录的链接，无法使用相对路径时使用 file:// 链接
+func fileLink(outDir, file string) string {
+	if rel, err := filepath.Rel(outDir, file); err == nil {
+		return (&url.URL{Path: filepath.ToSlash(rel)}).String()
+	}
+	return (&url.URL{Scheme: "file", Path: "/" + strings.TrimPrefix(filepath.ToSlash(file), "/")}).String()
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; padding: 24px; font: 14px/1.5 -apple-system, "Segoe UI", "Microsoft YaHei", sans-serif; background: #f5f5f7; color: #1d1d1f; }
+h1 { font-size: 20px; margin: 0 0 16px; }
+h2 { font-size: 16px; margin: 28px 0 12px; color: #555; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(240px, 1fr)); gap: 16px; }
+.card { background: #fff; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,.12); overflow: hidden; }
+.card a.thumb { display: flex; align-items: center; justify-content: center; height: 180px; background: #e8e8ed; }
+.card img { max-width: 100%; max-height: 180px; }
+.info { padding: 8px 12px; font-size: 12px; color: #666; word-break: break-all; }
+.info .name { color: #1d1d1f; font-size: 13px; }
+.tag { display: inline-block; padding: 0 6px; margin: 2px 4px 0 0; border-radius: 4px; background: #e3edff; color: #0a58ca; }
+.note { color: #1d1d1f; white-space: pre-wrap; }
+#overlay { display: none; position: fixed; inset: 0; background: rgba(0,0,0,.85); align-items: center; justify-content: center; cursor: zoom-out; }
+#overlay img { max-width: 95vw; max-height: 95vh; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}（{{.Count}} 张）</h1>
+{{range .Days}}
+<h2>{{.Date}}（{{len .Items}} 张）</h2>
+<div class="grid">
+{{- range .Items}}
+<div class="card">
+<a class="thumb" href="{{.Link}}" target="_blank"{{if .Full}} data-full="{{.Full}}"{{end}}><img src="{{.Thumb}}" alt="{{.Name}}" loading="lazy"></a>
+<div class="info">
+<div class="name">{{.Name}}</div>
+<div>{{.Time}} · {{.Width}}×{{.Height}} · {{.Size}}{{if .Annotations}} · {{.Annotations}} 个标注{{end}}</div>
+{{- if .Window}}<div>窗口: {{.Window}}</div>{{end}}
+{{- if .Tags}}<div>{{range .Tags}}<span class="tag">{{.}}</span>{{end}}</div>{{end}}
+{{- if .Note}}<div class="note">{{.Note}}</div>{{end}}
+{{- if .Texts}}<div>文字标注: {{range $i, $t := .Texts}}{{if $i}}；{{end}}{{$t}}{{end}}</div>{{end}}
+</div>
+</div>
+{{- end}}
+</div>
+{{end}}
+<div id="overlay"><img alt=""></div>
+<script>
+var overlay = document.getElementById("overlay");
+document.querySelectorAll("a[data-full]").forEach(function (a) {
+  a.addEventListener("click", function (e) {
+    e.preventDefault();
+    overlay.firstElementChild.src = a.dataset.full;
+    overlay.style.display = "flex";
+  });
+});
+overlay.addEventListener("click", function () { overlay.style.display = "none"; });
+</script>
+</body>
+</html>
+`))
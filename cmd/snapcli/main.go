@@ -1,26 +1,36 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"time"
 
 	"snapcli/internal/annotate"
+	"snapcli/internal/beautify"
 	"snapcli/internal/capture"
 	"snapcli/internal/clipboard"
 	"snapcli/internal/config"
 	"snapcli/internal/hotkey"
+	"snapcli/internal/keymap"
 	"snapcli/internal/notify"
 	"snapcli/internal/storage"
 	"snapcli/internal/tray"
+	"snapcli/internal/watermark"
 
 	"golang.design/x/hotkey/mainthread"
 )
 
+// appVersion 版本号（同时写入截图元数据）
+const appVersion = "1.0.1"
+
 var (
 	cfg      *config.Config
 	capturer capture.Capturer
@@ -32,6 +42,11 @@ var (
 )
 
 func main() {
+	// 子命令（如 snapcli info image.png）
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
 	// 命令行参数
 	setHotkeyFlag := flag.String("set-hotkey", "", "设置快捷键，格式：alt+1")
 	showConfig := flag.Bool("config", false, "显示配置文件路径")
@@ -39,7 +54,7 @@ func main() {
 	flag.Parse()
 
 	if *version {
-		fmt.Println("SnapCLI v1.0.0")
+		fmt.Println("SnapCLI v" + appVersion)
 		fmt.Println("截图路径复制工具")
 		return
 	}
@@ -72,22 +87,11 @@ func run() {
 
 	// 加载配置
 	var err error
-	cfg, err = config.Load()
+	cfg, err = loadConfig()
 	if err != nil {
 		fmt.Println("加载配置失败:", err)
 	}
 
-	// 强制使用 exe 同级目录下的 screenshots 文件夹保存截图
-	exePath, err := os.Executable()
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		screenshotDir := filepath.Join(exeDir, "screenshots")
-		cfg.Storage.Directory = screenshotDir
-	}
-
-	// 确保存储目录存在
-	cfg.EnsureStorageDir()
-
 	// 设置标注编辑器的调试日志回调
 	annotate.DebugLogFunc = debugLog
 
@@ -96,14 +100,40 @@ func run() {
 	selector = capture.NewSelector()
 	clip = clipboard.NewClipboard()
 	notifier = notify.NewNotifier()
-	store = storage.NewStorage(cfg.Storage.Directory, cfg.Storage.Format, cfg.Storage.Quality)
+	store = storage.NewStorage(storage.Options{
+		Directory: cfg.Storage.Directory,
+		Format:    cfg.Storage.Format,
+		Quality:   cfg.Storage.Quality,
+		Filename:  cfg.Storage.Filename,
+		Subdir:    cfg.Storage.Subdir,
+
+		MaxEdge:       cfg.Storage.MaxEdge,
+		MaxMegapixels: cfg.Storage.MaxMegapixels,
+		KeepOriginal:  cfg.Storage.KeepOriginal,
+
+		Colors:      cfg.Storage.Colors,
+		Dither:      cfg.Storage.Dither,
+		Compression: cfg.Storage.Compression,
 
-	fmt.Println("SnapCLI v1.0.1 已启动")
+		MaxBytes: cfg.Storage.MaxBytes,
+
+		DedupeWindow:    time.Duration(cfg.Storage.DedupeMinutes) * time.Minute,
+		SimilarDistance: cfg.Storage.SimilarDistance,
+
+		ThumbSize: cfg.Storage.ThumbSize,
+	})
+
+	fmt.Println("SnapCLI v" + appVersion + " 已启动")
 	fmt.Printf("快捷键: %s\n", cfg.GetHotkeyString())
 	fmt.Printf("截图保存到: %s\n", cfg.Storage.Directory)
 	fmt.Printf("Storage目录: %s\n", store.GetDirectory())
 	fmt.Println("按快捷键截图，路径自动复制到剪贴板")
 
+	// 后台按保留策略清理旧截图
+	if cfg.Retention.Enabled {
+		go runRetention(retentionPolicy(cfg.Retention), time.Duration(cfg.Retention.Interval)*time.Minute)
+	}
+
 	// 创建并注册热键
 	hkMgr = hotkey.NewManager()
 	if err := hkMgr.Register(cfg.Hotkey.Modifiers, cfg.Hotkey.Key, onHotkeyPressed); err != nil {
@@ -133,9 +163,23 @@ func run() {
 	t.Run()
 }
 
+// loadConfig 加载配置（出错时返回默认配置和错误），并确保存储目录存在。
+// 强制使用 exe 同级目录下的 screenshots 文件夹保存截图
+func loadConfig() (*config.Config, error) {
+	c, err := config.Load()
+	if exePath, e := os.Executable(); e == nil {
+		c.Storage.Directory = filepath.Join(filepath.Dir(exePath), "screenshots")
+	}
+	c.EnsureStorageDir()
+	return c, err
+}
+
 func onHotkeyPressed() {
 	debugLog("=== 开始截图 ===")
 
+	// 记录截图时间和前台窗口（用于文件名模板，选区窗口出现前获取）
+	info := storage.SaveInfo{Time: time.Now(), Window: capture.ForegroundWindowTitle()}
+
 	// 1. 全屏截图
 	fullscreen, err := capturer.CaptureFullScreen()
 	if err != nil {
@@ -161,17 +205,48 @@ func onHotkeyPressed() {
 	// 3. 打开标注编辑器（传入全屏截图和选区，仿微信截图风格）
 	selRect := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height)
 	debugLog("编辑器 selRect: %v", selRect)
-	result := annotate.OpenEditor(fullscreen, selRect)
+	opts := editorOptions(cfg.Annotate)
+	opts.ScaleFactor = selectionScaleFactor(*region)
+	if km, err := keymap.Parse(cfg.Keymap); err == nil {
+		opts.Keymap = km // 无效时使用默认快捷键（加载配置时已提示）
+	}
+	result := annotate.OpenEditor(fullscreen, selRect, opts)
 	if result == nil || result.Cancelled {
 		return // 用户取消标注
 	}
 
-	// 5. 保存图片（带标注）
-	savePath, err := store.Save(result.Image)
+	// 4. 美化（留白背景、圆角、投影）和水印
+	var img image.Image = result.Image
+	var offset image.Point // 编辑器输出的图片在最终图片中的位置
+	if preset, ok := cfg.ActiveBeautifyPreset(); ok {
+		bo := beautifyOptions(preset)
+		offset = beautify.Frame(img.Bounds().Size(), bo).Min
+		img = beautify.Apply(img, bo)
+	}
+	if cfg.Watermark.Enabled {
+		img = watermark.Apply(img, watermarkOptions(cfg.Watermark))
+	}
+
+	// 仅复制：图片放入剪贴板，不保存文件
+	if result.CopyOnly {
+		if err := clip.SetImage(img); err != nil {
+			notifier.Show("复制失败", err.Error())
+			return
+		}
+		if cfg.Behavior.ShowNotification {
+			notifier.Show("截图已复制", "图片已复制到剪贴板")
+		}
+		return
+	}
+
+	// 5. 保存图片（带标注和元数据）
+	captureMetadata(&info, result, offset, opts.ScaleFactor)
+	saved, err := store.Save(img, info)
 	if err != nil {
 		notifier.Show("保存失败", err.Error())
 		return
 	}
+	savePath := saved.Path
 
 	// 6. 复制路径到剪贴板
 	if err := clip.SetText(savePath); err != nil {
@@ -179,10 +254,178 @@ func onHotkeyPressed() {
 		return
 	}
 
-	// 7. 显示通知
+	// 7. 显示通知（重复截图时提示复用了已有文件）
 	if cfg.Behavior.ShowNotification {
-		notifier.Show("截图完成", savePath)
+		switch {
+		case saved.Reused:
+			notifier.Show("截图与最近的截图相同", "已复用: "+savePath)
+		case saved.Similar != "":
+			notifier.Show("截图完成", savePath+"\n与最近的截图几乎相同: "+filepath.Base(saved.Similar))
+		default:
+			notifier.Show("截图完成", savePath)
+		}
+	}
+}
+
+// editorOptions 将配置中的标注样式转换为编辑器选项（配置已在加载时验证）
+func editorOptions(a config.Annotate) annotate.EditorOptions {
+	var opts annotate.EditorOptions
+	for _, s := range a.Palette {
+		c, _ := config.ParseHexColor(s)
+		opts.Palette = append(opts.Palette, c)
+	}
+	opts.LineWidths = a.LineWidths
+	opts.FontSizes = a.FontSizes
+	opts.DefaultTool, _ = annotate.ParseTool(a.DefaultTool)
+	opts.Snap = annotate.SnapOptions{Grid: a.Grid, Threshold: a.SnapDistance}
+
+	for _, p := range a.Presets {
+		preset := annotate.StylePreset{
+			Name:      p.Name,
+			LineWidth: p.LineWidth,
+			FontSize:  p.FontSize,
+			Opacity:   p.Opacity,
+			Outline:   p.Outline,
+			Filled:    p.Filled,
+		}
+		preset.Tool, preset.SwitchTool = annotate.ParseTool(p.Tool)
+		if p.Color != "" {
+			preset.Color, _ = config.ParseHexColor(p.Color)
+		}
+		opts.Presets = append(opts.Presets, preset)
+	}
+	return opts
+}
+
+// beautifyOptions 将配置中的美化预设转换为美化参数（颜色已在加载配置时验证）
+func beautifyOptions(p config.BeautifyPreset) beautify.Options {
+	bg, _ := config.ParseHexColor(p.Background)
+	var gradient color.RGBA
+	if p.Gradient != "" {
+		gradient, _ = config.ParseHexColor(p.Gradient)
+	}
+	return beautify.Options{
+		Padding:       p.Padding,
+		Background:    bg,
+		Gradient:      gradient,
+		GradientAngle: float64(p.GradientAngle),
+		CornerRadius:  p.CornerRadius,
+		ShadowBlur:    p.Shadow,
+		ShadowOffset:  p.ShadowOffset,
+		ShadowColor:   color.RGBA{0, 0, 0, uint8(p.ShadowOpacity * 255 / 100)},
+	}
+}
+
+// watermarkOptions 将水印配置转换为水印参数（展开文字中的占位符）
+func watermarkOptions(w config.Watermark) watermark.Options {
+	c, _ := config.ParseHexColor(w.Color)
+	return watermark.Options{
+		Text:      watermark.Expand(w.Text, time.Now()),
+		ImagePath: w.Image,
+		Position:  watermark.Position(w.Position),
+		Opacity:   w.Opacity,
+		Scale:     w.Scale,
+		Margin:    w.Margin,
+		Color:     c,
+	}
+}
+
+// captureMetadata 生成写入图片的元数据：截图时间、选区、显示器、窗口标题、版本、标注列表，
+// 以及虚拟屏幕坐标到图片坐标的变换（选区位置、编辑器中的裁剪/旋转等操作和美化留白）。
+// 标注和变换的坐标相对于最终图片（编辑器输出的图片位于 offset 处），保存时缩小的图片由 Storage.Save 换算
+func captureMetadata(info *storage.SaveInfo, result *annotate.EditorResult, offset image.Point, scale float64) {
+	full := capturer.GetFullBounds()
+	sel := result.Selection
+	x, y := full.X+sel.Min.X, full.Y+sel.Min.Y
+	info.Metadata = storage.Metadata{
+		storage.MetaCreationTime: info.Time.Format(time.RFC3339),
+		storage.MetaSoftware:     "SnapCLI v" + appVersion,
+		storage.MetaRegion:       fmt.Sprintf("%d,%d,%dx%d", x, y, sel.Dx(), sel.Dy()),
+		storage.MetaScale:        strconv.FormatFloat(scale, 'f', -1, 64),
+	}
+	if displays, err := capturer.GetDisplays(); err == nil {
+		if d, ok := capture.DisplayAt(displays, x+sel.Dx()/2, y+sel.Dy()/2); ok {
+			info.Metadata[storage.MetaDisplay] = strconv.Itoa(d.Index)
+		}
+	}
+	if info.Window != "" {
+		info.Metadata[storage.MetaWindow] = info.Window
+	}
+
+	t := result.Transform
+	transform := storage.Translate(float64(-x), float64(-y)).
+		Then(storage.Transform{
+			A: float64(t.XX), B: float64(t.XY), C: float64(t.X0),
+			D: float64(t.YX), E: float64(t.YY), F: float64(t.Y0),
+		}).
+		Then(storage.Translate(float64(offset.X), float64(offset.Y)))
+	info.Transform = &transform
+
+	info.Annotations = make([]storage.Annotation, len(result.Annotations))
+	for i := range result.Annotations {
+		info.Annotations[i] = annotationRecord(&result.Annotations[i], offset)
+	}
+}
+
+// annotationRecord 将标注转换为元数据记录（坐标平移 offset）
+func annotationRecord(a *annotate.Annotation, offset image.Point) storage.Annotation {
+	r := storage.Annotation{
+		Tool:     annotate.ToolKey[a.Type],
+		Points:   make([][2]int, len(a.Points)),
+		Color:    fmt.Sprintf("#%02x%02x%02x%02x", a.Color.R, a.Color.G, a.Color.B, a.Color.A),
+		Width:    a.LineWidth,
+		Text:     a.Text,
+		FontSize: a.FontSize,
+		Filled:   a.Filled,
+		Rotation: a.Rotation,
+	}
+	for i, p := range a.Points {
+		p = p.Add(offset)
+		r.Points[i] = [2]int{p.X, p.Y}
 	}
+	if a.Opacity > 0 && a.Opacity < 100 {
+		r.Opacity = a.Opacity
+	}
+	return r
+}
+
+// retentionPolicy 将保留策略配置转换为存储的清理参数
+func retentionPolicy(r config.Retention) storage.RetentionPolicy {
+	return storage.RetentionPolicy{
+		MaxAge:     time.Duration(r.MaxAgeDays) * 24 * time.Hour,
+		MaxCount:   r.MaxCount,
+		MaxBytes:   int64(r.MaxSizeMB) << 20,
+		KeepTagged: r.KeepTagged,
+		Trash:      r.Trash,
+	}
+}
+
+// runRetention 启动时及之后每隔 interval 按保留策略清理一次
+func runRetention(p storage.RetentionPolicy, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cleaned, err := store.Cleanup(p, false)
+		if err != nil {
+			debugLog("清理截图失败: %v", err)
+		}
+		if len(cleaned) > 0 {
+			debugLog("已清理 %d 张截图", len(cleaned))
+		}
+		<-ticker.C
+	}
+}
+
+// selectionScaleFactor 获取选区中心所在显示器的缩放比例（全屏截图坐标以虚拟屏幕左上角为原点）
+func selectionScaleFactor(region capture.Region) float64 {
+	displays, err := capturer.GetDisplays()
+	if err != nil {
+		return 1
+	}
+	full := capturer.GetFullBounds()
+	cx := full.X + region.X + region.Width/2
+	cy := full.Y + region.Y + region.Height/2
+	return capture.ScaleFactorAt(displays, cx, cy)
 }
 
 func openScreenshotDir() {
@@ -222,7 +465,11 @@ func updateHotkey(hotkeyStr string) error {
 		return fmt.Errorf("无效的快捷键格式")
 	}
 
-	cfg, _ := config.Load()
+	// 配置文件读取失败时不保存，避免用默认配置覆盖
+	cfg, err := config.Load()
+	if err != nil && !errors.Is(err, config.ErrKeymap) {
+		return fmt.Errorf("加载配置失败: %w", err)
+	}
 	return cfg.SetHotkey(modifiers, key)
 }
 
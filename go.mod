@@ -6,6 +6,7 @@ require (
 	github.com/getlantern/systray v1.2.2
 	github.com/go-toast/toast v0.0.0-20190211030409-01e6764cf0a4
 	golang.design/x/hotkey v0.4.1
+	golang.org/x/image v0.24.0
 )
 
 require (
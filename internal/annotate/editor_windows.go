@@ -9,10 +9,15 @@ import (
 	"math"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"unicode/utf16"
+	"unicode/utf8"
 	"unsafe"
+
+	"snapcli/internal/clipboard"
+	"snapcli/internal/keymap"
 )
 
 // ============================================================================
@@ -55,6 +60,8 @@ var (
 	fillRect             = user32.NewProc("FillRect")
 	getCursorPos         = user32.NewProc("GetCursorPos")
 	screenToClientProc   = user32.NewProc("ScreenToClient")
+	setTimer             = user32.NewProc("SetTimer")
+	killTimer            = user32.NewProc("KillTimer")
 )
 
 // gdi32 函数
@@ -127,25 +134,37 @@ const (
 	wmEraseBkgnd   = 0x0014
 	wmSetCursor    = 0x0020
 	wmKeyDown      = 0x0100
+	wmKeyUp        = 0x0101
 	wmChar         = 0x0102
+	wmSysKeyDown   = 0x0104
+	wmTimer        = 0x0113
 	wmMouseMove    = 0x0200
 	wmLButtonDown  = 0x0201
 	wmLButtonUp    = 0x0202
 	wmLButtonDblClk = 0x0203
 	wmRButtonDown  = 0x0204
+	wmMouseWheel   = 0x020A
 
 	vkEscape    = 0x1B
 	vkReturn    = 0x0D
-	vkBack      = 0x08
+	vkB         = 0x42
+	vkE         = 0x45
+	vkK         = 0x4B
+	vkL         = 0x4C
+	vkO         = 0x4F
+	vkR         = 0x52
+	vkT         = 0x54
 	vkControl   = 0x11
 	vkShift     = 0x10
-	vkZ         = 0x5A
-	vkY         = 0x59
+	vkMenu      = 0x12 // Alt
+	vkSpace     = 0x20
 	vk1         = 0x31
+	vkF4        = 0x73
 
 	idcCross   = 32515
 	idcArrow   = 32512
 	idcSizeAll = 32646 // 移动光标
+	idcHand    = 32649 // 手形光标（平移视图）
 	idcSizeNWSE = 32642 // 左上↔右下
 	idcSizeNESW = 32643 // 右上↔左下
 	idcSizeNS   = 32645 // 上↔下
@@ -172,6 +191,11 @@ const (
 
 	// CS_DBLCLKS 窗口类样式：允许接收双击消息
 	csDblClks = 0x0008
+
+	// 画笔停顿识别图形的定时器
+	timerShapeHold    = 1
+	shapeHoldDelayMs  = 600 // 停顿多久后尝试识别
+	shapeHoldMoveTol  = 3   // 停顿期间允许的抖动（像素）
 )
 
 // ============================================================================
@@ -378,13 +402,38 @@ func gdipFillRoundRect(graphics, brush uintptr, x, y, w, h, r int) {
 }
 
 // mainToolBtnOrder 主工具栏中工具按钮的显示顺序
-// 矩形 → 椭圆 → 箭头 → 直线 → 画笔 → 文本 → 马赛克
+// 矩形 → 椭圆 → 箭头 → 直线 → 画笔 → 文本 → 马赛克 → 选择
 var mainToolBtnOrder = []ToolType{
-	ToolRect, ToolEllipse, ToolArrow, ToolLine, ToolFreehand, ToolText, ToolMosaic,
+	ToolRect, ToolEllipse, ToolArrow, ToolLine, ToolFreehand, ToolText, ToolMosaic, ToolImage, ToolMeasure, ToolSelect,
 }
 
-// subToolbarLineWidths 二级面板中的线宽选项 (2px / 4px / 8px)
-var subToolbarLineWidths = []int{2, 4, 8}
+// 标注选择参数
+const (
+	annotationHitTol  = 4 // 标注命中容差（像素）
+	annotationMinSize = 6 // 缩放标注时的最小尺寸
+)
+
+// canvasPadSize 扩展画布时每边增加的像素
+const canvasPadSize = 20
+
+// snapGridMinDraw 吸附网格的最小绘制间距（更密的网格只吸附、不显示）
+const snapGridMinDraw = 8
+
+// colorViewBackground 缩小视图时选区内画布以外区域的颜色
+var colorViewBackground = color.RGBA{40, 40, 40, 255}
+
+// 图章参数
+const (
+	stampDefaultSize  = 48 // 单击放置图章时的默认尺寸
+	imageRotateStep   = 15 // 旋转选中图片的步进角度（度）
+	pasteImageMaxFrac = 2  // 粘贴的图片最大占截图宽高的 1/pasteImageMaxFrac
+)
+
+// subToolbarOpacities 不透明度按钮依次切换的取值（百分比）
+var subToolbarOpacities = []int{100, 75, 50, 25}
+
+// subToolbarStyleBtns 二级面板末尾的样式按钮数量（轮廓 + 不透明度）
+const subToolbarStyleBtns = 2
 
 // ============================================================================
 // Editor 结构体
@@ -402,7 +451,19 @@ type Editor struct {
 	currentTool  ToolType
 	currentColor color.RGBA
 	lineWidth    int
+	opacity      int       // 新标注的不透明度（百分比）
+	outline      bool      // 新标注是否带对比色轮廓
+	stamp        StampType // 图章工具当前的图章
+	scaleFactor  float64   // 显示器缩放比例（测量工具换算逻辑点）
 	fontSize     int
+	filled       bool      // 新矩形/椭圆是否填充（由样式预设设置）
+
+	// 可配置的样式选项
+	palette    []color.RGBA  // 颜色面板
+	lineWidths []int         // 线宽选项
+	fontSizes  []int         // 字号选项（文本工具）
+	presets    []StylePreset // 样式预设
+	bindings   map[keymap.Chord]string // 快捷键到动作的映射
 
 	// 绘制状态
 	drawing        bool           // 是否正在绘制
@@ -410,11 +471,22 @@ type Editor struct {
 	currentPt      image.Point    // 当前点
 	tempAnnotation *Annotation    // 正在绘制的临时标注（用于预览）
 	freehandPts    []image.Point  // 自由画笔的点集
+	holdPt         image.Point    // 画笔停顿检测的参考点
+	shapeHint      *Annotation    // 画笔停顿后识别出的规则图形（松开鼠标时替换笔迹）
 
 	// 文本输入状态
 	textInput  bool        // 是否在文本输入模式
 	textBuffer string      // 文本缓冲
 	textPos    image.Point // 文本位置
+	textStyle  TextStyle   // 新文本的样式
+
+	// 标注选择状态（选择工具）
+	selected      []int           // 选中的标注索引（升序，分组成员总是一起选中）
+	editingAnn    bool            // 是否正在拖拽选中的标注
+	editHandle    int             // -1=移动, 0-7=调整手柄
+	editStartPt   image.Point     // 拖拽起始画布坐标
+	editStartRect image.Rectangle // 拖拽起始时的标注边界
+	editPreview   []Annotation    // 拖拽中的标注预览（与 selected 一一对应）
 
 	// 选区拖拽状态（移动/调整大小）
 	draggingSelection bool            // 是否正在拖拽选区
@@ -422,6 +494,23 @@ type Editor struct {
 	dragStartMouse    image.Point     // 拖拽起始鼠标位置
 	dragStartRect     image.Rectangle // 拖拽起始选区矩形
 
+	// 裁剪状态
+	cropMode     bool        // 是否处于裁剪模式（拖拽选择裁剪区域）
+	cropDragging bool        // 是否正在拖拽裁剪区域
+	cropStart    image.Point // 裁剪区域起点（画布坐标）
+	cropEnd      image.Point // 裁剪区域终点（画布坐标）
+
+	// 视图缩放与平移（按住空格拖拽平移）
+	view          viewTransform // 画布到选区的缩放和平移
+	spaceDown     bool          // 是否按住空格
+	panning       bool          // 是否正在拖拽平移
+	panStartMouse image.Point   // 平移起始鼠标位置
+	panStartView  viewTransform // 平移起始时的视图
+
+	// 吸附状态（按住 Alt 时吸附到网格、其他标注和 45° 角度）
+	snap       SnapOptions // 吸附参数
+	snapGuides []SnapGuide // 当前显示的对齐参考线
+
 	// UI 布局
 	screenWidth  int // 屏幕宽度
 	screenHeight int // 屏幕高度
@@ -455,11 +544,12 @@ type Editor struct {
 // toolbarButton 工具栏按钮
 type toolbarButton struct {
 	x, y, w, h int
-	kind        string // "tool", "color", "linewidth", "action"
+	kind        string // "tool", "color", "linewidth", "fontsize", "action", "style", "stamp"
 	toolType    ToolType
 	colorIndex  int
-	lineWidth   int
-	action      string // "undo", "redo", "save", "cancel"
+	lineWidth   int    // 线宽（字号按钮为字号）
+	action      string // "undo", "redo", "save", "cancel", "outline", "opacity"
+	stamp       StampType
 }
 
 // ============================================================================
@@ -480,11 +570,13 @@ var DebugLogFunc func(format string, args ...interface{})
 // ============================================================================
 
 // OpenEditor 打开标注编辑器，返回编辑结果
-// fullscreen 是全屏截图，selection 是用户选择的区域矩形
-func OpenEditor(fullscreen *image.RGBA, selection image.Rectangle) *EditorResult {
+// fullscreen 是全屏截图，selection 是用户选择的区域矩形，opts 为编辑器选项
+func OpenEditor(fullscreen *image.RGBA, selection image.Rectangle, opts EditorOptions) *EditorResult {
 	editorMutex.Lock()
 	defer editorMutex.Unlock()
 
+	opts = opts.withDefaults()
+
 	// 锁定当前 goroutine 到 OS 线程，确保 Win32 窗口消息循环的线程亲和性
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
@@ -536,11 +628,21 @@ func OpenEditor(fullscreen *image.RGBA, selection image.Rectangle) *EditorResult
 		fullscreen:    fullscreen,
 		background:    background,
 		dimmedPixels:  dimmedPixels,
-		history:       NewHistory(50),
-		currentTool:   ToolRect,
-		currentColor:  DefaultColors[0], // 默认红色
-		lineWidth:     subToolbarLineWidths[0],
-		fontSize:      DefaultFontSizes[1],
+		history:       NewHistoryWithBudget(DefaultHistoryBytes),
+		currentTool:   opts.DefaultTool,
+		currentColor:  opts.Palette[0],
+		lineWidth:     opts.LineWidths[0],
+		opacity:       subToolbarOpacities[0],
+		stamp:         StampCheck,
+		scaleFactor:   opts.ScaleFactor,
+		fontSize:      opts.FontSizes[min(1, len(opts.FontSizes)-1)],
+		palette:       opts.Palette,
+		lineWidths:    opts.LineWidths,
+		fontSizes:     opts.FontSizes,
+		presets:       opts.Presets,
+		bindings:      opts.Keymap.Bindings(),
+		snap:          opts.Snap,
+		view:          viewTransform{zoom: 1},
 		hoverBtnIndex: -1,
 		hoverSubIndex: -1,
 		screenWidth:   screenW,
@@ -549,6 +651,7 @@ func OpenEditor(fullscreen *image.RGBA, selection image.Rectangle) *EditorResult
 		done:          false,
 	}
 
+	e.history.SetImage(background)
 	editorInstance = e
 
 	// 初始化 GDI+（用于抗锯齿图标绘制）
@@ -698,18 +801,26 @@ func (e *Editor) calculateToolbarPosition() {
 
 // calculateSubToolbarPosition 计算二级面板位置
 func (e *Editor) calculateSubToolbarPosition() {
-	// 二级面板内容: 3个线宽圆点 + 分隔符 + 8个颜色方块
-	numLineWidths := len(subToolbarLineWidths)
-	numColors := len(DefaultColors)
+	// 二级面板内容: 线宽（文本工具为字号）圆点 + 分隔符 + 颜色方块 + 分隔符 + 轮廓/不透明度按钮
+	numLineWidths := len(e.sizeOptions())
+	numColors := len(e.palette)
 
 	// 线宽区域: 每个圆点占 subColorSize 宽度, 间距 subLineWidthGap
 	lineWidthAreaW := numLineWidths*subColorSize + (numLineWidths-1)*subLineWidthGap
 	// 颜色区域: 每个方块 subColorSize, 间距 subColorGap
 	colorAreaW := numColors*subColorSize + (numColors-1)*subColorGap
+	// 样式区域: 与线宽按钮相同的尺寸和间距
+	styleAreaW := subToolbarStyleBtns*subColorSize + (subToolbarStyleBtns-1)*subLineWidthGap
 
-	subW := toolbarPadding + lineWidthAreaW + toolbarSepWidth + colorAreaW + toolbarPadding
+	subW := toolbarPadding + lineWidthAreaW + toolbarSepWidth + colorAreaW + toolbarSepWidth + styleAreaW + toolbarPadding
 	subH := subToolbarHeight
 
+	// 图章工具: 只有图章选择按钮
+	if e.currentTool == ToolImage {
+		numStamps := int(StampCount) - 1
+		subW = toolbarPadding + numStamps*subColorSize + (numStamps-1)*subLineWidthGap + toolbarPadding
+	}
+
 	// 右对齐到主工具栏
 	subLeft := e.mainToolbarRect.Max.X - subW
 	subTop := e.mainToolbarRect.Min.Y - subToolbarGap - subH
@@ -728,7 +839,7 @@ func (e *Editor) calculateSubToolbarPosition() {
 // updateSubToolbarVisibility 根据当前工具更新二级面板可见性
 func (e *Editor) updateSubToolbarVisibility() {
 	switch e.currentTool {
-	case ToolRect, ToolEllipse, ToolArrow, ToolLine, ToolFreehand, ToolMosaic:
+	case ToolRect, ToolEllipse, ToolArrow, ToolLine, ToolFreehand, ToolMosaic, ToolImage, ToolMeasure, ToolSelect:
 		e.showSubToolbar = true
 	default:
 		e.showSubToolbar = false
@@ -759,6 +870,15 @@ func editorWndProc(hwnd, umsg, wParam, lParam uintptr) uintptr {
 		// 优先检查工具栏区域
 		if e.isInMainToolbar(mx, my) || e.isInSubToolbar(mx, my) {
 			cursorID = uintptr(idcArrow)
+		} else if e.spaceDown || e.panning {
+			// 按住空格：平移视图
+			cursorID = uintptr(idcHand)
+		} else if hIdx := e.hitTestAnnotationHandle(mx, my); hIdx >= 0 {
+			// 在选中标注的手柄上：显示调整光标
+			cursorID = uintptr(e.handleCursor(hIdx))
+		} else if e.currentTool == ToolSelect && e.annotationAt(mx, my) >= 0 {
+			// 在标注上：显示移动光标
+			cursorID = uintptr(idcSizeAll)
 		} else if hIdx := e.hitTestHandle(mx, my); hIdx >= 0 {
 			// 在手柄上：显示调整光标
 			cursorID = uintptr(e.handleCursor(hIdx))
@@ -789,10 +909,39 @@ func editorWndProc(hwnd, umsg, wParam, lParam uintptr) uintptr {
 		e.onKeyDown(wParam)
 		return 0
 
+	case wmSysKeyDown:
+		// 按住 Alt 的组合键（保留 Alt+F4 的系统处理）
+		if wParam != vkF4 {
+			e.onKeyDown(wParam)
+			return 0
+		}
+
+	case wmKeyUp:
+		if wParam == vkSpace {
+			e.spaceDown = false
+		}
+		return 0
+
+	case wmMouseWheel:
+		// 滚轮缩放（以鼠标位置为中心，坐标为屏幕坐标）
+		pt := point{X: int32(int16(lParam & 0xFFFF)), Y: int32(int16((lParam >> 16) & 0xFFFF))}
+		screenToClientProc.Call(hwnd, uintptr(unsafe.Pointer(&pt)))
+		delta := int(int16((wParam >> 16) & 0xFFFF))
+		if steps := delta / 120; steps != 0 {
+			e.zoomAt(nextZoom(e.view.zoom, steps), int(pt.X), int(pt.Y))
+		}
+		return 0
+
 	case wmChar:
 		e.onChar(wParam)
 		return 0
 
+	case wmTimer:
+		if wParam == timerShapeHold {
+			e.onShapeHold()
+		}
+		return 0
+
 	case wmLButtonDown:
 		mx := int(int16(lParam & 0xFFFF))
 		my := int(int16((lParam >> 16) & 0xFFFF))
@@ -821,11 +970,19 @@ func editorWndProc(hwnd, umsg, wParam, lParam uintptr) uintptr {
 		return 0
 
 	case wmRButtonDown:
-		// 右键：取消当前绘制或关闭编辑器
-		if e.drawing {
+		// 右键：取消当前绘制/裁剪或关闭编辑器
+		if e.cropMode {
+			if e.cropDragging {
+				releaseCapture.Call()
+			}
+			e.cropMode = false
+			e.cropDragging = false
+			invalidateRect.Call(hwnd, 0, 0)
+		} else if e.drawing {
 			e.drawing = false
 			e.tempAnnotation = nil
 			e.freehandPts = nil
+			e.cancelShapeHold()
 			invalidateRect.Call(hwnd, 0, 0)
 		} else if e.textInput {
 			e.textInput = false
@@ -852,58 +1009,304 @@ func editorWndProc(hwnd, umsg, wParam, lParam uintptr) uintptr {
 
 // onKeyDown 处理键盘按下事件
 func (e *Editor) onKeyDown(wParam uintptr) {
-	// 检查 Ctrl 键状态
+	// 检查修饰键状态
 	ctrlState, _, _ := getKeyState.Call(uintptr(vkControl))
 	ctrlDown := int16(ctrlState) < 0
 	shiftState, _, _ := getKeyState.Call(uintptr(vkShift))
 	shiftDown := int16(shiftState) < 0
+	altState, _, _ := getKeyState.Call(uintptr(vkMenu))
+	altDown := int16(altState) < 0
 
-	switch {
-	case wParam == uintptr(vkEscape):
-		if e.textInput {
+	chord := keymap.Chord{Key: uint16(wParam), Ctrl: ctrlDown, Shift: shiftDown, Alt: altDown}
+	plainCtrl := ctrlDown && !shiftDown && !altDown
+
+	// 文本输入：Enter/Esc 和文本样式键固定，不带 Ctrl/Alt 的按键作为文字输入（由 WM_CHAR 处理）
+	if e.textInput {
+		switch {
+		case wParam == uintptr(vkReturn) && shiftDown:
+			// Shift+Enter 换行
+			e.textBuffer += "\n"
+			invalidateRect.Call(e.hwnd, 0, 0)
+		case wParam == uintptr(vkReturn):
+			e.commitText()
+		case wParam == uintptr(vkEscape):
 			e.textInput = false
 			e.textBuffer = ""
 			invalidateRect.Call(e.hwnd, 0, 0)
-		} else if e.drawing {
-			e.drawing = false
-			e.tempAnnotation = nil
-			e.freehandPts = nil
-			invalidateRect.Call(e.hwnd, 0, 0)
-		} else {
-			e.result = &EditorResult{Cancelled: true}
-			e.done = true
-			postQuitMessage.Call(0)
+		case plainCtrl && isTextStyleKey(wParam):
+			e.applyTextStyleKey(wParam)
+		case ctrlDown || altDown:
+			e.runAction(e.bindings[chord])
 		}
+		return
+	}
 
-	case wParam == uintptr(vkReturn):
-		if e.textInput {
-			e.commitText()
-		} else {
-			e.saveAndExit()
-		}
+	switch {
+	case plainCtrl && e.currentTool == ToolSelect && isTextStyleKey(wParam):
+		e.applyTextStyleKey(wParam)
+
+	case plainCtrl && wParam >= uintptr(vk1) && wParam < uintptr(vk1+9):
+		// Ctrl+1-9 应用样式预设
+		e.applyPreset(int(wParam) - vk1)
+		invalidateRect.Call(e.hwnd, 0, 0)
+
+	case wParam == vkSpace && !ctrlDown && !altDown:
+		// 按住空格拖拽平移视图
+		e.spaceDown = true
+
+	default:
+		e.runAction(e.bindings[chord])
+	}
+}
 
-	case ctrlDown && wParam == uintptr(vkZ):
-		if shiftDown {
-			e.history.Redo()
+// runAction 执行快捷键绑定的动作（动作名见 keymap.Actions）
+func (e *Editor) runAction(action string) {
+	if name, ok := strings.CutPrefix(action, "tool."); ok {
+		if t, ok := ParseTool(name); ok {
+			e.selectTool(t)
 			invalidateRect.Call(e.hwnd, 0, 0)
-		} else {
-			e.history.Undo()
+		}
+		return
+	}
+
+	switch action {
+	case "cancel":
+		e.cancel()
+
+	case "save":
+		e.saveAndExit()
+
+	case "copy":
+		e.copyAndExit()
+
+	case "undo":
+		e.undo()
+		invalidateRect.Call(e.hwnd, 0, 0)
+
+	case "redo":
+		e.redo()
+		invalidateRect.Call(e.hwnd, 0, 0)
+
+	case "color.next", "color.prev":
+		e.cycleColor(action == "color.next")
+
+	case "width.next", "width.prev":
+		e.cycleSize(action == "width.next")
+
+	case "delete":
+		// 删除选中的标注
+		if len(e.selected) > 0 && !e.textInput {
+			e.history.RemoveAnnotations(e.selected)
+			e.selected = nil
 			invalidateRect.Call(e.hwnd, 0, 0)
 		}
 
-	case ctrlDown && wParam == uintptr(vkY):
-		e.history.Redo()
+	case "paste":
+		// 粘贴图片文件
+		if !e.textInput {
+			e.pasteImage()
+		}
+
+	case "group":
+		e.applyZOrder(e.history.Group)
+
+	case "ungroup":
+		e.history.Ungroup(e.selected)
+		invalidateRect.Call(e.hwnd, 0, 0)
+
+	case "forward":
+		e.applyZOrder(e.history.BringForward)
+
+	case "front":
+		e.applyZOrder(e.history.BringToFront)
+
+	case "backward":
+		e.applyZOrder(e.history.SendBackward)
+
+	case "back":
+		e.applyZOrder(e.history.SendToBack)
+
+	case "zoom.in":
+		e.zoomAtCenter(nextZoom(e.view.zoom, 1))
+
+	case "zoom.out":
+		e.zoomAtCenter(nextZoom(e.view.zoom, -1))
+
+	case "zoom.reset":
+		// 恢复 1:1
+		e.view = viewTransform{zoom: 1}
 		invalidateRect.Call(e.hwnd, 0, 0)
+	}
+
+	if e.textInput {
+		return
+	}
 
-	case !ctrlDown && !e.textInput:
-		// 数字键 1-7 切换工具（按新顺序）
-		key := int(wParam)
-		if key >= vk1 && key < vk1+len(mainToolBtnOrder) {
-			e.currentTool = mainToolBtnOrder[key-vk1]
-			e.updateSubToolbarVisibility()
+	// 以下动作在文本输入时不可用
+	switch action {
+	case "selection.rotate", "selection.rotate.back":
+		// 旋转选中的图片（默认 R 顺时针，Shift+R 逆时针）
+		if len(e.selected) > 0 {
+			step := float64(imageRotateStep)
+			if action == "selection.rotate.back" {
+				step = -step
+			}
+			e.rotateSelected(step)
 			invalidateRect.Call(e.hwnd, 0, 0)
 		}
+
+	case "crop":
+		// 进入裁剪模式：在截图上拖拽选择保留区域
+		e.cropMode = true
+		e.selected = nil
+		invalidateRect.Call(e.hwnd, 0, 0)
+
+	case "rotate", "rotate.back":
+		// 整张截图旋转 90°（默认 T 顺时针，Shift+T 逆时针）
+		turns := 1
+		if action == "rotate.back" {
+			turns = -1
+		}
+		e.applyImageOp(func() bool { return e.history.Rotate(turns) })
+
+	case "flip.horizontal", "flip.vertical":
+		horizontal := action == "flip.horizontal"
+		e.applyImageOp(func() bool { return e.history.Flip(horizontal) })
+
+	case "pad":
+		// 以当前颜色向四周扩展画布
+		e.applyImageOp(func() bool {
+			return e.history.Pad(canvasPadSize, canvasPadSize, canvasPadSize, canvasPadSize, e.currentColor)
+		})
+	}
+}
+
+// cancel 依次退出裁剪模式、文本输入、正在绘制的标注和选择，都没有时取消编辑
+func (e *Editor) cancel() {
+	if e.cropMode {
+		if e.cropDragging {
+			releaseCapture.Call()
+		}
+		e.cropMode = false
+		e.cropDragging = false
+		invalidateRect.Call(e.hwnd, 0, 0)
+	} else if e.textInput {
+		e.textInput = false
+		e.textBuffer = ""
+		invalidateRect.Call(e.hwnd, 0, 0)
+	} else if e.drawing {
+		e.drawing = false
+		e.tempAnnotation = nil
+		e.freehandPts = nil
+		e.cancelShapeHold()
+		invalidateRect.Call(e.hwnd, 0, 0)
+	} else if len(e.selected) > 0 {
+		e.selected = nil
+		invalidateRect.Call(e.hwnd, 0, 0)
+	} else {
+		e.result = &EditorResult{Cancelled: true}
+		e.done = true
+		postQuitMessage.Call(0)
+	}
+}
+
+// cycleColor 切换到颜色面板中的下一个/上一个颜色（选择工具下同时修改选中的标注）
+func (e *Editor) cycleColor(next bool) {
+	n := len(e.palette)
+	i := 0
+	for j, c := range e.palette {
+		if c == e.currentColor {
+			i = j
+			break
+		}
+	}
+	if next {
+		i = (i + 1) % n
+	} else {
+		i = (i + n - 1) % n
+	}
+	e.currentColor = e.palette[i]
+	if e.currentTool == ToolSelect {
+		e.restyleSelected(func(a *Annotation) { a.Color = e.currentColor })
+	}
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
+
+// cycleSize 切换到下一个/上一个线宽（文本工具为字号），到两端时停止
+func (e *Editor) cycleSize(next bool) {
+	sizes := e.sizeOptions()
+	cur := &e.lineWidth
+	if e.currentTool == ToolText {
+		cur = &e.fontSize
+	}
+	// 当前值不在选项中时，取第一个大于/小于它的选项
+	i := -1
+	for j, v := range sizes {
+		if next && v > *cur {
+			i = j
+			break
+		}
+		if !next && v < *cur {
+			i = j
+		}
+	}
+	if i < 0 {
+		return
+	}
+	*cur = sizes[i]
+	if e.currentTool == ToolSelect {
+		e.restyleSelected(func(a *Annotation) {
+			if a.Type != ToolText {
+				a.LineWidth = e.lineWidth
+			}
+		})
+	}
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
+
+// isTextStyleKey 是否为文本样式快捷键
+func isTextStyleKey(key uintptr) bool {
+	switch key {
+	case vkB, vkO, vkL, vkE, vkR, vkT, vkK:
+		return true
+	}
+	return false
+}
+
+// applyTextStyleKey 处理文本样式快捷键：
+// Ctrl+B 粗体、Ctrl+O 空心字、Ctrl+L/E/R 左对齐/居中/右对齐、Ctrl+T 切换背景、Ctrl+K 自动对比色
+// 输入文本时作用于输入中的文本，选择工具下同时作用于选中的文本标注
+func (e *Editor) applyTextStyleKey(key uintptr) {
+	style := e.textStyle
+	switch key {
+	case vkB:
+		style.Bold = !style.Bold
+	case vkO:
+		style.Hollow = !style.Hollow
+	case vkL:
+		style.Align = AlignLeft
+	case vkE:
+		style.Align = AlignCenter
+	case vkR:
+		style.Align = AlignRight
+	case vkT:
+		style.Background = (style.Background + 1) % TextBgCount
+	case vkK:
+		style.AutoColor = !style.AutoColor
+	}
+	e.textStyle = style
+
+	if !e.textInput && e.currentTool == ToolSelect {
+		e.restyleSelected(func(a *Annotation) {
+			if a.Type == ToolText {
+				// 保留各自的换行宽度
+				maxWidth := a.Style.MaxWidth
+				a.Style = style
+				a.Style.MaxWidth = maxWidth
+			}
+		})
 	}
+	invalidateRect.Call(e.hwnd, 0, 0)
 }
 
 // onChar 处理字符输入（文本模式）
@@ -944,7 +1347,22 @@ func (e *Editor) onLButtonDown(mx, my int, hwnd uintptr) {
 		return
 	}
 
-	// 3. 检查是否拖拽手柄（调整选区大小）
+	// 3. 按住空格：拖拽平移视图
+	if e.spaceDown {
+		e.panning = true
+		e.panStartMouse = image.Point{X: mx, Y: my}
+		e.panStartView = e.view
+		setCapture.Call(hwnd)
+		return
+	}
+
+	// 4. 选择工具：优先处理选中标注的调整手柄
+	if hIdx := e.hitTestAnnotationHandle(mx, my); hIdx >= 0 {
+		e.beginAnnotationEdit(hIdx, mx, my, hwnd)
+		return
+	}
+
+	// 5. 检查是否拖拽手柄（调整选区大小）
 	if hIdx := e.hitTestHandle(mx, my); hIdx >= 0 {
 		e.draggingSelection = true
 		e.dragMode = hIdx + 1 // 1-8 表示手柄
@@ -954,7 +1372,7 @@ func (e *Editor) onLButtonDown(mx, my int, hwnd uintptr) {
 		return
 	}
 
-	// 4. 检查是否拖拽选区边框（移动选区）
+	// 6. 检查是否拖拽选区边框（移动选区）
 	if e.isOnSelectionBorder(mx, my) {
 		e.draggingSelection = true
 		e.dragMode = 0 // 0 表示移动
@@ -964,33 +1382,54 @@ func (e *Editor) onLButtonDown(mx, my int, hwnd uintptr) {
 		return
 	}
 
-	// 5. 否则处理画布绘制
+	// 7. 否则处理画布绘制
 	// 如果在文本输入模式，先提交当前文本
 	if e.textInput {
 		e.commitText()
 	}
 
-	// 转换为画布坐标
+	// 转换为画布坐标（放大时选区以外的画布不可见，不响应）
 	cx, cy := e.screenToCanvas(mx, my)
-	if !e.isInCanvas(cx, cy) {
+	if !e.isInCanvas(cx, cy) || !image.Pt(mx, my).In(e.imageRect) {
+		return
+	}
+
+	if e.cropMode {
+		// 裁剪模式：开始拖拽裁剪区域
+		e.cropDragging = true
+		e.cropStart = image.Point{X: cx, Y: cy}
+		e.cropEnd = e.cropStart
+		setCapture.Call(hwnd)
+		return
+	}
+
+	if e.currentTool == ToolSelect {
+		// 选择工具：点中标注则选中并开始移动，否则取消选择；按住 Shift 加选/减选
+		shiftState, _, _ := getKeyState.Call(uintptr(vkShift))
+		if e.selectAt(mx, my, int16(shiftState) < 0) {
+			e.beginAnnotationEdit(-1, mx, my, hwnd)
+		}
+		invalidateRect.Call(e.hwnd, 0, 0)
 		return
 	}
 
 	if e.currentTool == ToolText {
 		e.textInput = true
 		e.textBuffer = ""
-		e.textPos = image.Point{X: cx, Y: cy}
+		e.textPos = e.snapDrawPoint(image.Point{X: cx, Y: cy}, false)
+		e.snapGuides = nil
 		invalidateRect.Call(e.hwnd, 0, 0)
 		return
 	}
 
 	// 开始绘制
 	e.drawing = true
-	e.startPt = image.Point{X: cx, Y: cy}
+	e.startPt = e.snapDrawPoint(image.Point{X: cx, Y: cy}, false)
 	e.currentPt = e.startPt
 
 	if e.currentTool == ToolFreehand {
 		e.freehandPts = []image.Point{e.startPt}
+		e.restartShapeHold(e.startPt)
 	}
 
 	e.updateTempAnnotation()
@@ -1022,6 +1461,16 @@ func (e *Editor) invalidateToolbarArea() {
 
 // onMouseMove 处理鼠标移动
 func (e *Editor) onMouseMove(mx, my int) {
+	// 处理视图平移
+	if e.panning {
+		v := e.panStartView
+		v.ox -= float64(mx-e.panStartMouse.X) / v.zoom
+		v.oy -= float64(my-e.panStartMouse.Y) / v.zoom
+		e.view = v.clamp(e.background.Bounds().Size(), e.imageRect.Size())
+		invalidateRect.Call(e.hwnd, 0, 0)
+		return
+	}
+
 	// 处理选区拖拽（移动/调整大小）
 	if e.draggingSelection {
 		dx := mx - e.dragStartMouse.X
@@ -1031,6 +1480,21 @@ func (e *Editor) onMouseMove(mx, my int) {
 		return
 	}
 
+	// 处理裁剪区域拖拽
+	if e.cropDragging {
+		cx, cy := e.screenToCanvas(mx, my)
+		e.cropEnd = image.Point{X: cx, Y: cy}
+		invalidateRect.Call(e.hwnd, 0, 0)
+		return
+	}
+
+	// 处理标注拖拽（移动/缩放）
+	if e.editingAnn {
+		e.updateAnnotationEdit(mx, my)
+		invalidateRect.Call(e.hwnd, 0, 0)
+		return
+	}
+
 	// 更新主工具栏悬停状态
 	oldHover := e.hoverBtnIndex
 	oldSubHover := e.hoverSubIndex
@@ -1066,9 +1530,13 @@ func (e *Editor) onMouseMove(mx, my int) {
 	}
 
 	cx, cy := e.screenToCanvas(mx, my)
-	e.currentPt = image.Point{X: cx, Y: cy}
+	e.currentPt = e.snapDrawPoint(image.Point{X: cx, Y: cy}, true)
 
 	if e.currentTool == ToolFreehand {
+		// 画笔仍在移动：取消已识别的图形，重新计时
+		if abs(e.currentPt.X-e.holdPt.X) > shapeHoldMoveTol || abs(e.currentPt.Y-e.holdPt.Y) > shapeHoldMoveTol {
+			e.restartShapeHold(e.currentPt)
+		}
 		e.freehandPts = append(e.freehandPts, e.currentPt)
 	}
 
@@ -1078,6 +1546,13 @@ func (e *Editor) onMouseMove(mx, my int) {
 
 // onLButtonUp 处理鼠标左键释放
 func (e *Editor) onLButtonUp(mx, my int) {
+	// 结束视图平移
+	if e.panning {
+		releaseCapture.Call()
+		e.panning = false
+		return
+	}
+
 	// 结束选区拖拽
 	if e.draggingSelection {
 		releaseCapture.Call()
@@ -1089,6 +1564,32 @@ func (e *Editor) onLButtonUp(mx, my int) {
 		return
 	}
 
+	// 结束裁剪区域拖拽，执行裁剪
+	if e.cropDragging {
+		releaseCapture.Call()
+		e.cropDragging = false
+		e.cropMode = false
+		r := e.cropRect()
+		if r.Dx() >= annotationMinSize && r.Dy() >= annotationMinSize {
+			e.applyImageOp(func() bool { return e.history.Crop(r) })
+		}
+		invalidateRect.Call(e.hwnd, 0, 0)
+		return
+	}
+
+	// 结束标注拖拽，记录为一次可撤销的修改
+	if e.editingAnn {
+		releaseCapture.Call()
+		e.editingAnn = false
+		e.snapGuides = nil
+		if e.editPreview != nil {
+			e.history.ModifyAnnotations(e.selected, e.editPreview)
+			e.editPreview = nil
+		}
+		invalidateRect.Call(e.hwnd, 0, 0)
+		return
+	}
+
 	if !e.drawing {
 		return
 	}
@@ -1097,7 +1598,19 @@ func (e *Editor) onLButtonUp(mx, my int) {
 	e.drawing = false
 
 	cx, cy := e.screenToCanvas(mx, my)
-	e.currentPt = image.Point{X: cx, Y: cy}
+	e.currentPt = e.snapDrawPoint(image.Point{X: cx, Y: cy}, true)
+	e.snapGuides = nil
+
+	// 画笔停顿后已识别为规则图形：用规则图形替换笔迹
+	if hint := e.shapeHint; hint != nil {
+		e.cancelShapeHold()
+		e.history.AddAnnotation(*hint)
+		e.tempAnnotation = nil
+		e.freehandPts = nil
+		invalidateRect.Call(e.hwnd, 0, 0)
+		return
+	}
+	e.cancelShapeHold()
 
 	if e.currentTool == ToolFreehand {
 		e.freehandPts = append(e.freehandPts, e.currentPt)
@@ -1110,6 +1623,9 @@ func (e *Editor) onLButtonUp(mx, my int) {
 			if len(e.freehandPts) > 2 {
 				e.history.AddAnnotation(*e.tempAnnotation)
 			}
+		} else if e.currentTool == ToolImage {
+			// 图章单击即可放置
+			e.history.AddAnnotation(*e.tempAnnotation)
 		} else {
 			dx := e.currentPt.X - e.startPt.X
 			dy := e.currentPt.Y - e.startPt.Y
@@ -1213,11 +1729,28 @@ func (e *Editor) getSubToolbarButtons() []toolbarButton {
 
 	x := baseX
 
-	// 线宽选择 (3个)
-	for _, lw := range subToolbarLineWidths {
+	// 图章工具: 图章选择
+	if e.currentTool == ToolImage {
+		for st := StampCheck; st < StampCount; st++ {
+			buttons = append(buttons, toolbarButton{
+				x: x, y: baseY, w: subColorSize, h: subColorSize,
+				kind:  "stamp",
+				stamp: st,
+			})
+			x += subColorSize + subLineWidthGap
+		}
+		return buttons
+	}
+
+	// 线宽选择（文本工具为字号选择）
+	kind := "linewidth"
+	if e.currentTool == ToolText {
+		kind = "fontsize"
+	}
+	for _, lw := range e.sizeOptions() {
 		buttons = append(buttons, toolbarButton{
 			x: x, y: baseY, w: subColorSize, h: subColorSize,
-			kind:      "linewidth",
+			kind:      kind,
 			lineWidth: lw,
 		})
 		x += subColorSize + subLineWidthGap
@@ -1226,8 +1759,8 @@ func (e *Editor) getSubToolbarButtons() []toolbarButton {
 	// 分隔符
 	x += toolbarSepWidth - subLineWidthGap
 
-	// 颜色选择 (8个)
-	for i := range DefaultColors {
+	// 颜色选择
+	for i := range e.palette {
 		buttons = append(buttons, toolbarButton{
 			x: x, y: baseY, w: subColorSize, h: subColorSize,
 			kind:       "color",
@@ -1236,6 +1769,19 @@ func (e *Editor) getSubToolbarButtons() []toolbarButton {
 		x += subColorSize + subColorGap
 	}
 
+	// 分隔符
+	x += toolbarSepWidth - subColorGap
+
+	// 轮廓开关、不透明度切换
+	for _, action := range []string{"outline", "opacity"} {
+		buttons = append(buttons, toolbarButton{
+			x: x, y: baseY, w: subColorSize, h: subColorSize,
+			kind:   "style",
+			action: action,
+		})
+		x += subColorSize + subLineWidthGap
+	}
+
 	return buttons
 }
 
@@ -1253,14 +1799,13 @@ func (e *Editor) handleMainToolbarClick(mx, my int) {
 				if e.textInput {
 					e.commitText()
 				}
-				e.currentTool = btn.toolType
-				e.updateSubToolbarVisibility()
+				e.selectTool(btn.toolType)
 			case "action":
 				switch btn.action {
 				case "undo":
-					e.history.Undo()
+					e.undo()
 				case "redo":
-					e.history.Redo()
+					e.redo()
 				case "save":
 					e.saveAndExit()
 					return
@@ -1285,10 +1830,24 @@ func (e *Editor) handleSubToolbarClick(mx, my int) {
 			switch btn.kind {
 			case "linewidth":
 				e.lineWidth = btn.lineWidth
+				// 选择工具：同时修改选中标注的线宽
+				if e.currentTool == ToolSelect {
+					e.restyleSelected(func(a *Annotation) { a.LineWidth = btn.lineWidth })
+				}
+			case "fontsize":
+				e.fontSize = btn.lineWidth
 			case "color":
-				if btn.colorIndex >= 0 && btn.colorIndex < len(DefaultColors) {
-					e.currentColor = DefaultColors[btn.colorIndex]
+				if btn.colorIndex >= 0 && btn.colorIndex < len(e.palette) {
+					e.currentColor = e.palette[btn.colorIndex]
+					// 选择工具：同时修改选中标注的颜色
+					if e.currentTool == ToolSelect {
+						e.restyleSelected(func(a *Annotation) { a.Color = e.currentColor })
+					}
 				}
+			case "style":
+				e.toggleStyle(btn.action)
+			case "stamp":
+				e.stamp = btn.stamp
 			}
 			invalidateRect.Call(e.hwnd, 0, 0)
 			return
@@ -1300,14 +1859,37 @@ func (e *Editor) handleSubToolbarClick(mx, my int) {
 // 坐标转换
 // ============================================================================
 
-// screenToCanvas 屏幕坐标转画布坐标
+// screenToCanvas 屏幕坐标转画布坐标（考虑视图缩放和平移）
 func (e *Editor) screenToCanvas(sx, sy int) (int, int) {
-	return sx - e.imageRect.Min.X, sy - e.imageRect.Min.Y
+	p := e.view.canvasPixel(sx-e.imageRect.Min.X, sy-e.imageRect.Min.Y)
+	return p.X, p.Y
 }
 
-// canvasToScreen 画布坐标转屏幕坐标
+// canvasToScreen 画布坐标转屏幕坐标（考虑视图缩放和平移）
 func (e *Editor) canvasToScreen(cx, cy int) (int, int) {
-	return cx + e.imageRect.Min.X, cy + e.imageRect.Min.Y
+	p := e.view.viewPixel(cx, cy).Add(e.imageRect.Min)
+	return p.X, p.Y
+}
+
+// zoomAt 以屏幕点 (sx, sy) 为中心缩放视图
+func (e *Editor) zoomAt(zoom float64, sx, sy int) {
+	if e.draggingSelection || zoom == e.view.zoom {
+		return
+	}
+	v := e.view.zoomAt(zoom, float64(sx-e.imageRect.Min.X), float64(sy-e.imageRect.Min.Y))
+	e.view = v.clamp(e.background.Bounds().Size(), e.imageRect.Size())
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
+
+// zoomAtCenter 以选区中心为中心缩放视图
+func (e *Editor) zoomAtCenter(zoom float64) {
+	c := e.imageRect.Min.Add(e.imageRect.Max).Div(2)
+	e.zoomAt(zoom, c.X, c.Y)
+}
+
+// hitTolerance 标注命中容差（画布像素），放大时相应缩小，保持屏幕上的命中范围不变
+func (e *Editor) hitTolerance() int {
+	return max(1, int(math.Round(annotationHitTol/e.view.zoom)))
 }
 
 // isInCanvas 检查画布坐标是否在截图范围内
@@ -1326,7 +1908,20 @@ const handleHitSize = 8 // 手柄命中区域半径（像素）
 // hitTestHandle 检测鼠标是否在某个调整手柄上，返回 0-7 或 -1
 // 0=左上, 1=上中, 2=右上, 3=右中, 4=右下, 5=下中, 6=左下, 7=左中
 func (e *Editor) hitTestHandle(mx, my int) int {
-	r := e.imageRect
+	if e.selectionLocked() {
+		return -1
+	}
+	return hitTestRectHandles(e.imageRect, mx, my)
+}
+
+// selectionLocked 底图经过裁剪/旋转等操作后不再对应全屏截图中的选区，禁止移动和调整选区；
+// 视图缩放或平移时选区显示的不是 1:1 的截图，同样禁止
+func (e *Editor) selectionLocked() bool {
+	return e.history.ImageOps() > 0 || !e.view.identity()
+}
+
+// hitTestRectHandles 检测鼠标是否在矩形 r 的某个调整手柄上，返回 0-7 或 -1
+func hitTestRectHandles(r image.Rectangle, mx, my int) int {
 	midX := (r.Min.X + r.Max.X) / 2
 	midY := (r.Min.Y + r.Max.Y) / 2
 
@@ -1352,6 +1947,9 @@ func (e *Editor) hitTestHandle(mx, my int) int {
 
 // isOnSelectionBorder 检测鼠标是否在选区边框上
 func (e *Editor) isOnSelectionBorder(mx, my int) bool {
+	if e.selectionLocked() {
+		return false
+	}
 	r := e.imageRect
 	outer := image.Rect(r.Min.X-borderHitSize, r.Min.Y-borderHitSize,
 		r.Max.X+borderHitSize, r.Max.Y+borderHitSize)
@@ -1461,44 +2059,511 @@ func (e *Editor) updateSelectionCrop() {
 		dstOff := y * e.background.Stride
 		copy(e.background.Pix[dstOff:dstOff+selW*4], e.fullscreen.Pix[srcOff:srcOff+selW*4])
 	}
+	e.history.SetImage(e.background)
 }
 
-// ============================================================================
-// 标注逻辑
-// ============================================================================
+// applyImageOp 执行图片操作（裁剪/旋转/翻转/扩展画布），成功后同步显示
+func (e *Editor) applyImageOp(op func() bool) {
+	if e.textInput {
+		e.commitText()
+	}
+	if op() {
+		e.selected = nil
+		e.syncImage()
+	}
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
 
-// updateTempAnnotation 更新临时标注（预览用）
-func (e *Editor) updateTempAnnotation() {
-	a := &Annotation{
-		Type:      e.currentTool,
-		Color:     e.currentColor,
-		LineWidth: e.lineWidth,
-		FontSize:  e.fontSize,
-		MosaicPx:  12,
+// syncImage 底图被图片操作替换后（包括撤销/重做），同步显示区域和工具栏位置
+func (e *Editor) syncImage() {
+	img := e.history.Image()
+	if img == nil || img == e.background {
+		return
 	}
+	e.background = img
 
-	switch e.currentTool {
-	case ToolFreehand:
-		a.Points = make([]image.Point, len(e.freehandPts))
-		copy(a.Points, e.freehandPts)
-	default:
-		a.Points = []image.Point{e.startPt, e.currentPt}
+	// 保持左上角不变，超出屏幕时尽量移回屏幕内
+	r := image.Rectangle{Min: e.imageRect.Min, Max: e.imageRect.Min.Add(img.Bounds().Size())}
+	if over := r.Max.X - e.screenWidth; over > 0 {
+		r = r.Sub(image.Pt(min(over, r.Min.X), 0))
+	}
+	if over := r.Max.Y - e.screenHeight; over > 0 {
+		r = r.Sub(image.Pt(0, min(over, r.Min.Y)))
 	}
+	e.imageRect = r
+	e.view = e.view.clamp(img.Bounds().Size(), r.Size())
+	e.calculateToolbarPosition()
+}
 
-	e.tempAnnotation = a
+// cropRect 当前拖拽的裁剪区域（画布坐标，限制在底图范围内）
+func (e *Editor) cropRect() image.Rectangle {
+	return canonicalRect(e.cropStart, e.cropEnd).Intersect(e.background.Bounds())
 }
 
-// commitText 提交文本输入
-func (e *Editor) commitText() {
-	if e.textBuffer != "" {
-		a := Annotation{
-			Type:     ToolText,
-			Points:   []image.Point{e.textPos},
-			Color:    e.currentColor,
-			FontSize: e.fontSize,
-			Text:     e.textBuffer,
+// ============================================================================
+// 标注选择（移动/缩放/修改已有标注）
+// ============================================================================
+
+// selectTool 切换当前工具（离开选择工具时取消选择）
+func (e *Editor) selectTool(t ToolType) {
+	e.currentTool = t
+	if t != ToolSelect {
+		e.selected = nil
+	}
+	e.updateSubToolbarVisibility()
+	e.calculateSubToolbarPosition()
+}
+
+// undo 撤销（标注索引可能失效，取消选择）
+func (e *Editor) undo() {
+	e.history.Undo()
+	e.selected = nil
+	e.syncImage()
+}
+
+// redo 重做（标注索引可能失效，取消选择）
+func (e *Editor) redo() {
+	e.history.Redo()
+	e.selected = nil
+	e.syncImage()
+}
+
+// annotationAt 返回屏幕坐标处最上层标注的索引，未命中返回 -1
+func (e *Editor) annotationAt(mx, my int) int {
+	cx, cy := e.screenToCanvas(mx, my)
+	annotations := e.history.GetAnnotations()
+	// 按绘制顺序从上到下检测
+	order := drawOrder(annotations)
+	for k := len(order) - 1; k >= 0; k-- {
+		if annotations[order[k]].Contains(image.Point{X: cx, Y: cy}, e.hitTolerance()) {
+			return order[k]
+		}
+	}
+	return -1
+}
+
+// selectAt 选中屏幕坐标处的标注（连同其分组）；toggle 为真时加入/移出当前选择
+// 返回是否点中了标注
+func (e *Editor) selectAt(mx, my int, toggle bool) bool {
+	i := e.annotationAt(mx, my)
+	if i < 0 {
+		if !toggle {
+			e.selected = nil
+		}
+		return false
+	}
+
+	unit := e.history.GroupMembers(i)
+	if !toggle {
+		if !e.isSelected(i) {
+			e.selected = unit
+		}
+		return true
+	}
+
+	if e.isSelected(i) {
+		// 移出选择
+		var kept []int
+		for _, j := range e.selected {
+			if !containsIndex(unit, j) {
+				kept = append(kept, j)
+			}
+		}
+		e.selected = kept
+		return false
+	}
+	e.selected = uniqueSorted(append(e.selected, unit...))
+	return true
+}
+
+// isSelected 索引 i 处的标注是否被选中
+func (e *Editor) isSelected(i int) bool {
+	return containsIndex(e.selected, i)
+}
+
+// containsIndex 索引列表中是否包含 i
+func containsIndex(indices []int, i int) bool {
+	for _, j := range indices {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedAnnotations 返回当前选中的标注（拖拽中返回预览）
+func (e *Editor) selectedAnnotations() []Annotation {
+	if e.editPreview != nil {
+		return e.editPreview
+	}
+	annotations := e.history.GetAnnotations()
+	result := make([]Annotation, 0, len(e.selected))
+	for _, i := range e.selected {
+		if i >= 0 && i < len(annotations) {
+			result = append(result, annotations[i])
 		}
-		e.history.AddAnnotation(a)
+	}
+	return result
+}
+
+// selectedBounds 返回选中标注的联合边界（画布坐标）
+func (e *Editor) selectedBounds() (image.Rectangle, bool) {
+	var r image.Rectangle
+	anns := e.selectedAnnotations()
+	for i := range anns {
+		r = r.Union(anns[i].Bounds())
+	}
+	return r, len(anns) > 0
+}
+
+// selectedScreenRect 返回选中标注在屏幕上的联合边界
+func (e *Editor) selectedScreenRect() (image.Rectangle, bool) {
+	b, ok := e.selectedBounds()
+	if !ok {
+		return image.Rectangle{}, false
+	}
+	x0, y0 := e.canvasToScreen(b.Min.X, b.Min.Y)
+	x1, y1 := e.canvasToScreen(b.Max.X, b.Max.Y)
+	return image.Rect(x0, y0, x1, y1), true
+}
+
+// hitTestAnnotationHandle 检测鼠标是否在选中标注的调整手柄上，返回 0-7 或 -1
+func (e *Editor) hitTestAnnotationHandle(mx, my int) int {
+	if e.currentTool != ToolSelect {
+		return -1
+	}
+	r, ok := e.selectedScreenRect()
+	if !ok {
+		return -1
+	}
+	return hitTestRectHandles(r, mx, my)
+}
+
+// beginAnnotationEdit 开始拖拽选中的标注（handle=-1 为移动，0-7 为调整手柄）
+func (e *Editor) beginAnnotationEdit(handle, mx, my int, hwnd uintptr) {
+	b, ok := e.selectedBounds()
+	if !ok {
+		return
+	}
+	cx, cy := e.screenToCanvas(mx, my)
+	e.editingAnn = true
+	e.editHandle = handle
+	e.editStartPt = image.Point{X: cx, Y: cy}
+	e.editStartRect = b
+	e.editPreview = nil
+	setCapture.Call(hwnd)
+}
+
+// updateAnnotationEdit 根据鼠标位置更新拖拽中的标注预览
+func (e *Editor) updateAnnotationEdit(mx, my int) {
+	cx, cy := e.screenToCanvas(mx, my)
+	dx := cx - e.editStartPt.X
+	dy := cy - e.editStartPt.Y
+	e.snapGuides = nil
+	if snapActive() {
+		dx, dy = e.snapEditDelta(dx, dy)
+	}
+	if dx == 0 && dy == 0 {
+		e.editPreview = nil
+		return
+	}
+
+	annotations := e.history.GetAnnotations()
+	target := resizeByHandle(e.editStartRect, e.editHandle, dx, dy)
+	preview := make([]Annotation, 0, len(e.selected))
+	for _, i := range e.selected {
+		a := annotations[i].Clone()
+		if e.editHandle < 0 {
+			a.Translate(dx, dy)
+		} else {
+			a.Resize(e.editStartRect, target)
+		}
+		preview = append(preview, a)
+	}
+	e.editPreview = preview
+}
+
+// restyleSelected 修改所有选中标注的颜色或线宽（作为一次撤销步骤）
+func (e *Editor) restyleSelected(restyle func(a *Annotation)) {
+	if len(e.selected) == 0 {
+		return
+	}
+	anns := e.selectedAnnotations()
+	for i := range anns {
+		restyle(&anns[i])
+	}
+	e.history.ModifyAnnotations(e.selected, anns)
+}
+
+// applyZOrder 对选中标注执行 z 序/分组操作并更新选择
+func (e *Editor) applyZOrder(op func(indices []int) []int) {
+	if len(e.selected) == 0 {
+		return
+	}
+	e.selected = op(e.selected)
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
+
+// snapEditDelta 吸附拖拽偏移：移动时对齐整个边界，调整大小时对齐被拖动的手柄
+func (e *Editor) snapEditDelta(dx, dy int) (int, int) {
+	annotations := e.history.GetAnnotations()
+	if e.editHandle < 0 {
+		off, guides := SnapRect(e.editStartRect.Add(image.Pt(dx, dy)), annotations, e.selected, e.snap)
+		e.snapGuides = guides
+		return dx + off.X, dy + off.Y
+	}
+
+	p, movesX, movesY := handlePoint(e.editStartRect, e.editHandle)
+	p = p.Add(image.Pt(dx, dy))
+	q, guides := SnapPoint(p, annotations, e.selected, e.snap)
+	// 只保留手柄实际移动方向上的吸附
+	for _, g := range guides {
+		if (g.Vertical && movesX) || (!g.Vertical && movesY) {
+			e.snapGuides = append(e.snapGuides, g)
+		}
+	}
+	if movesX {
+		dx += q.X - p.X
+	}
+	if movesY {
+		dy += q.Y - p.Y
+	}
+	return dx, dy
+}
+
+// handlePoint 手柄在矩形上的位置（索引与 hitTestRectHandles 相同），以及手柄是否沿 x/y 方向移动
+func handlePoint(r image.Rectangle, handle int) (p image.Point, movesX, movesY bool) {
+	p = image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+	switch handle {
+	case 0, 6, 7:
+		p.X, movesX = r.Min.X, true
+	case 2, 3, 4:
+		p.X, movesX = r.Max.X, true
+	}
+	switch handle {
+	case 0, 1, 2:
+		p.Y, movesY = r.Min.Y, true
+	case 4, 5, 6:
+		p.Y, movesY = r.Max.Y, true
+	}
+	return p, movesX, movesY
+}
+
+// snapActive 是否按住了吸附修饰键（Alt）
+func snapActive() bool {
+	state, _, _ := getKeyState.Call(uintptr(vkMenu))
+	return int16(state) < 0
+}
+
+// snapDrawPoint 按住 Alt 时吸附绘制点：直线/箭头/测量的终点吸附到 0°/45°/90°，
+// 其余吸附到其他标注的边缘/中心或网格（画笔不吸附）
+func (e *Editor) snapDrawPoint(p image.Point, end bool) image.Point {
+	e.snapGuides = nil
+	if !snapActive() || e.currentTool == ToolFreehand {
+		return p
+	}
+	switch e.currentTool {
+	case ToolLine, ToolArrow, ToolMeasure:
+		if end {
+			return SnapAngle(e.startPt, p)
+		}
+	}
+	p, e.snapGuides = SnapPoint(p, e.history.GetAnnotations(), nil, e.snap)
+	return p
+}
+
+// resizeByHandle 按手柄索引（与 hitTestRectHandles 相同）调整矩形的对应边
+func resizeByHandle(r image.Rectangle, handle, dx, dy int) image.Rectangle {
+	movesMinX := handle == 0 || handle == 6 || handle == 7
+	movesMinY := handle == 0 || handle == 1 || handle == 2
+	movesMaxX := handle == 2 || handle == 3 || handle == 4
+	movesMaxY := handle == 4 || handle == 5 || handle == 6
+
+	if movesMinX {
+		r.Min.X = min(r.Min.X+dx, r.Max.X-annotationMinSize)
+	}
+	if movesMaxX {
+		r.Max.X = max(r.Max.X+dx, r.Min.X+annotationMinSize)
+	}
+	if movesMinY {
+		r.Min.Y = min(r.Min.Y+dy, r.Max.Y-annotationMinSize)
+	}
+	if movesMaxY {
+		r.Max.Y = max(r.Max.Y+dy, r.Min.Y+annotationMinSize)
+	}
+	return r
+}
+
+// ============================================================================
+// 标注逻辑
+// ============================================================================
+
+// updateTempAnnotation 更新临时标注（预览用）
+func (e *Editor) updateTempAnnotation() {
+	a := &Annotation{
+		Type:      e.currentTool,
+		Color:     e.currentColor,
+		LineWidth: e.lineWidth,
+		FontSize:  e.fontSize,
+		MosaicPx:  12,
+	}
+	e.applyStyle(a)
+
+	switch e.currentTool {
+	case ToolFreehand:
+		// 已识别出规则图形时预览规则图形
+		if e.shapeHint != nil {
+			e.tempAnnotation = e.shapeHint
+			return
+		}
+		a.Points = make([]image.Point, len(e.freehandPts))
+		copy(a.Points, e.freehandPts)
+	case ToolImage:
+		a.Stamp = e.stamp
+		a.Points = stampRect(e.startPt, e.currentPt)
+	case ToolMeasure:
+		a.ScaleFactor = e.scaleFactor
+		a.Points = []image.Point{e.startPt, e.currentPt}
+	default:
+		a.Points = []image.Point{e.startPt, e.currentPt}
+	}
+
+	e.tempAnnotation = a
+}
+
+// stampRect 根据拖拽起止点计算图章的正方形区域（单击时以默认尺寸居中放置）
+func stampRect(start, end image.Point) []image.Point {
+	dx := end.X - start.X
+	dy := end.Y - start.Y
+	size := max(abs(dx), abs(dy))
+	if size < stampDefaultSize/4 {
+		half := stampDefaultSize / 2
+		return []image.Point{
+			{X: start.X - half, Y: start.Y - half},
+			{X: start.X + half, Y: start.Y + half},
+		}
+	}
+	// 保持宽高相等，朝拖拽方向展开
+	sx, sy := size, size
+	if dx < 0 {
+		sx = -size
+	}
+	if dy < 0 {
+		sy = -size
+	}
+	return []image.Point{start, {X: start.X + sx, Y: start.Y + sy}}
+}
+
+// rotateSelected 旋转选中的图片标注
+func (e *Editor) rotateSelected(deg float64) {
+	e.restyleSelected(func(a *Annotation) {
+		if a.Type == ToolImage {
+			a.Rotation = math.Mod(a.Rotation+deg+360, 360)
+		}
+	})
+}
+
+// pasteImage 粘贴剪贴板中的图片文件路径，作为图片标注放在截图中央
+func (e *Editor) pasteImage() {
+	text, err := clipboard.NewClipboard().GetText()
+	if err != nil {
+		return
+	}
+	path := strings.Trim(strings.TrimSpace(text), "\"")
+	if path == "" {
+		return
+	}
+	src := loadImageFile(path)
+	if src == nil {
+		return
+	}
+
+	// 按比例缩小到不超过截图宽高的一半
+	b := e.background.Bounds()
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	maxW, maxH := b.Dx()/pasteImageMaxFrac, b.Dy()/pasteImageMaxFrac
+	if w > maxW || h > maxH {
+		scale := math.Min(float64(maxW)/float64(w), float64(maxH)/float64(h))
+		w = max(1, int(float64(w)*scale))
+		h = max(1, int(float64(h)*scale))
+	}
+	cx := (b.Min.X + b.Max.X) / 2
+	cy := (b.Min.Y + b.Max.Y) / 2
+
+	a := Annotation{
+		Type:      ToolImage,
+		Points:    []image.Point{{X: cx - w/2, Y: cy - h/2}, {X: cx - w/2 + w, Y: cy - h/2 + h}},
+		ImagePath: path,
+	}
+	e.applyStyle(&a)
+	e.history.AddAnnotation(a)
+
+	// 切换到选择工具并选中新图片，便于立即调整位置和大小
+	e.selectTool(ToolSelect)
+	e.selected = []int{len(e.history.GetAnnotations()) - 1}
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
+
+// restartShapeHold 画笔移动后重新开始停顿计时，并放弃已识别的图形
+func (e *Editor) restartShapeHold(pt image.Point) {
+	e.holdPt = pt
+	e.shapeHint = nil
+	setTimer.Call(e.hwnd, timerShapeHold, shapeHoldDelayMs, 0)
+}
+
+// cancelShapeHold 停止停顿计时并清除识别结果
+func (e *Editor) cancelShapeHold() {
+	killTimer.Call(e.hwnd, timerShapeHold)
+	e.shapeHint = nil
+}
+
+// onShapeHold 画笔停顿：尝试把当前笔迹识别为规则图形
+func (e *Editor) onShapeHold() {
+	killTimer.Call(e.hwnd, timerShapeHold)
+	if !e.drawing || e.currentTool != ToolFreehand {
+		return
+	}
+
+	tool, pts, ok := RecognizeShape(e.freehandPts)
+	if !ok {
+		return
+	}
+	e.shapeHint = &Annotation{
+		Type:      tool,
+		Points:    pts,
+		Color:     e.currentColor,
+		LineWidth: e.lineWidth,
+	}
+	e.applyStyle(e.shapeHint)
+	e.tempAnnotation = e.shapeHint
+	invalidateRect.Call(e.hwnd, 0, 0)
+}
+
+// textAnnotation 根据当前输入构造文本标注
+func (e *Editor) textAnnotation() Annotation {
+	a := Annotation{
+		Type:     ToolText,
+		Points:   []image.Point{e.textPos},
+		Color:    e.currentColor,
+		FontSize: e.fontSize,
+		Text:     e.textBuffer,
+		Style:    e.textStyle,
+	}
+	e.applyStyle(&a)
+
+	// 未指定行宽时在截图右边缘处自动换行
+	if a.Style.MaxWidth == 0 {
+		if avail := e.background.Bounds().Max.X - e.textPos.X - textPadding; avail > 0 {
+			a.Style.MaxWidth = avail
+		}
+	}
+	return a
+}
+
+// commitText 提交文本输入
+func (e *Editor) commitText() {
+	if e.textBuffer != "" {
+		e.history.AddAnnotation(e.textAnnotation())
 	}
 	e.textInput = false
 	e.textBuffer = ""
@@ -1507,6 +2572,16 @@ func (e *Editor) commitText() {
 
 // saveAndExit 保存标注结果并退出
 func (e *Editor) saveAndExit() {
+	e.finish(false)
+}
+
+// copyAndExit 将标注结果复制到剪贴板并退出（不保存文件）
+func (e *Editor) copyAndExit() {
+	e.finish(true)
+}
+
+// finish 渲染最终图片并结束编辑
+func (e *Editor) finish(copyOnly bool) {
 	if e.textInput {
 		e.commitText()
 	}
@@ -1522,8 +2597,12 @@ func (e *Editor) saveAndExit() {
 	}
 
 	e.result = &EditorResult{
-		Image:     finalImg,
-		Cancelled: false,
+		Image:       finalImg,
+		Annotations: annotations,
+		Selection:   e.imageRect.Intersect(e.fullscreen.Bounds()),
+		Transform:   e.history.ImageTransform(),
+		Cancelled:   false,
+		CopyOnly:    copyOnly,
 	}
 	e.done = true
 	postQuitMessage.Call(0)
@@ -1561,6 +2640,9 @@ func (e *Editor) onPaint(hdc uintptr) {
 	// 4. 在离屏缓冲区绘制所有 GDI/GDI+ 元素（避免闪烁）
 	e.drawSelectionBorder(e.memDC)
 	e.drawResizeHandles(e.memDC)
+	e.drawAnnotationSelection(e.memDC)
+	e.drawCropRect(e.memDC)
+	e.drawSnapGuides(e.memDC)
 	e.drawSizeIndicator(e.memDC)
 	e.drawToolbar(e.memDC)
 
@@ -1654,6 +2736,14 @@ func (e *Editor) drawAnnotationsToBuffer(pixels []byte, stride int) {
 
 	annotations := e.history.GetAnnotations()
 
+	// 拖拽标注时用预览替换原标注
+	if e.editPreview != nil {
+		annotations = append([]Annotation(nil), annotations...)
+		for k, i := range e.selected {
+			annotations[i] = e.editPreview[k]
+		}
+	}
+
 	bg := e.background
 	b := bg.Bounds()
 
@@ -1670,6 +2760,19 @@ func (e *Editor) drawAnnotationsToBuffer(pixels []byte, stride int) {
 		RenderSingleAnnotation(canvas, e.tempAnnotation)
 	}
 
+	// 渲染输入中的文本
+	if e.textInput && e.textBuffer != "" {
+		a := e.textAnnotation()
+		RenderSingleAnnotation(canvas, &a)
+	}
+
+	// 视图已缩放或平移：按视图变换采样到选区内
+	if !e.view.identity() {
+		dst := e.imageRect.Intersect(image.Rect(0, 0, e.screenWidth, e.screenHeight))
+		renderView(canvas, pixels, stride, dst, e.imageRect.Min, e.view, colorViewBackground)
+		return
+	}
+
 	// 将渲染结果复制到像素缓冲区的 imageRect 位置
 	imgW := b.Dx()
 	imgH := b.Dy()
@@ -1702,10 +2805,13 @@ func (e *Editor) drawTextCursor(pixels []byte, stride int) {
 		return
 	}
 
-	sx, sy := e.canvasToScreen(e.textPos.X, e.textPos.Y)
-	textWidthPx := int(float64(len([]rune(e.textBuffer))) * float64(e.fontSize) * 0.6)
-	cursorX := sx + textWidthPx
-	cursorH := e.fontSize + 4
+	// 光标位于最后一行末尾
+	a := e.textAnnotation()
+	l := layoutText(&a)
+	last := len(l.lines) - 1
+	sx, sy := e.canvasToScreen(e.textPos.X+l.offsets[last]+utf8.RuneCountInString(l.lines[last])*l.advance, e.textPos.Y+last*l.charH)
+	cursorX := sx
+	cursorH := int(float64(e.fontSize+4) * e.view.zoom)
 
 	for cy := sy; cy < sy+cursorH && cy < e.screenHeight; cy++ {
 		if cy < 0 {
@@ -1744,6 +2850,9 @@ func (e *Editor) drawSelectionBorder(hdc uintptr) {
 
 // drawResizeHandles 绘制选区的8个绿色调整手柄（四角+四边中点）
 func (e *Editor) drawResizeHandles(hdc uintptr) {
+	if e.selectionLocked() {
+		return
+	}
 	r := e.imageRect
 	const hs = 3 // 手柄半尺寸 (6x6 方块)
 
@@ -1776,11 +2885,135 @@ func (e *Editor) drawResizeHandles(hdc uintptr) {
 	deleteObject.Call(brush)
 }
 
+// drawCropRect 绘制正在拖拽的裁剪区域（虚线边框）
+func (e *Editor) drawCropRect(hdc uintptr) {
+	if !e.cropDragging {
+		return
+	}
+	r := e.cropRect()
+	if r.Empty() {
+		return
+	}
+	sx, sy := e.canvasToScreen(r.Min.X, r.Min.Y)
+	ex, ey := e.canvasToScreen(r.Max.X, r.Max.Y)
+
+	pen, _, _ := createPen.Call(psDOT, 1, colorAccent)
+	oldPen, _, _ := selectObject.Call(hdc, pen)
+	nullBr, _, _ := getStockObject.Call(nullBrush)
+	oldBrush, _, _ := selectObject.Call(hdc, nullBr)
+	rectangle.Call(hdc, uintptr(sx), uintptr(sy), uintptr(ex), uintptr(ey))
+	selectObject.Call(hdc, oldPen)
+	selectObject.Call(hdc, oldBrush)
+	deleteObject.Call(pen)
+}
+
+// drawSnapGuides 吸附时绘制网格和对齐参考线
+func (e *Editor) drawSnapGuides(hdc uintptr) {
+	if !(e.drawing || e.editingAnn) || !snapActive() || (e.drawing && e.currentTool == ToolFreehand) {
+		return
+	}
+	b := e.background.Bounds()
+	sx0, sy0 := e.canvasToScreen(0, 0)
+	sx1, sy1 := e.canvasToScreen(b.Dx(), b.Dy())
+	// 只在选区内绘制（放大时画布超出选区）
+	clip := e.imageRect.Intersect(image.Rect(sx0, sy0, sx1, sy1))
+	if clip.Empty() {
+		return
+	}
+
+	// vline/hline 绘制画布坐标 x/y 处的竖线/横线
+	vline := func(x int) {
+		if sx, _ := e.canvasToScreen(x, 0); sx >= clip.Min.X && sx < clip.Max.X {
+			moveToEx.Call(hdc, uintptr(sx), uintptr(clip.Min.Y), 0)
+			lineTo.Call(hdc, uintptr(sx), uintptr(clip.Max.Y))
+		}
+	}
+	hline := func(y int) {
+		if _, sy := e.canvasToScreen(0, y); sy >= clip.Min.Y && sy < clip.Max.Y {
+			moveToEx.Call(hdc, uintptr(clip.Min.X), uintptr(sy), 0)
+			lineTo.Call(hdc, uintptr(clip.Max.X), uintptr(sy))
+		}
+	}
+
+	// 网格（屏幕上的间距过小时不绘制，避免铺满屏幕）
+	if g := e.snap.Grid; g > 0 && float64(g)*e.view.zoom >= snapGridMinDraw {
+		pen, _, _ := createPen.Call(psDOT, 1, colorSeparator)
+		oldPen, _, _ := selectObject.Call(hdc, pen)
+		for x := g; x < b.Dx(); x += g {
+			vline(x)
+		}
+		for y := g; y < b.Dy(); y += g {
+			hline(y)
+		}
+		selectObject.Call(hdc, oldPen)
+		deleteObject.Call(pen)
+	}
+
+	// 对齐参考线
+	if len(e.snapGuides) > 0 {
+		pen, _, _ := createPen.Call(psSOLID, 1, colorAccent)
+		oldPen, _, _ := selectObject.Call(hdc, pen)
+		for _, g := range e.snapGuides {
+			if g.Vertical {
+				vline(g.Pos)
+			} else {
+				hline(g.Pos)
+			}
+		}
+		selectObject.Call(hdc, oldPen)
+		deleteObject.Call(pen)
+	}
+}
+
+// drawAnnotationSelection 绘制选中标注的虚线边框和调整手柄
+func (e *Editor) drawAnnotationSelection(hdc uintptr) {
+	if e.currentTool != ToolSelect || e.draggingSelection {
+		return
+	}
+	r, ok := e.selectedScreenRect()
+	if !ok {
+		return
+	}
+
+	// 虚线边框
+	pen, _, _ := createPen.Call(psDOT, 1, colorAccent)
+	oldPen, _, _ := selectObject.Call(hdc, pen)
+	nullBr, _, _ := getStockObject.Call(nullBrush)
+	oldBrush, _, _ := selectObject.Call(hdc, nullBr)
+	rectangle.Call(hdc, uintptr(r.Min.X), uintptr(r.Min.Y), uintptr(r.Max.X), uintptr(r.Max.Y))
+	selectObject.Call(hdc, oldPen)
+	selectObject.Call(hdc, oldBrush)
+	deleteObject.Call(pen)
+
+	// 8个手柄（白色方块）
+	const hs = 3
+	brush, _, _ := createSolidBrush.Call(0x00FFFFFF)
+	midX := (r.Min.X + r.Max.X) / 2
+	midY := (r.Min.Y + r.Max.Y) / 2
+	handles := [8]image.Point{
+		{r.Min.X, r.Min.Y}, {midX, r.Min.Y}, {r.Max.X, r.Min.Y}, {r.Max.X, midY},
+		{r.Max.X, r.Max.Y}, {midX, r.Max.Y}, {r.Min.X, r.Max.Y}, {r.Min.X, midY},
+	}
+	for _, p := range handles {
+		rc := rect{
+			Left:   int32(p.X - hs),
+			Top:    int32(p.Y - hs),
+			Right:  int32(p.X + hs),
+			Bottom: int32(p.Y + hs),
+		}
+		fillRect.Call(hdc, uintptr(unsafe.Pointer(&rc)), brush)
+	}
+	deleteObject.Call(brush)
+}
+
 // drawSizeIndicator 绘制选区尺寸指示器（如 "968 x 511"）
 func (e *Editor) drawSizeIndicator(hdc uintptr) {
 	selW := e.imageRect.Dx()
 	selH := e.imageRect.Dy()
 	text := strconv.Itoa(selW) + " x " + strconv.Itoa(selH)
+	if e.view.zoom != 1 {
+		text += "  " + strconv.Itoa(int(math.Round(e.view.zoom*100))) + "%"
+	}
 
 	// 指示器位置: 选区左上方
 	textH := 20
@@ -1897,6 +3130,82 @@ func (e *Editor) drawMainToolbar(hdc uintptr) {
 	e.drawMainToolbarSeparators(hdc)
 }
 
+// toggleStyle 切换轮廓或不透明度（选择工具下同时作用于选中标注）
+func (e *Editor) toggleStyle(action string) {
+	switch action {
+	case "outline":
+		e.outline = !e.outline
+		if e.currentTool == ToolSelect {
+			e.restyleSelected(func(a *Annotation) { a.Outline = e.outline })
+		}
+	case "opacity":
+		next := 0
+		for i, v := range subToolbarOpacities {
+			if v == e.opacity {
+				next = (i + 1) % len(subToolbarOpacities)
+				break
+			}
+		}
+		e.opacity = subToolbarOpacities[next]
+		if e.currentTool == ToolSelect {
+			e.restyleSelected(func(a *Annotation) { a.Opacity = e.opacity })
+		}
+	}
+}
+
+// applyStyle 将当前的不透明度、轮廓和填充设置应用到新标注
+func (e *Editor) applyStyle(a *Annotation) {
+	a.Opacity = e.opacity
+	a.Outline = e.outline
+	a.Filled = e.filled && (a.Type == ToolRect || a.Type == ToolEllipse)
+}
+
+// sizeOptions 二级面板中的尺寸选项（文本工具为字号，其余为线宽）
+func (e *Editor) sizeOptions() []int {
+	if e.currentTool == ToolText {
+		return e.fontSizes
+	}
+	return e.lineWidths
+}
+
+// applyPreset 应用第 i 个样式预设（选择工具下同时修改选中的标注）
+func (e *Editor) applyPreset(i int) {
+	if i < 0 || i >= len(e.presets) {
+		return
+	}
+	p := e.presets[i]
+	if p.SwitchTool {
+		e.selectTool(p.Tool)
+	}
+	if p.Color.A != 0 {
+		e.currentColor = p.Color
+	}
+	if p.LineWidth > 0 {
+		e.lineWidth = p.LineWidth
+	}
+	if p.FontSize > 0 {
+		e.fontSize = p.FontSize
+	}
+	e.opacity = p.Opacity
+	if e.opacity <= 0 {
+		e.opacity = subToolbarOpacities[0]
+	}
+	e.outline = p.Outline
+	e.filled = p.Filled
+
+	if e.currentTool == ToolSelect {
+		e.restyleSelected(func(a *Annotation) {
+			a.Color = e.currentColor
+			if a.Type == ToolText {
+				a.FontSize = e.fontSize
+			} else {
+				a.LineWidth = e.lineWidth
+			}
+			e.applyStyle(a)
+		})
+	}
+}
+
 // drawSubToolbar 绘制二级面板
 func (e *Editor) drawSubToolbar(hdc uintptr) {
 	// 绘制背景
@@ -1913,10 +3222,17 @@ func (e *Editor) drawSubToolbar(hdc uintptr) {
 		}
 
 		switch btn.kind {
-		case "linewidth":
+		case "linewidth", "fontsize":
 			e.drawLineWidthDot(hdc, btn)
 		case "color":
 			e.drawColorBlock(hdc, btn)
+		case "style":
+			e.drawStyleButton(hdc, btn)
+		case "stamp":
+			if btn.stamp == e.stamp {
+				e.drawSelectedBg(hdc, btn.x, btn.y, btn.w, btn.h)
+			}
+			e.drawStampIcon(hdc, btn)
 		}
 	}
 
@@ -1978,7 +3294,7 @@ func (e *Editor) drawMainToolbarSeparators(hdc uintptr) {
 // drawSubToolbarSeparator 绘制二级面板分隔符
 func (e *Editor) drawSubToolbarSeparator(hdc uintptr) {
 	buttons := e.getSubToolbarButtons()
-	if len(buttons) == 0 {
+	if len(buttons) == 0 || e.currentTool == ToolImage {
 		return
 	}
 
@@ -1988,12 +3304,14 @@ func (e *Editor) drawSubToolbarSeparator(hdc uintptr) {
 	sepY1 := e.subToolbarRect.Min.Y + 10
 	sepY2 := e.subToolbarRect.Max.Y - 10
 
-	// 分隔符在线宽按钮和颜色按钮之间
-	numLW := len(subToolbarLineWidths)
-	if numLW < len(buttons) {
-		sepX := buttons[numLW-1].x + buttons[numLW-1].w + (toolbarSepWidth / 2)
-		moveToEx.Call(hdc, uintptr(sepX), uintptr(sepY1), 0)
-		lineTo.Call(hdc, uintptr(sepX), uintptr(sepY2))
+	// 分隔符在线宽按钮和颜色按钮之间、颜色按钮和样式按钮之间
+	numLW := len(e.sizeOptions())
+	for _, n := range []int{numLW, numLW + len(e.palette)} {
+		if n < len(buttons) {
+			sepX := buttons[n].x - (toolbarSepWidth / 2)
+			moveToEx.Call(hdc, uintptr(sepX), uintptr(sepY1), 0)
+			lineTo.Call(hdc, uintptr(sepX), uintptr(sepY2))
+		}
 	}
 
 	selectObject.Call(hdc, oldPen)
@@ -2060,6 +3378,33 @@ func (e *Editor) drawToolIcon(hdc uintptr, btn toolbarButton, highlighted bool)
 		gdipDrawRoundRect(g, pen, cx-s, cy-s, s*2, s*2, 4)
 		gdipDrawLineI.Call(g, pen, uintptr(cx), uintptr(cy-s+2), uintptr(cx), uintptr(cy+s-2))
 		gdipDrawLineI.Call(g, pen, uintptr(cx-s+2), uintptr(cy), uintptr(cx+s-2), uintptr(cy))
+
+	case ToolImage:
+		// 图片：边框 + 山峰 + 太阳
+		gdipDrawRoundRect(g, pen, cx-12, cy-9, 24, 18, 4)
+		gdipDrawLineI.Call(g, pen, uintptr(cx-8), uintptr(cy+5), uintptr(cx-2), uintptr(cy-1))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-2), uintptr(cy-1), uintptr(cx+2), uintptr(cy+3))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+2), uintptr(cy+3), uintptr(cx+5), uintptr(cy))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+5), uintptr(cy), uintptr(cx+8), uintptr(cy+5))
+		gdipDrawEllipseI.Call(g, pen, uintptr(cx+3), uintptr(cy-6), 4, 4)
+
+	case ToolMeasure:
+		// 尺子：斜放的长条 + 刻度
+		gdipDrawLineI.Call(g, pen, uintptr(cx-12), uintptr(cy+5), uintptr(cx+5), uintptr(cy-12))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+5), uintptr(cy-12), uintptr(cx+12), uintptr(cy-5))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+12), uintptr(cy-5), uintptr(cx-5), uintptr(cy+12))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-5), uintptr(cy+12), uintptr(cx-12), uintptr(cy+5))
+		for _, t := range []int{-5, 0, 5} {
+			gdipDrawLineI.Call(g, pen, uintptr(cx+t-1), uintptr(cy-t-1), uintptr(cx+t+2), uintptr(cy-t+2))
+		}
+
+	case ToolSelect:
+		// 鼠标指针
+		gdipDrawLineI.Call(g, pen, uintptr(cx-6), uintptr(cy-11), uintptr(cx-6), uintptr(cy+6))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-6), uintptr(cy+6), uintptr(cx-2), uintptr(cy+2))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-2), uintptr(cy+2), uintptr(cx+6), uintptr(cy+2))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+6), uintptr(cy+2), uintptr(cx-6), uintptr(cy-11))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-2), uintptr(cy+2), uintptr(cx+2), uintptr(cy+10))
 	}
 }
 
@@ -2115,6 +3460,11 @@ func (e *Editor) drawActionButton(hdc uintptr, btn toolbarButton, hovered bool)
 // drawLineWidthDot 绘制线宽选择圆点（GDI+ 抗锯齿）
 func (e *Editor) drawLineWidthDot(hdc uintptr, btn toolbarButton) {
 	dotRadius := btn.lineWidth + 2
+	selected := btn.lineWidth == e.lineWidth
+	if btn.kind == "fontsize" {
+		dotRadius = btn.lineWidth/4 + 1
+		selected = btn.lineWidth == e.fontSize
+	}
 	if dotRadius > btn.w/2-3 {
 		dotRadius = btn.w/2 - 3
 	}
@@ -2123,7 +3473,7 @@ func (e *Editor) drawLineWidthDot(hdc uintptr, btn toolbarButton) {
 	cy := btn.y + btn.h/2
 
 	var dotColor uintptr
-	if btn.lineWidth == e.lineWidth {
+	if selected {
 		dotColor = colorAccent
 	} else {
 		dotColor = 0x00AAAAAA
@@ -2141,11 +3491,11 @@ func (e *Editor) drawLineWidthDot(hdc uintptr, btn toolbarButton) {
 
 // drawColorBlock 绘制颜色圆圈（GDI+ 抗锯齿，选中时带白色选中环）
 func (e *Editor) drawColorBlock(hdc uintptr, btn toolbarButton) {
-	if btn.colorIndex < 0 || btn.colorIndex >= len(DefaultColors) {
+	if btn.colorIndex < 0 || btn.colorIndex >= len(e.palette) {
 		return
 	}
 
-	c := DefaultColors[btn.colorIndex]
+	c := e.palette[btn.colorIndex]
 	colorRef := uintptr(uint32(c.R)) | (uintptr(uint32(c.G)) << 8) | (uintptr(uint32(c.B)) << 16)
 
 	cx := btn.x + btn.w/2
@@ -2169,6 +3519,96 @@ func (e *Editor) drawColorBlock(hdc uintptr, btn toolbarButton) {
 	}
 }
 
+// drawStyleButton 绘制轮廓开关/不透明度按钮（GDI+ 抗锯齿）
+func (e *Editor) drawStyleButton(hdc uintptr, btn toolbarButton) {
+	cx := btn.x + btn.w/2
+	cy := btn.y + btn.h/2
+	r := btn.w/2 - 6
+
+	c := e.currentColor
+	colorRef := uintptr(uint32(c.R)) | (uintptr(uint32(c.G)) << 8) | (uintptr(uint32(c.B)) << 16)
+
+	g := gdipNewGraphics(hdc)
+	defer gdipDeleteGraphics.Call(g)
+
+	switch btn.action {
+	case "outline":
+		// 当前颜色的圆点，开启时外围带白色轮廓
+		ringColor := uintptr(0x00AAAAAA)
+		if e.outline {
+			ringColor = 0x00FFFFFF
+		}
+		ringPen := gdipNewPen(ringColor, 3)
+		gdipDrawEllipseI.Call(g, ringPen, uintptr(cx-r-1), uintptr(cy-r-1), uintptr(r*2+2), uintptr(r*2+2))
+		gdipDeletePen.Call(ringPen)
+
+		brush := gdipNewBrush(colorRef)
+		gdipFillEllipseI.Call(g, brush, uintptr(cx-r+2), uintptr(cy-r+2), uintptr(r*2-4), uintptr(r*2-4))
+		gdipDeleteBrush.Call(brush)
+
+	case "opacity":
+		// 当前颜色按不透明度与面板背景混合，并标注百分比
+		bg := uint32(colorToolbarBg)
+		mix := func(fg uint8, shift uint) uintptr {
+			b := (bg >> shift) & 0xFF
+			return uintptr((uint32(fg)*uint32(e.opacity) + b*uint32(100-e.opacity)) / 100)
+		}
+		fill := mix(c.R, 0) | mix(c.G, 8)<<8 | mix(c.B, 16)<<16
+		brush := gdipNewBrush(fill)
+		gdipFillEllipseI.Call(g, brush, uintptr(cx-r-1), uintptr(cy-r-1), uintptr(r*2+2), uintptr(r*2+2))
+		gdipDeleteBrush.Call(brush)
+
+		if e.opacity < 100 {
+			ringPen := gdipNewPen(colorAccent, 2)
+			gdipDrawEllipseI.Call(g, ringPen, uintptr(cx-r-3), uintptr(cy-r-3), uintptr(r*2+6), uintptr(r*2+6))
+			gdipDeletePen.Call(ringPen)
+		}
+	}
+}
+
+// drawStampIcon 绘制图章选择按钮（GDI+ 抗锯齿）
+func (e *Editor) drawStampIcon(hdc uintptr, btn toolbarButton) {
+	cx := btn.x + btn.w/2
+	cy := btn.y + btn.h/2
+	r := btn.w/2 - 5
+
+	g := gdipNewGraphics(hdc)
+	defer gdipDeleteGraphics.Call(g)
+	pen := gdipNewPen(0x00FFFFFF, 2)
+	defer gdipDeletePen.Call(pen)
+
+	switch btn.stamp {
+	case StampCheck:
+		brush := gdipNewBrush(0x0059C734) // #34C759
+		gdipFillEllipseI.Call(g, brush, uintptr(cx-r), uintptr(cy-r), uintptr(r*2), uintptr(r*2))
+		gdipDeleteBrush.Call(brush)
+		gdipDrawLineI.Call(g, pen, uintptr(cx-5), uintptr(cy), uintptr(cx-1), uintptr(cy+4))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-1), uintptr(cy+4), uintptr(cx+5), uintptr(cy-3))
+
+	case StampCross:
+		brush := gdipNewBrush(0x00303BFF) // #FF3B30
+		gdipFillEllipseI.Call(g, brush, uintptr(cx-r), uintptr(cy-r), uintptr(r*2), uintptr(r*2))
+		gdipDeleteBrush.Call(brush)
+		gdipDrawLineI.Call(g, pen, uintptr(cx-4), uintptr(cy-4), uintptr(cx+4), uintptr(cy+4))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+4), uintptr(cy-4), uintptr(cx-4), uintptr(cy+4))
+
+	case StampWarning:
+		yellow := gdipNewPen(0x0000CCFF, 2.5) // #FFCC00
+		gdipDrawLineI.Call(g, yellow, uintptr(cx), uintptr(cy-r), uintptr(cx+r), uintptr(cy+r-2))
+		gdipDrawLineI.Call(g, yellow, uintptr(cx+r), uintptr(cy+r-2), uintptr(cx-r), uintptr(cy+r-2))
+		gdipDrawLineI.Call(g, yellow, uintptr(cx-r), uintptr(cy+r-2), uintptr(cx), uintptr(cy-r))
+		gdipDrawLineI.Call(g, yellow, uintptr(cx), uintptr(cy-3), uintptr(cx), uintptr(cy+2))
+		gdipDeletePen.Call(yellow)
+
+	case StampCursor:
+		gdipDrawLineI.Call(g, pen, uintptr(cx-5), uintptr(cy-9), uintptr(cx-5), uintptr(cy+6))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-5), uintptr(cy+6), uintptr(cx-1), uintptr(cy+2))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-1), uintptr(cy+2), uintptr(cx+6), uintptr(cy+2))
+		gdipDrawLineI.Call(g, pen, uintptr(cx+6), uintptr(cy+2), uintptr(cx-5), uintptr(cy-9))
+		gdipDrawLineI.Call(g, pen, uintptr(cx-1), uintptr(cy+2), uintptr(cx+2), uintptr(cy+8))
+	}
+}
+
 // drawGDIText 使用 GDI 绘制文本
 func (e *Editor) drawGDIText(hdc uintptr, text string, x, y, w, h int, colorRef uintptr) {
 	hFont, _, _ := createFontW.Call(
@@ -1,53 +1,383 @@
 package annotate
 
-import "image"
+import (
+	"image"
+	"image/color"
+	"unsafe"
+)
+
+// DefaultHistoryBytes 撤销历史默认内存上限
+const DefaultHistoryBytes = 16 << 20
 
 // History 撤销/重做管理器
+//
+// 每一步操作记录为可逆命令（添加/删除/修改/重排/图片操作），只保存变化量而不是整表快照。
+// 进入历史的标注视为不可变：修改标注总是替换为新的副本，Points 切片不会被原地改写，
+// 因此命令和当前标注列表可以安全地共享同一份 Points。
 type History struct {
 	annotations []Annotation // 当前标注列表
-	undoStack   [][]Annotation // 撤销栈（保存之前的状态快照）
-	redoStack   [][]Annotation // 重做栈
-	maxHistory  int
+	undoStack   []command    // 撤销栈
+	redoStack   []command    // 重做栈
+	undoBytes   int          // 撤销栈估算占用的内存（不含底图）
+	maxBytes    int          // 撤销栈内存上限（标注和底图分别计算）
+	maxSteps    int          // 撤销栈步数上限（0 表示不限制）
+
+	imageBytes int // 撤销栈中裁剪前保存的底图占用的内存
+
+	image     *image.RGBA    // 当前底图（图片操作会替换为新图片，不原地修改）
+	imageOps  int            // 已生效的图片操作数量
+	transform ImageTransform // 初始底图到当前底图的坐标变换
 }
 
-// NewHistory 创建历史记录管理器
+// NewHistory 创建历史记录管理器，maxHistory 为最多保留的撤销步数（<=0 使用默认值 50），
+// 内存上限使用 DefaultHistoryBytes
 func NewHistory(maxHistory int) *History {
 	if maxHistory <= 0 {
 		maxHistory = 50
 	}
+	h := NewHistoryWithBudget(DefaultHistoryBytes)
+	h.maxSteps = maxHistory
+	return h
+}
+
+// NewHistoryWithBudget 创建只按内存限制的历史记录管理器，maxBytes 为撤销栈的内存上限
+// （<=0 使用默认值），不限制步数
+func NewHistoryWithBudget(maxBytes int) *History {
+	if maxBytes <= 0 {
+		maxBytes = DefaultHistoryBytes
+	}
 	return &History{
 		annotations: make([]Annotation, 0),
-		undoStack:   make([][]Annotation, 0),
-		redoStack:   make([][]Annotation, 0),
-		maxHistory:  maxHistory,
+		undoStack:   make([]command, 0),
+		redoStack:   make([]command, 0),
+		maxBytes:    maxBytes,
+		transform:   IdentityTransform,
+	}
+}
+
+// ============================================================================
+// 命令
+// ============================================================================
+
+// command 可逆的编辑操作
+type command interface {
+	apply(h *History)  // 执行（重做）
+	revert(h *History) // 撤销
+	size() int         // 估算占用的内存（字节）
+}
+
+// addCmd 在 index 处插入标注
+type addCmd struct {
+	index int
+	ann   Annotation
+}
+
+func (c *addCmd) apply(h *History)  { h.insert(c.index, c.ann) }
+func (c *addCmd) revert(h *History) { h.remove(c.index) }
+func (c *addCmd) size() int         { return annotationSize(&c.ann) }
+
+// removeCmd 删除 index 处的标注
+type removeCmd struct {
+	index int
+	ann   Annotation
+}
+
+func (c *removeCmd) apply(h *History)  { h.remove(c.index) }
+func (c *removeCmd) revert(h *History) { h.insert(c.index, c.ann) }
+func (c *removeCmd) size() int         { return annotationSize(&c.ann) }
+
+// modifyCmd 将 index 处的标注从 before 替换为 after
+type modifyCmd struct {
+	index         int
+	before, after Annotation
+}
+
+func (c *modifyCmd) apply(h *History)  { h.annotations[c.index] = c.after }
+func (c *modifyCmd) revert(h *History) { h.annotations[c.index] = c.before }
+func (c *modifyCmd) size() int {
+	// 未改变几何形状时 before/after 共享 Points，只计算一次
+	n := annotationSize(&c.before) + annotationSize(&c.after)
+	if samePoints(c.before.Points, c.after.Points) {
+		n -= len(c.after.Points) * pointBytes
+	}
+	return n
+}
+
+// reorderCmd 重排标注顺序：新列表第 i 项为旧列表第 order[i] 项
+type reorderCmd struct {
+	order []int
+}
+
+func (c *reorderCmd) apply(h *History) {
+	old := h.annotations
+	h.annotations = make([]Annotation, len(old))
+	for i, j := range c.order {
+		h.annotations[i] = old[j]
+	}
+}
+
+func (c *reorderCmd) revert(h *History) {
+	cur := h.annotations
+	h.annotations = make([]Annotation, len(cur))
+	for i, j := range c.order {
+		h.annotations[j] = cur[i]
+	}
+}
+
+func (c *reorderCmd) size() int { return commandOverhead + len(c.order)*int(unsafe.Sizeof(int(0))) }
+
+// batchCmd 组合命令：多个命令作为一次撤销步骤
+type batchCmd []command
+
+func (c batchCmd) apply(h *History) {
+	for _, sub := range c {
+		sub.apply(h)
+	}
+}
+
+func (c batchCmd) revert(h *History) {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i].revert(h)
+	}
+}
+
+func (c batchCmd) size() int {
+	n := commandOverhead
+	for _, sub := range c {
+		n += sub.size()
 	}
+	return n
+}
+
+// ============================================================================
+// 内存估算
+// ============================================================================
+
+var (
+	annotationBytes = int(unsafe.Sizeof(Annotation{}))
+	pointBytes      = int(unsafe.Sizeof(image.Point{}))
+)
+
+// commandOverhead 每条命令的固定开销估算
+const commandOverhead = 32
+
+// annotationSize 估算单个标注占用的内存
+func annotationSize(a *Annotation) int {
+	return commandOverhead + annotationBytes + len(a.Points)*pointBytes + len(a.Text)
+}
+
+// samePoints 两个切片是否共享同一底层数组
+func samePoints(a, b []image.Point) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// ============================================================================
+// 底层列表操作（不记录历史）
+// ============================================================================
+
+func (h *History) insert(i int, a Annotation) {
+	h.annotations = append(h.annotations, Annotation{})
+	copy(h.annotations[i+1:], h.annotations[i:])
+	h.annotations[i] = a
+}
+
+func (h *History) remove(i int) {
+	copy(h.annotations[i:], h.annotations[i+1:])
+	h.annotations[len(h.annotations)-1] = Annotation{}
+	h.annotations = h.annotations[:len(h.annotations)-1]
+}
+
+// execute 执行命令并压入撤销栈
+func (h *History) execute(c command) {
+	c.apply(h)
+
+	h.push(c)
+
+	// 清空重做栈（新操作后重做无效）
+	clearStack(&h.redoStack)
+
+	h.trim()
+}
+
+// push 将命令压入撤销栈并计入内存
+func (h *History) push(c command) {
+	h.undoStack = append(h.undoStack, c)
+	h.undoBytes += c.size()
+	h.imageBytes += imageBytes(c)
+}
+
+// pop 弹出撤销栈顶的命令
+func (h *History) pop() command {
+	c := h.undoStack[len(h.undoStack)-1]
+	h.undoStack[len(h.undoStack)-1] = nil
+	h.undoStack = h.undoStack[:len(h.undoStack)-1]
+	h.undoBytes -= c.size()
+	h.imageBytes -= imageBytes(c)
+	return c
 }
 
-// snapshot 创建当前状态快照
-func (h *History) snapshot() []Annotation {
-	s := make([]Annotation, len(h.annotations))
-	for i, a := range h.annotations {
-		s[i] = a
-		// 深拷贝 Points 切片
-		s[i].Points = make([]image.Point, len(a.Points))
-		copy(s[i].Points, a.Points)
+// clearStack 清空命令栈（释放命令引用）
+func clearStack(s *[]command) {
+	for i := range *s {
+		(*s)[i] = nil
 	}
-	return s
+	*s = (*s)[:0]
 }
 
+// trim 超出步数或内存上限时丢弃最早的撤销步骤（至少保留最近一步）。
+// 底图单独计算：超出上限时只丢弃到较早的裁剪为止，始终保留最近一次裁剪，
+// 避免一次大图裁剪清空全部标注历史
+func (h *History) trim() {
+	crops := 0
+	for _, c := range h.undoStack {
+		if imageBytes(c) > 0 {
+			crops++
+		}
+	}
+
+	drop := 0
+	for drop < len(h.undoStack)-1 && (h.maxSteps > 0 && len(h.undoStack)-drop > h.maxSteps ||
+		h.undoBytes > h.maxBytes || h.imageBytes > h.maxBytes && crops > 1) {
+		c := h.undoStack[drop]
+		h.undoBytes -= c.size()
+		if n := imageBytes(c); n > 0 {
+			h.imageBytes -= n
+			crops--
+		}
+		h.undoStack[drop] = nil
+		drop++
+	}
+	if drop > 0 {
+		h.undoStack = append(h.undoStack[:0], h.undoStack[drop:]...)
+	}
+}
+
+// ============================================================================
+// 公开操作
+// ============================================================================
+
 // AddAnnotation 添加一个标注（保存撤销点）
 func (h *History) AddAnnotation(a Annotation) {
-	// 保存当前状态到撤销栈
-	h.undoStack = append(h.undoStack, h.snapshot())
-	if len(h.undoStack) > h.maxHistory {
-		h.undoStack = h.undoStack[1:]
+	h.execute(&addCmd{index: len(h.annotations), ann: a})
+}
+
+// ModifyAnnotation 用 a 替换索引 i 处的标注（保存撤销点），返回是否成功
+func (h *History) ModifyAnnotation(i int, a Annotation) bool {
+	if i < 0 || i >= len(h.annotations) {
+		return false
 	}
+	h.execute(&modifyCmd{index: i, before: h.annotations[i], after: a.Clone()})
+	return true
+}
 
-	// 清空重做栈（新操作后重做无效）
-	h.redoStack = h.redoStack[:0]
+// RemoveAnnotation 删除索引 i 处的标注（保存撤销点），返回是否成功
+func (h *History) RemoveAnnotation(i int) bool {
+	if i < 0 || i >= len(h.annotations) {
+		return false
+	}
+	h.execute(&removeCmd{index: i, ann: h.annotations[i]})
+	return true
+}
 
-	// 添加标注
-	h.annotations = append(h.annotations, a)
+// Reorder 按 order 重排标注（新列表第 i 项为旧列表第 order[i] 项），返回是否成功
+func (h *History) Reorder(order []int) bool {
+	if len(order) != len(h.annotations) {
+		return false
+	}
+	seen := make([]bool, len(order))
+	changed := false
+	for i, j := range order {
+		if j < 0 || j >= len(order) || seen[j] {
+			return false
+		}
+		seen[j] = true
+		if i != j {
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	h.execute(&reorderCmd{order: append([]int(nil), order...)})
+	return true
+}
+
+// ModifyAnnotations 批量替换标注（作为一次撤销步骤），返回是否成功
+func (h *History) ModifyAnnotations(indices []int, anns []Annotation) bool {
+	if len(indices) == 0 || len(indices) != len(anns) {
+		return false
+	}
+	batch := make(batchCmd, 0, len(indices))
+	for k, i := range indices {
+		if i < 0 || i >= len(h.annotations) {
+			return false
+		}
+		batch = append(batch, &modifyCmd{index: i, before: h.annotations[i], after: anns[k].Clone()})
+	}
+	h.execute(batch)
+	return true
+}
+
+// RemoveAnnotations 批量删除标注（作为一次撤销步骤），返回是否成功
+func (h *History) RemoveAnnotations(indices []int) bool {
+	idx := uniqueSorted(indices)
+	if len(idx) == 0 || idx[0] < 0 || idx[len(idx)-1] >= len(h.annotations) {
+		return false
+	}
+	// 从后往前删除，保证前面的索引不变
+	batch := make(batchCmd, 0, len(idx))
+	for k := len(idx) - 1; k >= 0; k-- {
+		i := idx[k]
+		batch = append(batch, &removeCmd{index: i, ann: h.annotations[i]})
+	}
+	h.execute(batch)
+	return true
+}
+
+// MoveAnnotation 平移索引 i 处的标注
+func (h *History) MoveAnnotation(i, dx, dy int) bool {
+	if i < 0 || i >= len(h.annotations) || (dx == 0 && dy == 0) {
+		return false
+	}
+	a := h.annotations[i].Clone()
+	a.Translate(dx, dy)
+	return h.ModifyAnnotation(i, a)
+}
+
+// ResizeAnnotation 将索引 i 处的标注缩放到矩形 to
+func (h *History) ResizeAnnotation(i int, to image.Rectangle) bool {
+	if i < 0 || i >= len(h.annotations) {
+		return false
+	}
+	a := h.annotations[i].Clone()
+	from := a.Bounds()
+	if from == to {
+		return false
+	}
+	a.Resize(from, to)
+	return h.ModifyAnnotation(i, a)
+}
+
+// RecolorAnnotation 修改索引 i 处标注的颜色
+func (h *History) RecolorAnnotation(i int, c color.RGBA) bool {
+	if i < 0 || i >= len(h.annotations) || h.annotations[i].Color == c {
+		return false
+	}
+	a := h.annotations[i]
+	a.Color = c
+	h.execute(&modifyCmd{index: i, before: h.annotations[i], after: a})
+	return true
+}
+
+// SetAnnotationLineWidth 修改索引 i 处标注的线宽
+func (h *History) SetAnnotationLineWidth(i, width int) bool {
+	if i < 0 || i >= len(h.annotations) || h.annotations[i].LineWidth == width {
+		return false
+	}
+	a := h.annotations[i]
+	a.LineWidth = width
+	h.execute(&modifyCmd{index: i, before: h.annotations[i], after: a})
+	return true
 }
 
 // Undo 撤销上一步操作，返回是否成功
@@ -56,13 +386,9 @@ func (h *History) Undo() bool {
 		return false
 	}
 
-	// 保存当前状态到重做栈
-	h.redoStack = append(h.redoStack, h.snapshot())
-
-	// 恢复到上一个状态
-	last := h.undoStack[len(h.undoStack)-1]
-	h.undoStack = h.undoStack[:len(h.undoStack)-1]
-	h.annotations = last
+	c := h.pop()
+	c.revert(h)
+	h.redoStack = append(h.redoStack, c)
 
 	return true
 }
@@ -73,18 +399,18 @@ func (h *History) Redo() bool {
 		return false
 	}
 
-	// 保存当前状态到撤销栈
-	h.undoStack = append(h.undoStack, h.snapshot())
-
-	// 恢复到下一个状态
-	last := h.redoStack[len(h.redoStack)-1]
+	c := h.redoStack[len(h.redoStack)-1]
+	h.redoStack[len(h.redoStack)-1] = nil
 	h.redoStack = h.redoStack[:len(h.redoStack)-1]
-	h.annotations = last
+
+	c.apply(h)
+	h.push(c)
+	h.trim()
 
 	return true
 }
 
-// GetAnnotations 获取当前所有标注
+// GetAnnotations 获取当前所有标注（只读，不要修改返回的切片）
 func (h *History) GetAnnotations() []Annotation {
 	return h.annotations
 }
@@ -99,9 +425,16 @@ func (h *History) CanRedo() bool {
 	return len(h.redoStack) > 0
 }
 
+// MemoryUsage 撤销栈估算占用的内存（字节）
+func (h *History) MemoryUsage() int {
+	return h.undoBytes + h.imageBytes
+}
+
 // Clear 清空所有历史
 func (h *History) Clear() {
 	h.annotations = h.annotations[:0]
-	h.undoStack = h.undoStack[:0]
-	h.redoStack = h.redoStack[:0]
+	clearStack(&h.undoStack)
+	clearStack(&h.redoStack)
+	h.undoBytes = 0
+	h.imageBytes = 0
 }
@@ -0,0 +1,200 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// named 生成以 Text 区分的矩形标注
+func named(name string, x int) Annotation {
+	return Annotation{
+		Type:   ToolRect,
+		Points: []image.Point{{x, 10}, {x + 10, 20}},
+		Color:  color.RGBA{255, 0, 0, 255},
+		Text:   name,
+	}
+}
+
+// state 标注列表的文本表示（名称、分组、坐标、颜色）
+func state(h *History) string {
+	var parts []string
+	for _, a := range h.GetAnnotations() {
+		parts = append(parts, fmt.Sprintf("%s/%d%v%v", a.Text, a.Group, a.Points, a.Color))
+	}
+	return strings.Join(parts, " ")
+}
+
+// names 标注名称（逗号分隔）
+func names(h *History) string {
+	var s []string
+	for _, a := range h.GetAnnotations() {
+		s = append(s, a.Text)
+	}
+	return strings.Join(s, ",")
+}
+
+// undoSteps 撤销到底并返回撤销的步数
+func undoSteps(h *History) int {
+	n := 0
+	for h.Undo() {
+		n++
+	}
+	return n
+}
+
+func TestHistoryUndoRedo(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(h *History) bool
+		want string // 操作后的名称顺序（为空时不检查）
+	}{
+		{"添加", func(h *History) bool { h.AddAnnotation(named("d", 40)); return true }, "a,b,c,d"},
+		{"删除", func(h *History) bool { return h.RemoveAnnotation(1) }, "a,c"},
+		{"修改", func(h *History) bool { return h.ModifyAnnotation(0, named("x", 50)) }, "x,b,c"},
+		{"平移", func(h *History) bool { return h.MoveAnnotation(1, 5, 7) }, "a,b,c"},
+		{"改色", func(h *History) bool { return h.RecolorAnnotation(2, color.RGBA{0, 0, 255, 255}) }, "a,b,c"},
+		{"重排", func(h *History) bool { return h.Reorder([]int{2, 0, 1}) }, "c,a,b"},
+		{"批量修改", func(h *History) bool {
+			return h.ModifyAnnotations([]int{0, 2}, []Annotation{named("x", 0), named("y", 0)})
+		}, "x,b,y"},
+		{"批量删除", func(h *History) bool { return h.RemoveAnnotations([]int{2, 0}) }, "b"},
+		{"分组", func(h *History) bool { return len(h.Group([]int{0, 2})) == 2 }, ""},
+		{"置顶", func(h *History) bool { return len(h.BringToFront([]int{0})) == 1 }, "b,c,a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistoryWithBudget(0)
+			for i, n := range []string{"a", "b", "c"} {
+				h.AddAnnotation(named(n, i*10))
+			}
+			base := state(h)
+
+			if !tt.op(h) {
+				t.Fatal("操作失败")
+			}
+			after := state(h)
+			if after == base {
+				t.Fatal("操作没有改变标注")
+			}
+			if tt.want != "" && names(h) != tt.want {
+				t.Errorf("操作后 = %s，应为 %s", names(h), tt.want)
+			}
+
+			if !h.Undo() || state(h) != base {
+				t.Errorf("撤销后 = %s，应为 %s", state(h), base)
+			}
+			if !h.Redo() || state(h) != after {
+				t.Errorf("重做后 = %s，应为 %s", state(h), after)
+			}
+			if h.CanRedo() {
+				t.Error("重做后仍可重做")
+			}
+
+			// 逐步撤销到初始状态
+			if n := undoSteps(h); n != 4 || len(h.GetAnnotations()) != 0 {
+				t.Errorf("撤销 %d 步后剩余 %d 个标注", n, len(h.GetAnnotations()))
+			}
+		})
+	}
+}
+
+// TestHistoryRedoCleared 新操作后重做栈失效
+func TestHistoryRedoCleared(t *testing.T) {
+	h := NewHistory(0)
+	h.AddAnnotation(named("a", 0))
+	h.AddAnnotation(named("b", 10))
+	h.Undo()
+	h.AddAnnotation(named("c", 20))
+	if h.Redo() {
+		t.Error("新操作后不应能重做")
+	}
+	if got := names(h); got != "a,c" {
+		t.Errorf("标注 = %s，应为 a,c", got)
+	}
+}
+
+// TestHistoryStoresDeltas 命令只保存变化量：修改一个标注的开销与标注总数无关
+func TestHistoryStoresDeltas(t *testing.T) {
+	for _, count := range []int{10, 1000} {
+		h := NewHistoryWithBudget(0)
+		for i := 0; i < count; i++ {
+			h.AddAnnotation(named(fmt.Sprint(i), i))
+		}
+		before := h.MemoryUsage()
+		points := h.GetAnnotations()[0].Points
+		h.RecolorAnnotation(0, color.RGBA{0, 255, 0, 255})
+		if delta, max := h.MemoryUsage()-before, 2*annotationSize(&h.GetAnnotations()[0]); delta > max {
+			t.Errorf("%d 个标注时改色增加 %d 字节，应不超过 %d", count, delta, max)
+		}
+		if !samePoints(points, h.GetAnnotations()[0].Points) {
+			t.Errorf("%d 个标注时改色复制了 Points", count)
+		}
+	}
+}
+
+func TestHistoryLimits(t *testing.T) {
+	// NewHistory 按步数限制
+	h := NewHistory(3)
+	for i := 0; i < 5; i++ {
+		h.AddAnnotation(named(fmt.Sprint(i), i))
+	}
+	if n := undoSteps(h); n != 3 || names(h) != "0,1" {
+		t.Errorf("步数上限 3：撤销 %d 步后 = %s", n, names(h))
+	}
+
+	// NewHistoryWithBudget 按内存限制，至少保留最近一步
+	budget := 4 * annotationSize(&Annotation{Points: make([]image.Point, 2), Text: "00"})
+	h = NewHistoryWithBudget(budget)
+	for i := 0; i < 20; i++ {
+		h.AddAnnotation(named(fmt.Sprintf("%02d", i), i))
+	}
+	if h.MemoryUsage() > budget {
+		t.Errorf("撤销栈占用 %d 字节，超过上限 %d", h.MemoryUsage(), budget)
+	}
+	if n := undoSteps(h); n == 0 || n >= 20 {
+		t.Errorf("内存上限内撤销了 %d 步", n)
+	}
+
+	big := Annotation{Points: make([]image.Point, budget/pointBytes)}
+	h.AddAnnotation(big)
+	if !h.CanUndo() {
+		t.Error("超过上限的单步操作也应保留")
+	}
+}
+
+// TestHistoryTrimKeepsLatestCrop 底图超过内存上限时保留最近一次裁剪及其之前的标注历史
+func TestHistoryTrimKeepsLatestCrop(t *testing.T) {
+	h := NewHistoryWithBudget(64 << 10)
+	h.SetImage(image.NewRGBA(image.Rect(0, 0, 200, 200))) // 160KB，超过上限
+	for i, n := range []string{"a", "b", "c"} {
+		h.AddAnnotation(named(n, i*10))
+	}
+	h.Crop(image.Rect(0, 0, 100, 100))
+	h.AddAnnotation(named("d", 30))
+
+	// 唯一的裁剪即使超过上限也保留，之前的标注步骤不受影响
+	if n := undoSteps(h); n != 5 {
+		t.Fatalf("撤销了 %d 步，应为 5", n)
+	}
+	if got := h.Image().Bounds().Size(); got != image.Pt(200, 200) || len(h.GetAnnotations()) != 0 {
+		t.Fatalf("全部撤销后底图 %v，标注 %s", got, names(h))
+	}
+	for h.Redo() {
+	}
+
+	// 再次裁剪后丢弃较早的裁剪，保留最近一次裁剪
+	h.Crop(image.Rect(0, 0, 50, 50))
+	h.AddAnnotation(named("e", 0))
+	if n := undoSteps(h); n != 3 {
+		t.Errorf("撤销了 %d 步，应为 3", n)
+	}
+	if got := h.Image().Bounds().Size(); got != image.Pt(100, 100) {
+		t.Errorf("撤销后底图尺寸 %v，应为 100x100", got)
+	}
+	if got := names(h); got != "a,b,c" {
+		t.Errorf("撤销后标注 = %s，应为 a,b,c", got)
+	}
+}
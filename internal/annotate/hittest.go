@@ -0,0 +1,121 @@
+package annotate
+
+import (
+	"image"
+	"math"
+)
+
+// HitTest 查找点 p 处最上层的标注，返回其索引，未命中返回 -1
+// tolerance 为描边类标注额外允许的命中距离（像素）
+func HitTest(annotations []Annotation, p image.Point, tolerance int) int {
+	for i := len(annotations) - 1; i >= 0; i-- {
+		if annotations[i].Contains(p, tolerance) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Contains 判断点 p 是否落在标注上
+// 描边按到笔迹的距离判断，填充图形、马赛克、图片和文本按内部区域判断
+func (a *Annotation) Contains(p image.Point, tolerance int) bool {
+	if len(a.Points) == 0 {
+		return false
+	}
+
+	// 快速裁剪：不在扩展后的边界内
+	tol := float64(tolerance) + float64(a.LineWidth)/2
+	if !p.In(a.Bounds().Inset(-tolerance)) {
+		return false
+	}
+
+	switch a.Type {
+	case ToolText:
+		return true // 边界即文本框
+
+	case ToolMeasure:
+		return measureContains(a, p, tolerance)
+
+	case ToolImage:
+		if len(a.Points) < 2 {
+			return false
+		}
+		return imageContains(canonicalRect(a.Points[0], a.Points[1]), a.Rotation, p, tolerance)
+
+	case ToolMosaic:
+		if len(a.Points) < 2 {
+			return false
+		}
+		return p.In(canonicalRect(a.Points[0], a.Points[1]).Inset(-tolerance))
+
+	case ToolRect:
+		if len(a.Points) < 2 {
+			return false
+		}
+		r := canonicalRect(a.Points[0], a.Points[1])
+		if a.Filled && p.In(r) {
+			return true
+		}
+		return rectBorderDist(p, r) <= tol
+
+	case ToolEllipse:
+		if len(a.Points) < 2 {
+			return false
+		}
+		r := canonicalRect(a.Points[0], a.Points[1])
+		cx := float64(r.Min.X+r.Max.X) / 2
+		cy := float64(r.Min.Y+r.Max.Y) / 2
+		rx := float64(r.Dx()) / 2
+		ry := float64(r.Dy()) / 2
+		if rx <= 0 || ry <= 0 {
+			return false
+		}
+		px, py := float64(p.X), float64(p.Y)
+		if a.Filled {
+			nx := (px - cx) / rx
+			ny := (py - cy) / ry
+			if nx*nx+ny*ny <= 1 {
+				return true
+			}
+		}
+		return ellipsePointDist(px, py, cx, cy, rx, ry) <= tol
+
+	case ToolArrow:
+		if len(a.Points) < 2 {
+			return false
+		}
+		if segmentDist(p, a.Points[0], a.Points[1]) <= tol {
+			return true
+		}
+		// 箭头头部
+		return pointDist(p, a.Points[1]) <= float64(arrowHeadSize(a.LineWidth)+tolerance)
+
+	case ToolLine:
+		if len(a.Points) < 2 {
+			return false
+		}
+		return segmentDist(p, a.Points[0], a.Points[1]) <= tol
+
+	case ToolFreehand:
+		if len(a.Points) == 1 {
+			return pointDist(p, a.Points[0]) <= tol
+		}
+		for i := 1; i < len(a.Points); i++ {
+			if segmentDist(p, a.Points[i-1], a.Points[i]) <= tol {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rectBorderDist 点到矩形边框的距离
+func rectBorderDist(p image.Point, r image.Rectangle) float64 {
+	x0, y0 := r.Min.X, r.Min.Y
+	x1, y1 := r.Max.X-1, r.Max.Y-1
+	d := segmentDist(p, image.Pt(x0, y0), image.Pt(x1, y0))
+	d = math.Min(d, segmentDist(p, image.Pt(x1, y0), image.Pt(x1, y1)))
+	d = math.Min(d, segmentDist(p, image.Pt(x1, y1), image.Pt(x0, y1)))
+	d = math.Min(d, segmentDist(p, image.Pt(x0, y1), image.Pt(x0, y0)))
+	return d
+}
@@ -0,0 +1,371 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// 图片操作（裁剪/旋转/翻转/扩展画布）作用于底图，并同步变换所有标注。
+// 标注坐标始终是底图的像素坐标：操作后点坐标映射到新图片上，
+// 文本和图片保持正向显示，只移动其中心位置（图片的旋转角度随之调整）。
+
+// imageOpKind 图片操作类型
+type imageOpKind int
+
+const (
+	opCrop   imageOpKind = iota // 裁剪
+	opRotate                    // 顺时针旋转 turns 个 90°
+	opFlipH                     // 水平翻转
+	opFlipV                     // 垂直翻转
+	opPad                       // 扩展画布
+)
+
+// ImageTransform 图片操作对坐标的累计变换：原底图上的坐标 (x, y) 映射为当前底图上的
+// (XX*x + XY*y + X0, YX*x + YY*y + Y0)。坐标为像素边界坐标（像素 (x, y) 占据 x..x+1），
+// 只有旋转/翻转/平移，系数为 0 或 ±1
+type ImageTransform struct {
+	XX, XY, X0 int
+	YX, YY, Y0 int
+}
+
+// IdentityTransform 不做变换
+var IdentityTransform = ImageTransform{XX: 1, YY: 1}
+
+// Apply 映射一个点
+func (t ImageTransform) Apply(p image.Point) image.Point {
+	return image.Pt(t.XX*p.X+t.XY*p.Y+t.X0, t.YX*p.X+t.YY*p.Y+t.Y0)
+}
+
+// Then 先做 t 再做 u 的组合变换
+func (t ImageTransform) Then(u ImageTransform) ImageTransform {
+	return ImageTransform{
+		XX: u.XX*t.XX + u.XY*t.YX,
+		XY: u.XX*t.XY + u.XY*t.YY,
+		X0: u.XX*t.X0 + u.XY*t.Y0 + u.X0,
+		YX: u.YX*t.XX + u.YY*t.YX,
+		YY: u.YX*t.XY + u.YY*t.YY,
+		Y0: u.YX*t.X0 + u.YY*t.Y0 + u.Y0,
+	}
+}
+
+// imageOp 单个图片操作
+type imageOp struct {
+	kind  imageOpKind
+	rect  image.Rectangle // 裁剪区域（opCrop）
+	turns int             // 顺时针旋转次数 1-3（opRotate）
+	pad   image.Rectangle // 四边扩展量：Min 为左/上，Max 为右/下（opPad）
+	fill  color.RGBA      // 扩展区域的颜色（opPad）
+}
+
+// size 操作后的图片尺寸
+func (op imageOp) size(src image.Point) image.Point {
+	switch op.kind {
+	case opCrop:
+		return op.rect.Size()
+	case opRotate:
+		if op.turns%2 == 1 {
+			return image.Pt(src.Y, src.X)
+		}
+	case opPad:
+		return src.Add(op.pad.Min).Add(op.pad.Max)
+	}
+	return src
+}
+
+// mapPoint 将原图坐标映射到操作后的图片（src 为原图尺寸）
+func (op imageOp) mapPoint(p image.Point, src image.Point) image.Point {
+	switch op.kind {
+	case opCrop:
+		return p.Sub(op.rect.Min)
+	case opRotate:
+		for i := 0; i < op.turns; i++ {
+			p = image.Pt(src.Y-1-p.Y, p.X)
+			src = image.Pt(src.Y, src.X)
+		}
+		return p
+	case opFlipH:
+		return image.Pt(src.X-1-p.X, p.Y)
+	case opFlipV:
+		return image.Pt(p.X, src.Y-1-p.Y)
+	case opPad:
+		return p.Add(op.pad.Min)
+	}
+	return p
+}
+
+// mapEdge 将原图中像素边界上的坐标映射到操作后的图片（矩形的 Max 是不包含的边界，
+// 翻转/旋转时按边界映射而不是按像素映射，src 为原图尺寸）
+func (op imageOp) mapEdge(p image.Point, src image.Point) image.Point {
+	return op.transform(src).Apply(p)
+}
+
+// transform 操作对像素边界坐标的变换（src 为原图尺寸）
+func (op imageOp) transform(src image.Point) ImageTransform {
+	switch op.kind {
+	case opCrop:
+		return ImageTransform{XX: 1, X0: -op.rect.Min.X, YY: 1, Y0: -op.rect.Min.Y}
+	case opPad:
+		return ImageTransform{XX: 1, X0: op.pad.Min.X, YY: 1, Y0: op.pad.Min.Y}
+	case opFlipH:
+		return ImageTransform{XX: -1, X0: src.X, YY: 1}
+	case opFlipV:
+		return ImageTransform{XX: 1, YY: -1, Y0: src.Y}
+	case opRotate:
+		t := IdentityTransform
+		for i := 0; i < op.turns; i++ {
+			t = t.Then(ImageTransform{XY: -1, X0: src.Y, YX: 1})
+			src = image.Pt(src.Y, src.X)
+		}
+		return t
+	}
+	return IdentityTransform
+}
+
+// mapRect 将原图中的矩形映射到操作后的图片
+func (op imageOp) mapRect(r image.Rectangle, src image.Point) image.Rectangle {
+	return canonicalRect(op.mapEdge(r.Min, src), op.mapEdge(r.Max, src))
+}
+
+// inverse 可逆操作的逆操作（裁剪不可逆，返回 false）；src 为原图尺寸
+func (op imageOp) inverse(src image.Point) (imageOp, bool) {
+	switch op.kind {
+	case opRotate:
+		return imageOp{kind: opRotate, turns: 4 - op.turns}, true
+	case opFlipH, opFlipV:
+		return op, true
+	case opPad:
+		return imageOp{kind: opCrop, rect: image.Rectangle{Min: op.pad.Min, Max: op.pad.Min.Add(src)}}, true
+	}
+	return imageOp{}, false
+}
+
+// apply 生成操作后的新图片（不修改原图）
+func (op imageOp) apply(src *image.RGBA) *image.RGBA {
+	sb := src.Bounds()
+	size := op.size(sb.Size())
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+
+	switch op.kind {
+	case opCrop:
+		draw.Draw(dst, dst.Bounds(), src, sb.Min.Add(op.rect.Min), draw.Src)
+	case opPad:
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(op.fill), image.Point{}, draw.Src)
+		draw.Draw(dst, image.Rectangle{Min: op.pad.Min, Max: op.pad.Min.Add(sb.Size())}, src, sb.Min, draw.Src)
+	default:
+		// 旋转/翻转：逐像素映射
+		w, h := sb.Dx(), sb.Dy()
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				q := op.mapPoint(image.Pt(x, y), sb.Size())
+				si := src.PixOffset(sb.Min.X+x, sb.Min.Y+y)
+				di := dst.PixOffset(q.X, q.Y)
+				copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+			}
+		}
+	}
+	return dst
+}
+
+// transformAnnotation 将标注映射到操作后的图片上（返回新副本）
+func (op imageOp) transformAnnotation(a Annotation, src image.Point) Annotation {
+	a = a.Clone()
+
+	switch a.Type {
+	case ToolText, ToolImage:
+		// 保持正向显示：只移动中心位置
+		b := a.Bounds()
+		if a.Type == ToolImage && len(a.Points) >= 2 {
+			b = canonicalRect(a.Points[0], a.Points[1])
+		}
+		c := image.Pt((b.Min.X+b.Max.X)/2, (b.Min.Y+b.Max.Y)/2)
+		d := op.mapEdge(c, src).Sub(c)
+		a.Translate(d.X, d.Y)
+
+		if a.Type == ToolImage {
+			switch op.kind {
+			case opRotate:
+				a.Rotation = math.Mod(a.Rotation+float64(op.turns*90), 360)
+			case opFlipH, opFlipV:
+				// 图片内容不镜像，只镜像其倾斜方向
+				a.Rotation = math.Mod(360-a.Rotation, 360)
+			}
+		}
+
+	case ToolRect, ToolEllipse, ToolMosaic:
+		// 两个角点构成的矩形：按边界映射后规范化
+		if len(a.Points) >= 2 {
+			r := op.mapRect(canonicalRect(a.Points[0], a.Points[1]), src)
+			a.Points[0], a.Points[1] = r.Min, r.Max
+		}
+
+	default:
+		for i, p := range a.Points {
+			a.Points[i] = op.mapPoint(p, src)
+		}
+	}
+	return a
+}
+
+// ============================================================================
+// 历史记录
+// ============================================================================
+
+// imageCmd 图片操作命令：变换底图和全部标注
+type imageCmd struct {
+	op         imageOp
+	src        image.Point    // 操作前的底图尺寸
+	before     *image.RGBA    // 操作前的底图（仅不可逆的裁剪保存）
+	transform  ImageTransform // 操作前的累计坐标变换
+	beforeAnns []Annotation   // 操作前的标注列表
+	afterAnns  []Annotation   // 操作后的标注列表
+}
+
+func (c *imageCmd) apply(h *History) {
+	h.image = c.op.apply(h.image)
+	h.transform = c.transform.Then(c.op.transform(c.src))
+	h.annotations = append([]Annotation(nil), c.afterAnns...)
+	h.imageOps++
+}
+
+func (c *imageCmd) revert(h *History) {
+	if inv, ok := c.op.inverse(c.src); ok {
+		h.image = inv.apply(h.image)
+	} else {
+		h.image = c.before
+	}
+	h.annotations = append([]Annotation(nil), c.beforeAnns...)
+	h.transform = c.transform
+	h.imageOps--
+}
+
+func (c *imageCmd) size() int {
+	n := commandOverhead
+	for i := range c.beforeAnns {
+		n += annotationSize(&c.beforeAnns[i])
+	}
+	for i := range c.afterAnns {
+		n += annotationSize(&c.afterAnns[i])
+	}
+	return n
+}
+
+// pixels 裁剪前保存的底图占用的内存（单独计算，不计入标注历史的内存上限）
+func (c *imageCmd) pixels() int {
+	if c.before == nil {
+		return 0
+	}
+	return len(c.before.Pix)
+}
+
+// imageBytes 命令保存的底图占用的内存
+func imageBytes(c command) int {
+	if ic, ok := c.(*imageCmd); ok {
+		return ic.pixels()
+	}
+	return 0
+}
+
+// SetImage 设置底图（不保存撤销点，用于初始化或重新选区）。
+// 已记录的图片操作针对旧底图，重做栈全部丢弃；撤销栈中有生效的图片操作时同样清空撤销栈
+func (h *History) SetImage(img *image.RGBA) {
+	h.image = img
+	h.transform = IdentityTransform
+	clearStack(&h.redoStack)
+	if h.imageOps > 0 {
+		clearStack(&h.undoStack)
+		h.undoBytes = 0
+		h.imageOps = 0
+	}
+	h.imageBytes = 0
+	for _, c := range h.undoStack {
+		h.imageBytes += imageBytes(c)
+	}
+}
+
+// Image 获取当前底图（已应用裁剪/旋转等操作）
+func (h *History) Image() *image.RGBA {
+	return h.image
+}
+
+// ImageTransform 初始底图（SetImage 设置的图片）上的坐标到当前底图坐标的变换
+func (h *History) ImageTransform() ImageTransform {
+	return h.transform
+}
+
+// ImageOps 当前底图上已生效的图片操作数量
+func (h *History) ImageOps() int {
+	return h.imageOps
+}
+
+// Crop 将底图裁剪到矩形 r（底图坐标），完全落在裁剪区域外的标注被移除
+func (h *History) Crop(r image.Rectangle) bool {
+	if h.image == nil {
+		return false
+	}
+	full := image.Rectangle{Max: h.image.Bounds().Size()}
+	r = r.Canon().Intersect(full)
+	if r.Empty() || r == full {
+		return false
+	}
+	return h.applyImageOp(imageOp{kind: opCrop, rect: r})
+}
+
+// Rotate 将底图顺时针旋转 turns 个 90°（负数为逆时针）
+func (h *History) Rotate(turns int) bool {
+	turns = (turns%4 + 4) % 4
+	if h.image == nil || turns == 0 {
+		return false
+	}
+	return h.applyImageOp(imageOp{kind: opRotate, turns: turns})
+}
+
+// Flip 翻转底图（horizontal 为 true 时水平翻转，否则垂直翻转）
+func (h *History) Flip(horizontal bool) bool {
+	if h.image == nil {
+		return false
+	}
+	kind := opFlipV
+	if horizontal {
+		kind = opFlipH
+	}
+	return h.applyImageOp(imageOp{kind: kind})
+}
+
+// Pad 向四周扩展画布，扩展区域填充颜色 fill
+func (h *History) Pad(left, top, right, bottom int, fill color.RGBA) bool {
+	if h.image == nil || left < 0 || top < 0 || right < 0 || bottom < 0 || left+top+right+bottom == 0 {
+		return false
+	}
+	pad := image.Rectangle{Min: image.Pt(left, top), Max: image.Pt(right, bottom)}
+	return h.applyImageOp(imageOp{kind: opPad, pad: pad, fill: fill})
+}
+
+// applyImageOp 执行图片操作并变换所有标注（保存撤销点）
+func (h *History) applyImageOp(op imageOp) bool {
+	src := h.image.Bounds().Size()
+	canvas := image.Rectangle{Max: op.size(src)}
+
+	after := make([]Annotation, 0, len(h.annotations))
+	for _, a := range h.annotations {
+		t := op.transformAnnotation(a, src)
+		if op.kind == opCrop && !t.Bounds().Overlaps(canvas) {
+			continue
+		}
+		after = append(after, t)
+	}
+
+	c := &imageCmd{
+		op:         op,
+		src:        src,
+		transform:  h.transform,
+		beforeAnns: append([]Annotation(nil), h.annotations...),
+		afterAnns:  after,
+	}
+	if op.kind == opCrop {
+		c.before = h.image
+	}
+	h.execute(c)
+	return true
+}
@@ -0,0 +1,40 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestImageTransform 累计变换与图片操作实际移动像素的方式一致
+func TestImageTransform(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 7, 4))
+	marker := image.Pt(2, 1) // 标记像素
+	img.SetRGBA(marker.X, marker.Y, color.RGBA{255, 0, 0, 255})
+
+	h := NewHistory(0)
+	h.SetImage(img)
+	h.Rotate(1)
+	h.Flip(true)
+	h.Pad(3, 1, 0, 2, color.RGBA{})
+	h.Crop(image.Rect(1, 1, 8, 8))
+	h.Rotate(3)
+	h.Flip(false)
+
+	// 像素 (x, y) 占据 x..x+1，变换后的矩形即该像素的新位置
+	tr := h.ImageTransform()
+	p := canonicalRect(tr.Apply(marker), tr.Apply(marker.Add(image.Pt(1, 1)))).Min
+	if c := h.Image().RGBAAt(p.X, p.Y); c.R != 255 {
+		t.Errorf("变换后的位置 %v 不是标记像素", p)
+	}
+
+	for h.Undo() {
+	}
+	if got := h.ImageTransform(); got != IdentityTransform {
+		t.Errorf("全部撤销后变换 = %+v", got)
+	}
+	h.Redo()
+	if got, want := h.ImageTransform().Apply(image.Pt(0, 0)), image.Pt(4, 0); got != want {
+		t.Errorf("重做旋转后 (0,0) -> %v，应为 %v", got, want)
+	}
+}
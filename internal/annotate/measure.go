@@ -0,0 +1,129 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// 测量标注参数
+const (
+	measureLabelGap = 6 // 标签与尺寸线的间距
+)
+
+// measureTickSize 尺寸线两端短横线的半长
+func measureTickSize(lineWidth int) int {
+	return 6 + lineWidth*2
+}
+
+// measureFontSize 测量标签的字号
+func measureFontSize(lineWidth int) int {
+	return 12 + lineWidth*2
+}
+
+// renderMeasure 绘制尺寸线：两点间连线、两端垂直短横线，以及长度标签
+func renderMeasure(img *image.RGBA, a *Annotation) {
+	if len(a.Points) < 2 {
+		return
+	}
+	p0, p1 := a.Points[0], a.Points[1]
+	lw := max(1, a.LineWidth)
+	drawThickLine(img, p0.X, p0.Y, p1.X, p1.Y, a.Color, lw)
+
+	// 两端短横线（垂直于尺寸线）
+	if nx, ny, ok := measureNormal(a); ok {
+		tick := float64(measureTickSize(lw))
+		for _, p := range []image.Point{p0, p1} {
+			dx := int(math.Round(nx * tick))
+			dy := int(math.Round(ny * tick))
+			drawThickLine(img, p.X-dx, p.Y-dy, p.X+dx, p.Y+dy, a.Color, lw)
+		}
+	}
+
+	label := measureLabel(a)
+	renderText(img, &label)
+}
+
+// measureNormal 尺寸线的单位法向量（两点重合时返回 false）
+func measureNormal(a *Annotation) (nx, ny float64, ok bool) {
+	p0, p1 := a.Points[0], a.Points[1]
+	d := pointDist(p0, p1)
+	if d < 1 {
+		return 0, 0, false
+	}
+	return -float64(p1.Y-p0.Y) / d, float64(p1.X-p0.X) / d, true
+}
+
+// measureText 测量标注的长度文字：物理像素，以及按缩放比例换算的逻辑点（缩放比例为 1 时省略）
+func (a *Annotation) measureText() string {
+	if len(a.Points) < 2 {
+		return ""
+	}
+	d := pointDist(a.Points[0], a.Points[1])
+	text := formatLength(d) + "px"
+	if s := a.ScaleFactor; s > 0 && s != 1 {
+		text += " / " + formatLength(d/s) + "pt"
+	}
+	return text
+}
+
+// formatLength 格式化长度：接近整数时不显示小数
+func formatLength(v float64) string {
+	if math.Abs(v-math.Round(v)) < 0.05 {
+		return fmt.Sprintf("%d", int(math.Round(v)))
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// measureLabel 构造测量标签（以标注颜色为背景的文本，位于尺寸线中点上方）
+func measureLabel(a *Annotation) Annotation {
+	label := Annotation{
+		Type:     ToolText,
+		Color:    a.Color,
+		FontSize: measureFontSize(max(1, a.LineWidth)),
+		Text:     a.measureText(),
+		Style:    TextStyle{Background: TextBgMatched},
+	}
+
+	// 先放在原点计算尺寸，再移动到中点
+	label.Points = []image.Point{{}}
+	box := textBox(&label)
+	p0, p1 := a.Points[0], a.Points[1]
+	mid := image.Pt((p0.X+p1.X)/2, (p0.Y+p1.Y)/2)
+
+	// 沿法线方向偏移，避免遮住尺寸线：优先放在上方，竖直的尺寸线放在右侧
+	center := mid
+	if nx, ny, ok := measureNormal(a); ok {
+		if ny > 0 || (ny == 0 && nx < 0) {
+			nx, ny = -nx, -ny
+		}
+		dist := math.Abs(nx)*float64(box.Dx())/2 + math.Abs(ny)*float64(box.Dy())/2 + measureLabelGap
+		center = mid.Add(image.Pt(int(math.Round(nx*dist)), int(math.Round(ny*dist))))
+	}
+	label.Points[0] = center.Sub(image.Pt(box.Dx()/2, box.Dy()/2)).Sub(box.Min)
+	return label
+}
+
+// measureBounds 测量标注的范围（尺寸线、短横线和标签）
+func measureBounds(a *Annotation) image.Rectangle {
+	if len(a.Points) < 2 {
+		return image.Rectangle{}
+	}
+	pad := measureTickSize(max(1, a.LineWidth)) + a.LineWidth/2 + 1
+	r := canonicalRect(a.Points[0], a.Points[1]).Inset(-pad)
+	label := measureLabel(a)
+	return r.Union(textBox(&label))
+}
+
+// measureContains 点 p 是否落在尺寸线或标签上
+func measureContains(a *Annotation, p image.Point, tolerance int) bool {
+	if len(a.Points) < 2 {
+		return false
+	}
+	tol := float64(tolerance) + float64(a.LineWidth)/2
+	if segmentDist(p, a.Points[0], a.Points[1]) <= tol {
+		return true
+	}
+	label := measureLabel(a)
+	return p.In(textBox(&label))
+}
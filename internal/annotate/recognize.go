@@ -0,0 +1,228 @@
+package annotate
+
+import (
+	"image"
+	"math"
+)
+
+// 形状识别参数
+const (
+	recognizeMinSize     = 12   // 可识别图形的最小尺寸（像素）
+	recognizeClosedRatio = 0.18 // 首尾距离 / 路径长度 小于该值视为闭合笔迹
+	recognizeLineTol     = 0.06 // 直线允许的最大偏离（相对弦长）
+	recognizeLineTolMin  = 4.0  // 直线允许的最小偏离（像素）
+	recognizeLineWobble  = 1.15 // 直线路径长度 / 弦长 的上限
+	recognizeShapeTol    = 0.08 // 闭合图形允许的平均误差（相对短边）
+	recognizeShapeTolMin = 3.0  // 闭合图形允许的最小平均误差（像素）
+	recognizeThinRatio   = 0.15 // 闭合图形短边 / 长边 的下限（过扁视为来回涂画）
+	recognizeArrowMinLen = 30.0 // 箭头杆的最小长度
+)
+
+// RecognizeShape 识别手绘笔迹是否接近规则图形（矩形/椭圆/直线/箭头）
+// 识别成功时返回对应的工具类型和规整后的控制点：
+// 矩形/椭圆为外接矩形的两个对角点，直线/箭头为起点和终点
+func RecognizeShape(points []image.Point) (ToolType, []image.Point, bool) {
+	if len(points) < 3 {
+		return 0, nil, false
+	}
+
+	pathLen := polylineLength(points)
+	if pathLen < recognizeMinSize {
+		return 0, nil, false
+	}
+
+	start := points[0]
+	end := points[len(points)-1]
+	gap := pointDist(start, end)
+
+	// 闭合笔迹：矩形或椭圆
+	if gap < pathLen*recognizeClosedRatio {
+		return recognizeClosed(points)
+	}
+
+	// 直线：所有点都贴近首尾连线
+	if isStraightStroke(points) {
+		return ToolLine, []image.Point{start, end}, true
+	}
+
+	// 箭头：一段直线后接折回的箭头头部
+	if tip, ok := recognizeArrow(points); ok {
+		return ToolArrow, []image.Point{start, tip}, true
+	}
+
+	return 0, nil, false
+}
+
+// recognizeClosed 判断闭合笔迹更接近矩形还是椭圆
+func recognizeClosed(points []image.Point) (ToolType, []image.Point, bool) {
+	b := pointsBounds(points)
+	w, h := b.Dx(), b.Dy()
+	if w < recognizeMinSize || h < recognizeMinSize {
+		return 0, nil, false
+	}
+	minSide, maxSide := w, h
+	if minSide > maxSide {
+		minSide, maxSide = maxSide, minSide
+	}
+	if float64(minSide) < float64(maxSide)*recognizeThinRatio {
+		return 0, nil, false
+	}
+
+	cx := float64(b.Min.X+b.Max.X) / 2
+	cy := float64(b.Min.Y+b.Max.Y) / 2
+	rx := float64(w) / 2
+	ry := float64(h) / 2
+
+	var rectErr, ellipseErr float64
+	for _, p := range points {
+		// 到外接矩形最近一条边的距离
+		d := math.Min(
+			math.Min(math.Abs(float64(p.X-b.Min.X)), math.Abs(float64(p.X-b.Max.X))),
+			math.Min(math.Abs(float64(p.Y-b.Min.Y)), math.Abs(float64(p.Y-b.Max.Y))),
+		)
+		rectErr += d
+		ellipseErr += ellipsePointDist(float64(p.X), float64(p.Y), cx, cy, rx, ry)
+	}
+	n := float64(len(points))
+	rectErr /= n
+	ellipseErr /= n
+
+	tol := math.Max(recognizeShapeTolMin, float64(minSide)*recognizeShapeTol)
+	pts := []image.Point{b.Min, b.Max}
+	switch {
+	case rectErr <= ellipseErr && rectErr <= tol:
+		return ToolRect, pts, true
+	case ellipseErr < rectErr && ellipseErr <= tol:
+		return ToolEllipse, pts, true
+	}
+	return 0, nil, false
+}
+
+// isStraightStroke 判断笔迹是否为直线
+func isStraightStroke(points []image.Point) bool {
+	start := points[0]
+	end := points[len(points)-1]
+	chord := pointDist(start, end)
+	if chord < recognizeMinSize {
+		return false
+	}
+	if polylineLength(points) > chord*recognizeLineWobble {
+		return false
+	}
+	tol := math.Max(recognizeLineTolMin, chord*recognizeLineTol)
+	for _, p := range points {
+		if segmentDist(p, start, end) > tol {
+			return false
+		}
+	}
+	return true
+}
+
+// recognizeArrow 识别单笔画出的箭头：从尾部画到尖端，再折回画出箭头两翼
+// 返回箭头尖端位置
+func recognizeArrow(points []image.Point) (image.Point, bool) {
+	start := points[0]
+
+	// 离起点最远的点视为箭头尖端
+	tipIdx := 0
+	tipDist := 0.0
+	for i, p := range points {
+		if d := pointDist(start, p); d > tipDist {
+			tipIdx, tipDist = i, d
+		}
+	}
+	if tipDist < recognizeArrowMinLen || tipIdx >= len(points)-2 {
+		return image.Point{}, false
+	}
+	tip := points[tipIdx]
+
+	// 箭头杆必须是直线
+	if !isStraightStroke(points[:tipIdx+1]) {
+		return image.Point{}, false
+	}
+
+	// 箭头头部：长度适中，整体位于尖端后方，且至少有一翼明显偏离箭杆
+	head := points[tipIdx:]
+	headLen := polylineLength(head)
+	if headLen < tipDist*0.1 || headLen > tipDist*0.8 {
+		return image.Point{}, false
+	}
+
+	ux := float64(tip.X-start.X) / tipDist
+	uy := float64(tip.Y-start.Y) / tipDist
+	maxSide := 0.0
+	for _, p := range head {
+		vx := float64(p.X - tip.X)
+		vy := float64(p.Y - tip.Y)
+		if math.Hypot(vx, vy) > tipDist*0.45 {
+			return image.Point{}, false
+		}
+		if vx*ux+vy*uy > recognizeLineTolMin {
+			return image.Point{}, false
+		}
+		if side := math.Abs(vx*uy - vy*ux); side > maxSide {
+			maxSide = side
+		}
+	}
+	if maxSide < math.Max(recognizeLineTolMin, tipDist*0.05) {
+		return image.Point{}, false
+	}
+
+	return tip, true
+}
+
+// ---------- 几何辅助函数 ----------
+
+// pointDist 两点间距离
+func pointDist(a, b image.Point) float64 {
+	return math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))
+}
+
+// polylineLength 折线总长度
+func polylineLength(points []image.Point) float64 {
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		total += pointDist(points[i-1], points[i])
+	}
+	return total
+}
+
+// segmentDist 点到线段的距离
+func segmentDist(p, a, b image.Point) float64 {
+	dx := float64(b.X - a.X)
+	dy := float64(b.Y - a.Y)
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return pointDist(p, a)
+	}
+	t := (float64(p.X-a.X)*dx + float64(p.Y-a.Y)*dy) / lenSq
+	if t < 0 {
+		t = 0
+	} else if t > 1 {
+		t = 1
+	}
+	return math.Hypot(float64(a.X)+t*dx-float64(p.X), float64(a.Y)+t*dy-float64(p.Y))
+}
+
+// pointsBounds 点集的外接矩形（Max 为包含的最大坐标）
+func pointsBounds(points []image.Point) image.Rectangle {
+	if len(points) == 0 {
+		return image.Rectangle{}
+	}
+	r := image.Rectangle{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		if p.X < r.Min.X {
+			r.Min.X = p.X
+		}
+		if p.Y < r.Min.Y {
+			r.Min.Y = p.Y
+		}
+		if p.X > r.Max.X {
+			r.Max.X = p.X
+		}
+		if p.Y > r.Max.Y {
+			r.Max.Y = p.Y
+		}
+	}
+	return r
+}
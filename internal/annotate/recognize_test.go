@@ -0,0 +1,69 @@
+package annotate
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// polyline 沿顶点依次插值生成笔迹（相邻点间隔约 step 像素）
+func polyline(step int, vertices ...image.Point) []image.Point {
+	pts := []image.Point{vertices[0]}
+	for i := 1; i < len(vertices); i++ {
+		a, b := vertices[i-1], vertices[i]
+		n := max(1, int(pointDist(a, b))/step)
+		for k := 1; k <= n; k++ {
+			pts = append(pts, image.Pt(a.X+(b.X-a.X)*k/n, a.Y+(b.Y-a.Y)*k/n))
+		}
+	}
+	return pts
+}
+
+// circle 圆形笔迹
+func circle(cx, cy, r, n int) []image.Point {
+	pts := make([]image.Point, 0, n+1)
+	for i := 0; i <= n; i++ {
+		t := 2 * math.Pi * float64(i) / float64(n)
+		pts = append(pts, image.Pt(cx+int(math.Round(float64(r)*math.Cos(t))), cy+int(math.Round(float64(r)*math.Sin(t)))))
+	}
+	return pts
+}
+
+func TestRecognizeShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []image.Point
+		ok     bool
+		tool   ToolType
+		want   []image.Point // 规整后的控制点（nil 表示不检查）
+	}{
+		{"闭合正方形", polyline(5, image.Pt(10, 10), image.Pt(110, 10), image.Pt(110, 110), image.Pt(10, 110), image.Pt(10, 12)),
+			true, ToolRect, []image.Point{{10, 10}, {110, 110}}},
+		{"圆形", circle(100, 100, 50, 64), true, ToolEllipse, []image.Point{{50, 50}, {150, 150}}},
+		{"接近直线", polyline(5, image.Pt(0, 0), image.Pt(50, 2), image.Pt(100, 3)),
+			true, ToolLine, []image.Point{{0, 0}, {100, 3}}},
+		{"带钩的箭头", polyline(5, image.Pt(0, 0), image.Pt(100, 0), image.Pt(85, -12)),
+			true, ToolArrow, []image.Point{{0, 0}, {100, 0}}},
+		{"点太少", []image.Point{{0, 0}, {100, 100}}, false, 0, nil},
+		{"太短", polyline(1, image.Pt(0, 0), image.Pt(5, 3), image.Pt(2, 6)), false, 0, nil},
+		{"来回涂画", polyline(5, image.Pt(0, 0), image.Pt(80, 60), image.Pt(0, 60), image.Pt(80, 0), image.Pt(10, 40), image.Pt(90, 20)), false, 0, nil},
+		{"过扁的闭合笔迹", polyline(5, image.Pt(0, 0), image.Pt(200, 0), image.Pt(200, 10), image.Pt(0, 10), image.Pt(0, 1)), false, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, pts, ok := RecognizeShape(tt.points)
+			if ok != tt.ok {
+				t.Fatalf("RecognizeShape ok = %v，应为 %v（工具 %v）", ok, tt.ok, tool)
+			}
+			if !ok {
+				return
+			}
+			if tool != tt.tool {
+				t.Errorf("工具 = %s，应为 %s", ToolName[tool], ToolName[tt.tool])
+			}
+			if tt.want != nil && (len(pts) != len(tt.want) || pts[0] != tt.want[0] || pts[1] != tt.want[1]) {
+				t.Errorf("控制点 = %v，应为 %v", pts, tt.want)
+			}
+		})
+	}
+}
@@ -7,14 +7,14 @@ import (
 	"math"
 )
 
-// RenderAnnotations 将所有标注渲染到基础图片的副本上
+// RenderAnnotations 将所有标注按 z 序渲染到基础图片的副本上（分组作为整体绘制）
 func RenderAnnotations(base *image.RGBA, annotations []Annotation) *image.RGBA {
 	// 创建副本，避免修改原图
 	bounds := base.Bounds()
 	result := image.NewRGBA(bounds)
 	draw.Draw(result, bounds, base, bounds.Min, draw.Src)
 
-	for i := range annotations {
+	for _, i := range drawOrder(annotations) {
 		RenderSingleAnnotation(result, &annotations[i])
 	}
 	return result
@@ -22,6 +22,16 @@ func RenderAnnotations(base *image.RGBA, annotations []Annotation) *image.RGBA {
 
 // RenderSingleAnnotation 将单个标注渲染到图片上（用于实时预览）
 func RenderSingleAnnotation(img *image.RGBA, a *Annotation) {
+	alpha := a.alpha()
+	if alpha == 255 && !a.Outline {
+		renderShape(img, a)
+		return
+	}
+	renderLayered(img, a, alpha)
+}
+
+// renderShape 按类型直接绘制标注
+func renderShape(img *image.RGBA, a *Annotation) {
 	switch a.Type {
 	case ToolRect:
 		renderRect(img, a)
@@ -37,7 +47,181 @@ func RenderSingleAnnotation(img *image.RGBA, a *Annotation) {
 		renderEllipse(img, a)
 	case ToolMosaic:
 		renderMosaic(img, a)
+	case ToolImage:
+		renderImage(img, a)
+	case ToolMeasure:
+		renderMeasure(img, a)
+	}
+}
+
+// ---------- 不透明度与轮廓 ----------
+
+// alpha 标注整体的不透明度 (0-255)
+func (a *Annotation) alpha() uint8 {
+	if a.Opacity <= 0 || a.Opacity >= 100 {
+		return 255
+	}
+	return uint8(a.Opacity * 255 / 100)
+}
+
+// outlineWidth 轮廓宽度
+func (a *Annotation) outlineWidth() int {
+	if a.OutlineWidth > 0 {
+		return a.OutlineWidth
+	}
+	if a.Type == ToolText {
+		return max(1, a.FontSize/12)
+	}
+	return max(2, a.LineWidth/2)
+}
+
+// outlineColor 轮廓颜色（未指定时取与标注颜色对比明显的黑色或白色）
+func (a *Annotation) outlineColor() color.RGBA {
+	if a.OutlineColor.A != 0 {
+		return a.OutlineColor
+	}
+	return contrastColor(a.Color)
+}
+
+// contrastColor 根据亮度返回与 c 对比明显的黑色或白色
+func contrastColor(c color.RGBA) color.RGBA {
+	if luminance(c) > 0.6 {
+		return color.RGBA{0, 0, 0, 255}
 	}
+	return color.RGBA{255, 255, 255, 255}
+}
+
+// luminance 相对亮度 (0-1)
+func luminance(c color.RGBA) float64 {
+	return (0.2126*float64(c.R) + 0.7152*float64(c.G) + 0.0722*float64(c.B)) / 255
+}
+
+// renderLayered 先在独立图层上绘制标注（及轮廓），再按不透明度整体混合到图片上，
+// 避免笔迹重叠处因逐段混合而颜色加深
+func renderLayered(img *image.RGBA, a *Annotation, alpha uint8) {
+	pad := 2
+	if a.Outline {
+		pad += a.outlineWidth()
+	}
+	region := a.Bounds().Inset(-pad).Intersect(img.Bounds())
+	if region.Empty() {
+		return
+	}
+	mask := image.NewUniform(color.Alpha{A: alpha})
+
+	// 马赛克依赖底图像素：在副本上处理后按不透明度混合
+	if a.Type == ToolMosaic {
+		layer := image.NewRGBA(region)
+		draw.Draw(layer, region, img, region.Min, draw.Src)
+		renderMosaic(layer, a)
+		draw.DrawMask(img, region, layer, region.Min, mask, image.Point{}, draw.Over)
+		return
+	}
+
+	// 文本背景框不参与轮廓，单独绘制在底层
+	layer := image.NewRGBA(region)
+	fg := layer
+	if a.Type == ToolText {
+		textFg, textBg := textColors(img, a)
+		renderTextBackground(layer, a, textBg)
+		fg = image.NewRGBA(region)
+		renderTextGlyphs(fg, a, textFg)
+	} else {
+		renderShape(fg, a)
+	}
+
+	// 轮廓位于笔迹下方
+	if a.Outline {
+		halo := haloLayer(fg, a.outlineWidth(), a.outlineColor())
+		if fg != layer {
+			draw.Draw(layer, region, halo, region.Min, draw.Over)
+		} else {
+			draw.Draw(halo, region, layer, region.Min, draw.Over)
+			layer = halo
+		}
+	}
+	if fg != layer {
+		draw.Draw(layer, region, fg, region.Min, draw.Over)
+	}
+
+	draw.DrawMask(img, region, layer, region.Min, mask, image.Point{}, draw.Over)
+}
+
+// haloLayer 生成 fg 笔迹外围宽度为 width 的轮廓图层
+// fg 中不透明度过半的像素视为笔迹（半透明填充不产生轮廓），
+// 使用两遍扫描的距离变换求每个像素到笔迹的距离，边缘做抗锯齿
+func haloLayer(fg *image.RGBA, width int, c color.RGBA) *image.RGBA {
+	b := fg.Bounds()
+	w, h := b.Dx(), b.Dy()
+	const inf = float32(1 << 20)
+	const diag = float32(math.Sqrt2)
+
+	dist := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if fg.Pix[y*fg.Stride+x*4+3] >= 128 {
+				dist[y*w+x] = 0
+			} else {
+				dist[y*w+x] = inf
+			}
+		}
+	}
+
+	// 正向扫描
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := dist[y*w+x]
+			if x > 0 {
+				d = min(d, dist[y*w+x-1]+1)
+			}
+			if y > 0 {
+				d = min(d, dist[(y-1)*w+x]+1)
+				if x > 0 {
+					d = min(d, dist[(y-1)*w+x-1]+diag)
+				}
+				if x < w-1 {
+					d = min(d, dist[(y-1)*w+x+1]+diag)
+				}
+			}
+			dist[y*w+x] = d
+		}
+	}
+	// 反向扫描
+	for y := h - 1; y >= 0; y-- {
+		for x := w - 1; x >= 0; x-- {
+			d := dist[y*w+x]
+			if x < w-1 {
+				d = min(d, dist[y*w+x+1]+1)
+			}
+			if y < h-1 {
+				d = min(d, dist[(y+1)*w+x]+1)
+				if x < w-1 {
+					d = min(d, dist[(y+1)*w+x+1]+diag)
+				}
+				if x > 0 {
+					d = min(d, dist[(y+1)*w+x-1]+diag)
+				}
+			}
+			dist[y*w+x] = d
+		}
+	}
+
+	halo := image.NewRGBA(b)
+	r := float32(width)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			d := dist[y*w+x]
+			if d > r+0.5 {
+				continue
+			}
+			cov := float32(1)
+			if d > r-0.5 {
+				cov = r + 0.5 - d
+			}
+			setPixelBlend(halo, b.Min.X+x, b.Min.Y+y, color.RGBA{c.R, c.G, c.B, uint8(float32(c.A) * cov)})
+		}
+	}
+	return halo
 }
 
 // ---------- 矩形 ----------
@@ -96,10 +280,7 @@ func renderArrow(img *image.RGBA, a *Annotation) {
 	}
 
 	// 箭头大小与线宽成比例
-	arrowLen := float64(a.LineWidth) * 5
-	if arrowLen < 12 {
-		arrowLen = 12
-	}
+	arrowLen := float64(arrowHeadSize(a.LineWidth))
 	arrowWidth := arrowLen * 0.5
 
 	// 单位方向向量
@@ -128,6 +309,15 @@ func renderArrow(img *image.RGBA, a *Annotation) {
 	drawFilledTriangle(img, tip, left, right, a.Color)
 }
 
+// arrowHeadSize 箭头头部长度（与线宽成比例）
+func arrowHeadSize(lineWidth int) int {
+	size := lineWidth * 5
+	if size < 12 {
+		size = 12
+	}
+	return size
+}
+
 // ---------- 直线 ----------
 
 func renderLine(img *image.RGBA, a *Annotation) {
@@ -143,60 +333,128 @@ func renderText(img *image.RGBA, a *Annotation) {
 	if len(a.Points) < 1 || a.Text == "" {
 		return
 	}
+	fg, bg := textColors(img, a)
+	renderTextBackground(img, a, bg)
+	renderTextGlyphs(img, a, fg)
+}
 
-	fontSize := a.FontSize
-	if fontSize <= 0 {
-		fontSize = 16
+// textColors 确定文字颜色和背景颜色（背景 A=0 表示无背景）
+// img 为文本下方的图像，用于自动配色时计算背景亮度
+func textColors(img *image.RGBA, a *Annotation) (fg, bg color.RGBA) {
+	fg = a.Color
+	if fg.A == 0 {
+		fg = color.RGBA{255, 255, 255, 255}
 	}
 
-	// 简单位图字体：每个字符的宽高
-	charW := fontSize * 3 / 5 // 字符宽度约为字号的 0.6
-	charH := fontSize
+	switch a.Style.Background {
+	case TextBgDefault:
+		bg = color.RGBA{0, 0, 0, 160}
+	case TextBgSolid, TextBgRounded:
+		bg = a.Style.BgColor
+		if bg.A == 0 {
+			bg = color.RGBA{0, 0, 0, 160}
+		}
+	case TextBgMatched:
+		bg = fg
+		fg = contrastColor(bg)
+	}
+
+	// 自动配色：按文字实际所处背景（背景框叠加在原图上）的亮度选择黑/白
+	if a.Style.AutoColor {
+		under := averageColor(img, textBox(a))
+		fg = contrastColor(blendOver(bg, under))
+	}
+	return fg, bg
+}
+
+// renderTextBackground 绘制文本背景框
+func renderTextBackground(img *image.RGBA, a *Annotation, bg color.RGBA) {
+	if len(a.Points) < 1 || a.Text == "" || bg.A == 0 {
+		return
+	}
+	box := textBox(a)
+	if a.Style.Background == TextBgRounded || a.Style.Background == TextBgMatched {
+		fillRoundRect(img, box, min(layoutText(a).charH/2, box.Dy()/2), bg)
+		return
+	}
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			setPixelBlend(img, x, y, bg)
+		}
+	}
+}
+
+// renderTextGlyphs 按排版结果绘制文本字符
+func renderTextGlyphs(img *image.RGBA, a *Annotation, c color.RGBA) {
+	if len(a.Points) < 1 || a.Text == "" {
+		return
+	}
 
+	l := layoutText(a)
 	x0 := a.Points[0].X
 	y0 := a.Points[0].Y
 
-	// 计算文本总宽度和高度（支持多行）
-	lines := splitLines(a.Text)
-	maxWidth := 0
-	for _, line := range lines {
-		w := len(line) * charW
-		if w > maxWidth {
-			maxWidth = w
-		}
+	// 普通样式直接绘制
+	if !a.Style.Bold && !a.Style.Hollow {
+		drawTextLines(img, l, x0, y0, c)
+		return
 	}
-	totalH := len(lines) * charH
 
-	// 绘制文本背景（半透明黑色）
-	padding := 4
-	bgColor := color.RGBA{0, 0, 0, 160}
-	for y := y0 - padding; y < y0+totalH+padding; y++ {
-		for x := x0 - padding; x < x0+maxWidth+padding; x++ {
-			setPixelBlend(img, x, y, bgColor)
-		}
+	// 粗体/空心字：先绘制到独立图层，再对字形做加粗、挖空处理
+	area := image.Rect(x0, y0, x0+l.width, y0+len(l.lines)*l.charH)
+	glyphs := image.NewRGBA(area)
+	drawTextLines(glyphs, l, x0, y0, color.RGBA{255, 255, 255, 255})
+
+	ink := glyphMask(glyphs)
+	w, h := area.Dx(), area.Dy()
+	if a.Style.Bold {
+		ink = dilateRows(ink, w, h, l.advance-l.charW)
+	}
+	if a.Style.Hollow {
+		ink = hollowMask(ink, w, h, max(1, l.charH/16))
 	}
 
-	// 绘制文本
-	textColor := a.Color
-	if textColor.A == 0 {
-		textColor = color.RGBA{255, 255, 255, 255}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if ink[y*w+x] {
+				setPixelBlend(img, area.Min.X+x, area.Min.Y+y, c)
+			}
+		}
 	}
+}
 
-	for lineIdx, line := range lines {
-		cy := y0 + lineIdx*charH
-		cx := x0
+// drawTextLines 在 (x0, y0) 处逐行绘制排版后的文本
+func drawTextLines(img *image.RGBA, l textLayout, x0, y0 int, c color.RGBA) {
+	for lineIdx, line := range l.lines {
+		cy := y0 + lineIdx*l.charH
+		cx := x0 + l.offsets[lineIdx]
 		for _, ch := range line {
 			if ch > 127 {
 				// 非 ASCII 字符：绘制占位方块
-				drawCharBlock(img, cx, cy, charW, charH, textColor)
+				drawCharBlock(img, cx, cy, l.charW, l.charH, c)
 			} else {
-				drawBitmapChar(img, cx, cy, charW, charH, byte(ch), textColor)
+				drawBitmapChar(img, cx, cy, l.charW, l.charH, byte(ch), c)
 			}
-			cx += charW
+			cx += l.advance
 		}
 	}
 }
 
+// textPadding 文本背景框的内边距
+const textPadding = 4
+
+// textBox 计算文本背景框的范围（支持多行）
+func textBox(a *Annotation) image.Rectangle {
+	if len(a.Points) < 1 {
+		return image.Rectangle{}
+	}
+	l := layoutText(a)
+	totalH := len(l.lines) * l.charH
+
+	x0, y0 := a.Points[0].X, a.Points[0].Y
+	return image.Rect(x0-textPadding, y0-textPadding, x0+l.width+textPadding, y0+totalH+textPadding)
+}
+
 // splitLines 按换行符拆分字符串
 func splitLines(s string) []string {
 	var lines []string
@@ -838,6 +1096,53 @@ func setPixelBlend(img *image.RGBA, x, y int, c color.RGBA) {
 	img.Pix[off+3] = uint8(srcA + uint32(img.Pix[off+3])*invA/255)
 }
 
+// fillRoundRect 填充抗锯齿圆角矩形
+func fillRoundRect(img *image.RGBA, r image.Rectangle, radius int, c color.RGBA) {
+	rad := float64(radius)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// 到最近圆角圆心的偏移（不在圆角区域时为 0）
+			dx := max(float64(r.Min.X)+rad-(float64(x)+0.5), (float64(x)+0.5)-(float64(r.Max.X)-rad), 0)
+			dy := max(float64(r.Min.Y)+rad-(float64(y)+0.5), (float64(y)+0.5)-(float64(r.Max.Y)-rad), 0)
+			cov := rad + 0.5 - math.Hypot(dx, dy)
+			if dx == 0 || dy == 0 || cov >= 1 {
+				setPixelBlend(img, x, y, c)
+			} else if cov > 0 {
+				setPixelBlend(img, x, y, color.RGBA{c.R, c.G, c.B, uint8(float64(c.A) * cov)})
+			}
+		}
+	}
+}
+
+// averageColor 计算图像在矩形范围内的平均颜色
+func averageColor(img *image.RGBA, r image.Rectangle) color.RGBA {
+	r = r.Intersect(img.Bounds())
+	if r.Empty() {
+		return color.RGBA{0, 0, 0, 255}
+	}
+	var sr, sg, sb uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		off := img.PixOffset(r.Min.X, y)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sr += uint64(img.Pix[off+0])
+			sg += uint64(img.Pix[off+1])
+			sb += uint64(img.Pix[off+2])
+			off += 4
+		}
+	}
+	n := uint64(r.Dx() * r.Dy())
+	return color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), 255}
+}
+
+// blendOver 将半透明颜色 c 叠加到不透明颜色 under 上
+func blendOver(c, under color.RGBA) color.RGBA {
+	a := uint32(c.A)
+	mix := func(top, bottom uint8) uint8 {
+		return uint8((uint32(top)*a + uint32(bottom)*(255-a)) / 255)
+	}
+	return color.RGBA{mix(c.R, under.R), mix(c.G, under.G), mix(c.B, under.B), 255}
+}
+
 // ========== 通用辅助函数 ==========
 
 // canonicalRect 将两个点转换为规范化的矩形（保证 Min <= Max）
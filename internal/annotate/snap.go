@@ -0,0 +1,121 @@
+package annotate
+
+import (
+	"image"
+	"math"
+)
+
+// SnapOptions 吸附参数
+type SnapOptions struct {
+	Grid      int // 网格间距（0 表示不吸附网格）
+	Threshold int // 吸附到其他标注边缘/中心的距离阈值（0 表示不吸附标注）
+}
+
+// SnapGuide 吸附参考线（对齐到其他标注时显示）
+type SnapGuide struct {
+	Vertical bool // true 为竖线 x=Pos，false 为横线 y=Pos
+	Pos      int
+}
+
+// SnapPoint 将点吸附到其他标注的边缘/中心（优先）或网格，exclude 为不参与吸附的标注索引
+func SnapPoint(p image.Point, annotations []Annotation, exclude []int, opts SnapOptions) (image.Point, []SnapGuide) {
+	xs, ys := snapTargets(annotations, exclude)
+	var guides []SnapGuide
+
+	if d, pos, ok := snapAxis([]int{p.X}, xs, opts.Threshold); ok {
+		p.X += d
+		guides = append(guides, SnapGuide{Vertical: true, Pos: pos})
+	} else {
+		p.X = snapGrid(p.X, opts.Grid)
+	}
+	if d, pos, ok := snapAxis([]int{p.Y}, ys, opts.Threshold); ok {
+		p.Y += d
+		guides = append(guides, SnapGuide{Pos: pos})
+	} else {
+		p.Y = snapGrid(p.Y, opts.Grid)
+	}
+	return p, guides
+}
+
+// SnapRect 计算移动矩形 r 所需的偏移，使其边缘或中心与其他标注对齐（优先）或左上角落在网格上
+func SnapRect(r image.Rectangle, annotations []Annotation, exclude []int, opts SnapOptions) (image.Point, []SnapGuide) {
+	xs, ys := snapTargets(annotations, exclude)
+	var off image.Point
+	var guides []SnapGuide
+
+	if d, pos, ok := snapAxis([]int{r.Min.X, (r.Min.X + r.Max.X) / 2, r.Max.X}, xs, opts.Threshold); ok {
+		off.X = d
+		guides = append(guides, SnapGuide{Vertical: true, Pos: pos})
+	} else {
+		off.X = snapGrid(r.Min.X, opts.Grid) - r.Min.X
+	}
+	if d, pos, ok := snapAxis([]int{r.Min.Y, (r.Min.Y + r.Max.Y) / 2, r.Max.Y}, ys, opts.Threshold); ok {
+		off.Y = d
+		guides = append(guides, SnapGuide{Pos: pos})
+	} else {
+		off.Y = snapGrid(r.Min.Y, opts.Grid) - r.Min.Y
+	}
+	return off, guides
+}
+
+// SnapAngle 将 to 吸附到从 from 出发的 0°/45°/90° 方向上（保持投影长度）
+func SnapAngle(from, to image.Point) image.Point {
+	dx := float64(to.X - from.X)
+	dy := float64(to.Y - from.Y)
+	if dx == 0 && dy == 0 {
+		return to
+	}
+	step := math.Pi / 4
+	angle := math.Round(math.Atan2(dy, dx)/step) * step
+	ux, uy := math.Cos(angle), math.Sin(angle)
+	length := dx*ux + dy*uy
+	return image.Point{
+		X: from.X + int(math.Round(ux*length)),
+		Y: from.Y + int(math.Round(uy*length)),
+	}
+}
+
+// snapTargets 收集其他标注的左/中/右 x 坐标和上/中/下 y 坐标
+func snapTargets(annotations []Annotation, exclude []int) (xs, ys []int) {
+	skip := make(map[int]bool, len(exclude))
+	for _, i := range exclude {
+		skip[i] = true
+	}
+	for i := range annotations {
+		if skip[i] {
+			continue
+		}
+		b := annotations[i].Bounds()
+		if b.Empty() {
+			continue
+		}
+		xs = append(xs, b.Min.X, (b.Min.X+b.Max.X)/2, b.Max.X)
+		ys = append(ys, b.Min.Y, (b.Min.Y+b.Max.Y)/2, b.Max.Y)
+	}
+	return xs, ys
+}
+
+// snapAxis 在 targets 中寻找与 vals 中任一值距离最近且不超过 threshold 的目标，
+// 返回使该值对齐所需的偏移量和目标坐标
+func snapAxis(vals, targets []int, threshold int) (delta, pos int, ok bool) {
+	if threshold <= 0 {
+		return 0, 0, false
+	}
+	best := threshold + 1
+	for _, v := range vals {
+		for _, t := range targets {
+			if d := abs(t - v); d < best {
+				best, delta, pos, ok = d, t-v, t, true
+			}
+		}
+	}
+	return delta, pos, ok
+}
+
+// snapGrid 将坐标吸附到最近的网格线
+func snapGrid(v, grid int) int {
+	if grid <= 0 {
+		return v
+	}
+	return int(math.Round(float64(v)/float64(grid))) * grid
+}
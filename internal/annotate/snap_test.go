@@ -0,0 +1,83 @@
+package annotate
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSnapAngle(t *testing.T) {
+	from := image.Pt(10, 10)
+	tests := []struct {
+		to, want image.Point
+	}{
+		{image.Pt(110, 14), image.Pt(110, 10)},   // 水平
+		{image.Pt(13, -90), image.Pt(10, -90)},   // 垂直
+		{image.Pt(108, 112), image.Pt(110, 110)}, // 45°（保持投影长度）
+		{image.Pt(-90, 106), image.Pt(-88, 108)}, // 135°
+		{from, from},
+	}
+	for _, tt := range tests {
+		if got := SnapAngle(from, tt.to); got != tt.want {
+			t.Errorf("SnapAngle(%v, %v) = %v，应为 %v", from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestSnapGrid(t *testing.T) {
+	tests := []struct{ v, grid, want int }{
+		{13, 10, 10},
+		{15, 10, 20},
+		{-6, 10, -10},
+		{13, 0, 13},
+	}
+	for _, tt := range tests {
+		if got := snapGrid(tt.v, tt.grid); got != tt.want {
+			t.Errorf("snapGrid(%d, %d) = %d，应为 %d", tt.v, tt.grid, got, tt.want)
+		}
+	}
+}
+
+func TestSnapPoint(t *testing.T) {
+	// 矩形标注边界为 (100,100)-(200,150)，中心 (150,125)
+	anns := []Annotation{{Type: ToolRect, Points: []image.Point{{100, 100}, {200, 150}}}}
+	opts := SnapOptions{Grid: 10, Threshold: 5}
+	b := anns[0].Bounds()
+
+	tests := []struct {
+		name    string
+		p       image.Point
+		exclude []int
+		want    image.Point
+		guides  int
+	}{
+		{"对齐标注左边和中心", image.Pt(b.Min.X+3, (b.Min.Y+b.Max.Y)/2-4), nil, image.Pt(b.Min.X, (b.Min.Y+b.Max.Y)/2), 2},
+		{"远离标注时吸附网格", image.Pt(33, 47), nil, image.Pt(30, 50), 0},
+		{"排除的标注不参与", image.Pt(b.Min.X+3, 47), []int{0}, image.Pt(b.Min.X+3-(b.Min.X+3)%10, 50), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, guides := SnapPoint(tt.p, anns, tt.exclude, opts)
+			if got != tt.want || len(guides) != tt.guides {
+				t.Errorf("SnapPoint(%v) = %v，%d 条参考线，应为 %v，%d 条", tt.p, got, len(guides), tt.want, tt.guides)
+			}
+		})
+	}
+}
+
+func TestSnapRect(t *testing.T) {
+	anns := []Annotation{{Type: ToolRect, Points: []image.Point{{100, 100}, {200, 150}}}}
+	b := anns[0].Bounds()
+
+	// 右边缘接近标注左边缘：向右对齐；y 方向无目标时左上角吸附网格
+	r := image.Rect(b.Min.X-52, 300, b.Min.X-2, 333)
+	off, guides := SnapRect(r, anns, nil, SnapOptions{Grid: 10, Threshold: 5})
+	if want := image.Pt(2, 300-r.Min.Y); off != want || len(guides) != 1 || !guides[0].Vertical || guides[0].Pos != b.Min.X {
+		t.Errorf("SnapRect = %v %v，应为 %v 和 x=%d 的竖线", off, guides, want, b.Min.X)
+	}
+
+	// 不吸附时不移动
+	off, guides = SnapRect(r, anns, nil, SnapOptions{})
+	if off != (image.Point{}) || guides != nil {
+		t.Errorf("未启用吸附时 SnapRect = %v %v", off, guides)
+	}
+}
@@ -0,0 +1,322 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"  // 注册 GIF 解码器
+	_ "image/jpeg" // 注册 JPEG 解码器
+	_ "image/png"  // 注册 PNG 解码器
+	"math"
+	"os"
+	"sync"
+)
+
+// stampBaseSize 内置图章的绘制分辨率（渲染时再缩放到目标尺寸）
+const stampBaseSize = 128
+
+// imageCacheLimit 缩放结果缓存的最大条目数
+const imageCacheLimit = 64
+
+var (
+	imageCacheMu sync.Mutex
+	fileImages   = make(map[string]*image.RGBA)    // 已加载的图片文件（加载失败为 nil）
+	stampImages  = make(map[StampType]*image.RGBA) // 已绘制的内置图章
+	scaledImages = make(map[scaledKey]*image.RGBA) // 缩放到目标尺寸的图片
+)
+
+// scaledKey 缩放缓存的键
+type scaledKey struct {
+	src  *image.RGBA
+	w, h int
+}
+
+// ---------- 渲染 ----------
+
+// renderImage 将图片/图章缩放、旋转后按 alpha 合成到目标矩形
+func renderImage(img *image.RGBA, a *Annotation) {
+	if len(a.Points) < 2 {
+		return
+	}
+	r := canonicalRect(a.Points[0], a.Points[1])
+	if r.Empty() {
+		return
+	}
+
+	src := annotationImage(a)
+	if src == nil {
+		renderMissingImage(img, r)
+		return
+	}
+	scaled := scaledImage(src, r.Dx(), r.Dy())
+
+	// 未旋转：直接合成
+	if math.Mod(a.Rotation, 360) == 0 {
+		draw.Draw(img, r, scaled, image.Point{}, draw.Over)
+		return
+	}
+
+	// 旋转：对目标区域每个像素逆旋转到图片坐标，双线性采样
+	sin, cos := math.Sincos(a.Rotation * math.Pi / 180)
+	cx := float64(r.Min.X+r.Max.X) / 2
+	cy := float64(r.Min.Y+r.Max.Y) / 2
+	hw := float64(r.Dx()) / 2
+	hh := float64(r.Dy()) / 2
+
+	area := rotatedBounds(r, a.Rotation).Intersect(img.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			px := float64(x) + 0.5 - cx
+			py := float64(y) + 0.5 - cy
+			lx := px*cos + py*sin + hw
+			ly := -px*sin + py*cos + hh
+			if lx < -1 || ly < -1 || lx > 2*hw+1 || ly > 2*hh+1 {
+				continue
+			}
+			blendPremultiplied(img, x, y, sampleBilinear(scaled, lx-0.5, ly-0.5))
+		}
+	}
+}
+
+// renderMissingImage 图片无法加载时绘制占位框
+func renderMissingImage(img *image.RGBA, r image.Rectangle) {
+	c := color.RGBA{160, 160, 160, 255}
+	drawRectStroke(img, r, c, 2)
+	drawThickLine(img, r.Min.X, r.Min.Y, r.Max.X-1, r.Max.Y-1, c, 2)
+	drawThickLine(img, r.Max.X-1, r.Min.Y, r.Min.X, r.Max.Y-1, c, 2)
+}
+
+// rotatedBounds 矩形绕中心顺时针旋转 deg 度后的外接矩形
+func rotatedBounds(r image.Rectangle, deg float64) image.Rectangle {
+	if math.Mod(deg, 360) == 0 {
+		return r
+	}
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	hw := float64(r.Dx()) / 2
+	hh := float64(r.Dy()) / 2
+	ew := math.Abs(hw*cos) + math.Abs(hh*sin)
+	eh := math.Abs(hw*sin) + math.Abs(hh*cos)
+	cx := float64(r.Min.X+r.Max.X) / 2
+	cy := float64(r.Min.Y+r.Max.Y) / 2
+	return image.Rect(
+		int(math.Floor(cx-ew)), int(math.Floor(cy-eh)),
+		int(math.Ceil(cx+ew)), int(math.Ceil(cy+eh)),
+	)
+}
+
+// resizeRotated 缩放旋转的图片：中心随外接矩形从 from 移到 to，未旋转的矩形沿自身的两个轴缩放，
+// 旋转角度不变（按外接矩形缩放角点会使旋转的图片每次拖拽都变大）
+func (a *Annotation) resizeRotated(from, to image.Rectangle) {
+	r := canonicalRect(a.Points[0], a.Points[1])
+	sx := float64(to.Dx()) / float64(from.Dx())
+	sy := float64(to.Dy()) / float64(from.Dy())
+	sin, cos := math.Sincos(a.Rotation * math.Pi / 180)
+	hw := math.Max(1, float64(r.Dx())*math.Hypot(sx*cos, sy*sin)) / 2
+	hh := math.Max(1, float64(r.Dy())*math.Hypot(sx*sin, sy*cos)) / 2
+	cx := float64(to.Min.X) + (float64(r.Min.X+r.Max.X)/2-float64(from.Min.X))*sx
+	cy := float64(to.Min.Y) + (float64(r.Min.Y+r.Max.Y)/2-float64(from.Min.Y))*sy
+	a.Points[0] = image.Pt(int(math.Round(cx-hw)), int(math.Round(cy-hh)))
+	a.Points[1] = image.Pt(int(math.Round(cx+hw)), int(math.Round(cy+hh)))
+}
+
+// imageContains 点 p 是否落在旋转后的图片矩形内
+func imageContains(r image.Rectangle, deg float64, p image.Point, tolerance int) bool {
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	cx := float64(r.Min.X+r.Max.X) / 2
+	cy := float64(r.Min.Y+r.Max.Y) / 2
+	px := float64(p.X) - cx
+	py := float64(p.Y) - cy
+	lx := px*cos + py*sin
+	ly := -px*sin + py*cos
+	tol := float64(tolerance)
+	return math.Abs(lx) <= float64(r.Dx())/2+tol && math.Abs(ly) <= float64(r.Dy())/2+tol
+}
+
+// sampleBilinear 双线性采样（预乘 alpha，超出范围视为透明）
+func sampleBilinear(src *image.RGBA, fx, fy float64) [4]float64 {
+	b := src.Bounds()
+	x0 := int(math.Floor(fx))
+	y0 := int(math.Floor(fy))
+	tx := fx - float64(x0)
+	ty := fy - float64(y0)
+
+	var out [4]float64
+	for _, s := range [4]struct {
+		x, y int
+		w    float64
+	}{
+		{x0, y0, (1 - tx) * (1 - ty)},
+		{x0 + 1, y0, tx * (1 - ty)},
+		{x0, y0 + 1, (1 - tx) * ty},
+		{x0 + 1, y0 + 1, tx * ty},
+	} {
+		if s.w == 0 || !image.Pt(s.x, s.y).In(b) {
+			continue
+		}
+		off := src.PixOffset(s.x, s.y)
+		for k := 0; k < 4; k++ {
+			out[k] += float64(src.Pix[off+k]) * s.w
+		}
+	}
+	return out
+}
+
+// blendPremultiplied 将预乘 alpha 的颜色叠加到像素上
+func blendPremultiplied(img *image.RGBA, x, y int, c [4]float64) {
+	if c[3] < 0.5 || !image.Pt(x, y).In(img.Bounds()) {
+		return
+	}
+	off := img.PixOffset(x, y)
+	inv := 1 - c[3]/255
+	for k := 0; k < 4; k++ {
+		img.Pix[off+k] = uint8(math.Min(255, c[k]+float64(img.Pix[off+k])*inv+0.5))
+	}
+}
+
+// ---------- 图片来源 ----------
+
+// annotationImage 获取标注引用的图片（内置图章或图片文件），无法加载时返回 nil
+func annotationImage(a *Annotation) *image.RGBA {
+	if a.Stamp != StampNone {
+		return stampImage(a.Stamp)
+	}
+	if a.ImagePath == "" {
+		return nil
+	}
+	return loadImageFile(a.ImagePath)
+}
+
+// loadImageFile 加载图片文件并缓存（加载失败也会缓存，避免每次重绘都读取磁盘）
+func loadImageFile(path string) *image.RGBA {
+	imageCacheMu.Lock()
+	defer imageCacheMu.Unlock()
+
+	if img, ok := fileImages[path]; ok {
+		return img
+	}
+
+	var rgba *image.RGBA
+	if f, err := os.Open(path); err == nil {
+		if src, _, err := image.Decode(f); err == nil {
+			b := src.Bounds()
+			rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+			draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+		}
+		f.Close()
+	}
+	fileImages[path] = rgba
+	return rgba
+}
+
+// scaledImage 将图片缩放到 w×h（缩小时按区域平均，放大时双线性插值），结果缓存
+func scaledImage(src *image.RGBA, w, h int) *image.RGBA {
+	if src.Bounds().Dx() == w && src.Bounds().Dy() == h {
+		return src
+	}
+
+	key := scaledKey{src: src, w: w, h: h}
+	imageCacheMu.Lock()
+	defer imageCacheMu.Unlock()
+	if img, ok := scaledImages[key]; ok {
+		return img
+	}
+	if len(scaledImages) >= imageCacheLimit {
+		scaledImages = make(map[scaledKey]*image.RGBA)
+	}
+
+	sb := src.Bounds()
+	fx := float64(sb.Dx()) / float64(w)
+	fy := float64(sb.Dy()) / float64(h)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c [4]float64
+			if fx <= 1 && fy <= 1 {
+				c = sampleBilinear(src, (float64(x)+0.5)*fx-0.5+float64(sb.Min.X), (float64(y)+0.5)*fy-0.5+float64(sb.Min.Y))
+			} else {
+				// 区域平均：对应源图中 [x0,x1)×[y0,y1) 的像素
+				x0 := sb.Min.X + int(float64(x)*fx)
+				x1 := max(x0+1, sb.Min.X+int(float64(x+1)*fx))
+				y0 := sb.Min.Y + int(float64(y)*fy)
+				y1 := max(y0+1, sb.Min.Y+int(float64(y+1)*fy))
+				n := float64((x1 - x0) * (y1 - y0))
+				for sy := y0; sy < y1; sy++ {
+					off := src.PixOffset(x0, sy)
+					for sx := x0; sx < x1; sx++ {
+						for k := 0; k < 4; k++ {
+							c[k] += float64(src.Pix[off+k])
+						}
+						off += 4
+					}
+				}
+				for k := range c {
+					c[k] /= n
+				}
+			}
+			off := dst.PixOffset(x, y)
+			for k := 0; k < 4; k++ {
+				dst.Pix[off+k] = uint8(math.Min(255, c[k]+0.5))
+			}
+		}
+	}
+
+	scaledImages[key] = dst
+	return dst
+}
+
+// ---------- 内置图章 ----------
+
+// stampImage 获取内置图章图像（首次使用时绘制）
+func stampImage(s StampType) *image.RGBA {
+	imageCacheMu.Lock()
+	defer imageCacheMu.Unlock()
+
+	if img, ok := stampImages[s]; ok {
+		return img
+	}
+	img := drawStamp(s)
+	stampImages[s] = img
+	return img
+}
+
+// drawStamp 在 stampBaseSize×stampBaseSize 的透明画布上绘制图章
+func drawStamp(s StampType) *image.RGBA {
+	const n = stampBaseSize
+	img := image.NewRGBA(image.Rect(0, 0, n, n))
+	white := color.RGBA{255, 255, 255, 255}
+
+	switch s {
+	case StampCheck:
+		drawFilledCircleAA(img, n/2, n/2, n/2-4, color.RGBA{52, 199, 89, 255})
+		drawThickLine(img, 34, 66, 56, 88, white, 14)
+		drawThickLine(img, 56, 88, 96, 42, white, 14)
+
+	case StampCross:
+		drawFilledCircleAA(img, n/2, n/2, n/2-4, color.RGBA{255, 59, 48, 255})
+		drawThickLine(img, 42, 42, 86, 86, white, 14)
+		drawThickLine(img, 86, 42, 42, 86, white, 14)
+
+	case StampWarning:
+		drawFilledTriangle(img, image.Pt(64, 6), image.Pt(124, 118), image.Pt(4, 118), color.RGBA{255, 204, 0, 255})
+		black := color.RGBA{0, 0, 0, 255}
+		drawThickLine(img, 64, 44, 64, 84, black, 12)
+		drawFilledCircleAA(img, 64, 102, 7, black)
+
+	case StampCursor:
+		// 标准箭头指针：白色填充 + 黑色描边
+		pt := func(x, y float64) image.Point {
+			return image.Pt(int(20+x*6), int(8+y*6))
+		}
+		fill := image.NewRGBA(img.Bounds())
+		tip, left, notch := pt(0, 0), pt(0, 16), pt(4, 12)
+		tail1, tail2, wing, right := pt(7, 18.5), pt(9.5, 17.5), pt(6.6, 11.3), pt(11.5, 11.3)
+		drawFilledTriangle(fill, tip, left, notch, white)
+		drawFilledTriangle(fill, tip, notch, right, white)
+		drawFilledTriangle(fill, notch, tail1, tail2, white)
+		drawFilledTriangle(fill, notch, tail2, wing, white)
+		img = haloLayer(fill, 5, color.RGBA{0, 0, 0, 255})
+		draw.Draw(img, img.Bounds(), fill, image.Point{}, draw.Over)
+	}
+	return img
+}
@@ -0,0 +1,144 @@
+package annotate
+
+import (
+	"image"
+	"strings"
+	"unicode/utf8"
+)
+
+// textLayout 文本排版结果（位图字体为等宽字体）
+type textLayout struct {
+	charW, charH int      // 单个字形的宽高
+	advance      int      // 字符步进（粗体时加宽）
+	lines        []string // 自动换行后的各行
+	offsets      []int    // 各行相对文本起点的水平偏移（由对齐方式决定）
+	width        int      // 文本块宽度（最长一行）
+}
+
+// layoutText 按字号、最大行宽和对齐方式排版文本
+func layoutText(a *Annotation) textLayout {
+	fontSize := a.FontSize
+	if fontSize <= 0 {
+		fontSize = 16
+	}
+
+	// 简单位图字体：字符宽度约为字号的 0.6
+	l := textLayout{charW: fontSize * 3 / 5, charH: fontSize}
+	l.advance = l.charW
+	if a.Style.Bold {
+		l.advance += max(1, l.charW/6)
+	}
+
+	maxChars := 0
+	if a.Style.MaxWidth > 0 && l.advance > 0 {
+		maxChars = max(1, a.Style.MaxWidth/l.advance)
+	}
+	for _, para := range splitLines(a.Text) {
+		l.lines = append(l.lines, wrapLine(para, maxChars)...)
+	}
+
+	widths := make([]int, len(l.lines))
+	for i, line := range l.lines {
+		widths[i] = utf8.RuneCountInString(line) * l.advance
+		l.width = max(l.width, widths[i])
+	}
+
+	l.offsets = make([]int, len(l.lines))
+	for i, w := range widths {
+		switch a.Style.Align {
+		case AlignCenter:
+			l.offsets[i] = (l.width - w) / 2
+		case AlignRight:
+			l.offsets[i] = l.width - w
+		}
+	}
+	return l
+}
+
+// wrapLine 将一行文本按每行最多 maxChars 个字符自动换行（maxChars<=0 不换行）
+// 优先在空格处断行；非 ASCII 字符（如中文）前后可直接断开，过长的单词强制截断
+func wrapLine(line string, maxChars int) []string {
+	runes := []rune(line)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return []string{line}
+	}
+
+	var lines []string
+	for len(runes) > maxChars {
+		cut := maxChars
+		for i := maxChars; i > 0; i-- {
+			if runes[i] == ' ' || runes[i-1] == ' ' || runes[i] > 127 || runes[i-1] > 127 {
+				if strings.TrimSpace(string(runes[:i])) != "" {
+					cut = i
+					break
+				}
+			}
+		}
+		lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+
+		// 下一行去掉行首空格
+		runes = runes[cut:]
+		for len(runes) > 0 && runes[0] == ' ' {
+			runes = runes[1:]
+		}
+	}
+	if len(runes) > 0 {
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// glyphMask 提取图层中字形像素的蒙版
+func glyphMask(layer *image.RGBA) []bool {
+	b := layer.Bounds()
+	w, h := b.Dx(), b.Dy()
+	ink := make([]bool, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			ink[y*w+x] = layer.Pix[y*layer.Stride+x*4+3] >= 128
+		}
+	}
+	return ink
+}
+
+// dilateRows 将蒙版中的笔画向右加宽 n 像素（粗体）
+func dilateRows(ink []bool, w, h, n int) []bool {
+	out := make([]bool, len(ink))
+	for y := 0; y < h; y++ {
+		row := ink[y*w : (y+1)*w]
+		for x := 0; x < w; x++ {
+			for k := 0; k <= n && k <= x; k++ {
+				if row[x-k] {
+					out[y*w+x] = true
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// hollowMask 挖空笔画内部，只保留宽度为 t 的边缘（空心字）
+func hollowMask(ink []bool, w, h, t int) []bool {
+	out := make([]bool, len(ink))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !ink[y*w+x] {
+				continue
+			}
+			// t 邻域内存在空白（或越界）即为边缘
+			edge := false
+			for dy := -t; dy <= t && !edge; dy++ {
+				for dx := -t; dx <= t; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= w || ny >= h || !ink[ny*w+nx] {
+						edge = true
+						break
+					}
+				}
+			}
+			out[y*w+x] = edge
+		}
+	}
+	return out
+}
@@ -3,6 +3,9 @@ package annotate
 import (
 	"image"
 	"image/color"
+	"math"
+
+	"snapcli/internal/keymap"
 )
 
 // ToolType 标注工具类型
@@ -16,6 +19,9 @@ const (
 	ToolFreehand                // 自由画笔
 	ToolMosaic                  // 马赛克/模糊
 	ToolEllipse                 // 椭圆
+	ToolImage                   // 图片/图章
+	ToolMeasure                 // 测量（尺寸线）
+	ToolSelect                  // 选择（移动/缩放/修改已有标注）
 	ToolCount                   // 工具总数（用于遍历）
 )
 
@@ -28,6 +34,33 @@ var ToolName = map[ToolType]string{
 	ToolFreehand: "画笔",
 	ToolMosaic:   "马赛克",
 	ToolEllipse:  "椭圆",
+	ToolImage:    "图章",
+	ToolMeasure:  "测量",
+	ToolSelect:   "选择",
+}
+
+// ToolKey 工具在配置文件中使用的名称
+var ToolKey = map[ToolType]string{
+	ToolRect:     "rect",
+	ToolArrow:    "arrow",
+	ToolLine:     "line",
+	ToolText:     "text",
+	ToolFreehand: "pen",
+	ToolMosaic:   "mosaic",
+	ToolEllipse:  "ellipse",
+	ToolImage:    "stamp",
+	ToolMeasure:  "measure",
+	ToolSelect:   "select",
+}
+
+// ParseTool 按配置名称查找工具
+func ParseTool(name string) (ToolType, bool) {
+	for t, key := range ToolKey {
+		if key == name {
+			return t, true
+		}
+	}
+	return 0, false
 }
 
 // Annotation 单个标注
@@ -40,6 +73,72 @@ type Annotation struct {
 	FontSize  int           // 字号（仅 ToolText 使用）
 	Filled    bool          // 是否填充（矩形/椭圆）
 	MosaicPx  int           // 马赛克像素块大小
+	Group     int           // 所属分组 ID（0 表示未分组，同组标注作为整体移动和排序）
+
+	Opacity      int        // 不透明度百分比（1-99 为半透明，0 或 100 表示不透明）
+	Outline      bool       // 是否在笔迹和文字外围绘制对比色轮廓（任何背景下都清晰）
+	OutlineColor color.RGBA // 轮廓颜色（A=0 时根据标注颜色自动选择黑/白）
+	OutlineWidth int        // 轮廓宽度（0 表示根据线宽/字号自动计算）
+
+	Style TextStyle // 文本样式（仅 ToolText 使用）
+
+	ImagePath string    // 图片文件路径（仅 ToolImage 使用，Stamp 为 StampNone 时有效）
+	Stamp     StampType // 内置图章（仅 ToolImage 使用）
+	Rotation  float64   // 绕中心的顺时针旋转角度（度，仅 ToolImage 使用）
+
+	ScaleFactor float64 // 物理像素与逻辑点之比（仅 ToolMeasure 使用，0 或 1 时只显示像素）
+}
+
+// StampType 内置图章类型
+type StampType int
+
+const (
+	StampNone    StampType = iota // 无（使用 ImagePath 指定的图片）
+	StampCheck                    // 对勾（通过）
+	StampCross                    // 叉号（失败）
+	StampWarning                  // 警告
+	StampCursor                   // 鼠标指针
+	StampCount                    // 图章总数（用于遍历）
+)
+
+// StampName 图章显示名称
+var StampName = map[StampType]string{
+	StampCheck:   "通过",
+	StampCross:   "失败",
+	StampWarning: "警告",
+	StampCursor:  "指针",
+}
+
+// TextAlign 多行文本的对齐方式
+type TextAlign int
+
+const (
+	AlignLeft   TextAlign = iota // 左对齐
+	AlignCenter                  // 居中
+	AlignRight                   // 右对齐
+)
+
+// TextBackground 文本背景样式
+type TextBackground int
+
+const (
+	TextBgDefault TextBackground = iota // 半透明黑色矩形（默认）
+	TextBgNone                          // 无背景
+	TextBgSolid                         // 纯色矩形（BgColor）
+	TextBgRounded                       // 纯色圆角矩形（BgColor）
+	TextBgMatched                       // 以文字颜色作背景，文字取黑/白对比色
+	TextBgCount                         // 背景样式总数（用于循环切换）
+)
+
+// TextStyle 文本标注的排版与样式
+type TextStyle struct {
+	MaxWidth   int            // 最大行宽（像素），超出时自动换行，0 表示不限制
+	Align      TextAlign      // 对齐方式
+	Bold       bool           // 粗体
+	Hollow     bool           // 空心字（只绘制字形轮廓）
+	Background TextBackground // 背景样式
+	BgColor    color.RGBA     // 纯色/圆角背景的颜色（A=0 时使用半透明黑色）
+	AutoColor  bool           // 根据背景亮度自动选择黑/白文字
 }
 
 // Bounds 获取标注的边界矩形
@@ -48,6 +147,21 @@ func (a *Annotation) Bounds() image.Rectangle {
 		return image.Rectangle{}
 	}
 
+	// 文本的范围由字号和内容决定（含背景框）
+	if a.Type == ToolText {
+		return textBox(a)
+	}
+
+	// 测量标注包含长度标签
+	if a.Type == ToolMeasure {
+		return measureBounds(a)
+	}
+
+	// 图片的范围为旋转后的外接矩形
+	if a.Type == ToolImage && len(a.Points) >= 2 {
+		return rotatedBounds(canonicalRect(a.Points[0], a.Points[1]), a.Rotation)
+	}
+
 	minX, minY := a.Points[0].X, a.Points[0].Y
 	maxX, maxY := minX, minY
 
@@ -68,9 +182,55 @@ func (a *Annotation) Bounds() image.Rectangle {
 
 	// 扩展线宽
 	pad := a.LineWidth/2 + 1
+	if a.Type == ToolArrow {
+		// 箭头头部比线宽更宽
+		if head := arrowHeadSize(a.LineWidth)/2 + 1; head > pad {
+			pad = head
+		}
+	}
 	return image.Rect(minX-pad, minY-pad, maxX+pad, maxY+pad)
 }
 
+// Clone 深拷贝标注（Points 切片不与原标注共享）
+func (a Annotation) Clone() Annotation {
+	a.Points = append([]image.Point(nil), a.Points...)
+	return a
+}
+
+// Translate 平移标注
+func (a *Annotation) Translate(dx, dy int) {
+	for i := range a.Points {
+		a.Points[i].X += dx
+		a.Points[i].Y += dy
+	}
+}
+
+// Resize 将标注从矩形 from 缩放到矩形 to（文本同时缩放字号，旋转的图片缩放未旋转的矩形）
+func (a *Annotation) Resize(from, to image.Rectangle) {
+	if from.Dx() <= 0 || from.Dy() <= 0 {
+		return
+	}
+	if a.Type == ToolImage && len(a.Points) >= 2 && math.Mod(a.Rotation, 360) != 0 {
+		a.resizeRotated(from, to)
+		return
+	}
+	for i, p := range a.Points {
+		a.Points[i] = image.Point{
+			X: to.Min.X + (p.X-from.Min.X)*to.Dx()/from.Dx(),
+			Y: to.Min.Y + (p.Y-from.Min.Y)*to.Dy()/from.Dy(),
+		}
+	}
+	if a.Type == ToolText && a.FontSize > 0 {
+		a.FontSize = a.FontSize * to.Dy() / from.Dy()
+		if a.FontSize < 8 {
+			a.FontSize = 8
+		}
+		if a.Style.MaxWidth > 0 {
+			a.Style.MaxWidth = max(1, a.Style.MaxWidth*to.Dx()/from.Dx())
+		}
+	}
+}
+
 // DefaultColors 预设颜色面板
 var DefaultColors = []color.RGBA{
 	{255, 0, 0, 255},     // 红色
@@ -86,11 +246,63 @@ var DefaultColors = []color.RGBA{
 // DefaultLineWidths 预设线宽
 var DefaultLineWidths = []int{2, 3, 5, 8}
 
+// toolbarLineWidths 未配置线宽时二级面板中的线宽选项 (2px / 4px / 8px)
+var toolbarLineWidths = []int{2, 4, 8}
+
 // DefaultFontSizes 预设字号
 var DefaultFontSizes = []int{16, 20, 28, 36}
 
+// StylePreset 命名的标注样式预设（编辑器中按 Ctrl+数字键应用）
+type StylePreset struct {
+	Name       string
+	SwitchTool bool       // 应用时是否切换到 Tool
+	Tool       ToolType   // 切换到的工具
+	Color      color.RGBA // 颜色（A=0 时保留当前颜色）
+	LineWidth  int        // 线宽（0 时保留当前线宽）
+	FontSize   int        // 字号（0 时保留当前字号）
+	Opacity    int        // 不透明度百分比（0 表示不透明）
+	Outline    bool       // 对比色轮廓
+	Filled     bool       // 填充矩形/椭圆
+}
+
+// EditorOptions 编辑器选项（列表为空时使用默认值）
+type EditorOptions struct {
+	ScaleFactor float64       // 截图所在显示器的缩放比例（物理像素/逻辑点），用于测量工具换算
+	Palette     []color.RGBA  // 颜色面板
+	LineWidths  []int         // 线宽选项
+	FontSizes   []int         // 字号选项
+	DefaultTool ToolType      // 打开编辑器时选中的工具
+	Presets     []StylePreset // 样式预设（最多 9 个）
+	Snap        SnapOptions   // 吸附参数（按住 Alt 时生效）
+	Keymap      keymap.Keymap // 快捷键（nil 时使用默认快捷键）
+}
+
+// withDefaults 用默认值填充未设置的选项
+func (o EditorOptions) withDefaults() EditorOptions {
+	if len(o.Palette) == 0 {
+		o.Palette = DefaultColors
+	}
+	if len(o.LineWidths) == 0 {
+		o.LineWidths = toolbarLineWidths
+	}
+	if len(o.FontSizes) == 0 {
+		o.FontSizes = DefaultFontSizes
+	}
+	if o.DefaultTool < 0 || o.DefaultTool >= ToolCount {
+		o.DefaultTool = ToolRect
+	}
+	if o.Keymap == nil {
+		o.Keymap = keymap.Default()
+	}
+	return o
+}
+
 // EditorResult 编辑器返回结果
 type EditorResult struct {
-	Image     *image.RGBA  // 最终带标注的图片
-	Cancelled bool         // 用户是否取消
+	Image       *image.RGBA     // 最终带标注的图片
+	Annotations []Annotation    // 最终的标注列表（坐标相对于 Image）
+	Selection   image.Rectangle // 最终选区（全屏截图坐标，可能在编辑器中调整过）
+	Transform   ImageTransform  // 选区截图到 Image 的坐标变换（裁剪/旋转等图片操作）
+	Cancelled   bool            // 用户是否取消
+	CopyOnly    bool            // 仅复制到剪贴板，不保存文件
 }
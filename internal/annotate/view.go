@@ -0,0 +1,150 @@
+package annotate
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// 编辑器视图缩放：画布坐标 c 显示在视口内偏移 (c - origin) * zoom 处。
+// 标注始终使用画布（底图像素）坐标，缩放只影响显示和鼠标坐标换算。
+
+// 缩放参数
+const (
+	zoomMin  = 0.1  // 最小缩放比例
+	zoomMax  = 16.0 // 最大缩放比例
+	zoomStep = 1.25 // 滚轮每格/快捷键每次的缩放倍数
+)
+
+// viewTransform 画布到视口的缩放和平移
+type viewTransform struct {
+	zoom   float64 // 缩放比例（1 为 1:1）
+	ox, oy float64 // 视口左上角对应的画布坐标
+}
+
+// identity 是否为 1:1 且未平移
+func (v viewTransform) identity() bool {
+	return v.zoom == 1 && v.ox == 0 && v.oy == 0
+}
+
+// toCanvas 视口内偏移 (x, y) 对应的画布坐标
+func (v viewTransform) toCanvas(x, y float64) (float64, float64) {
+	return v.ox + x/v.zoom, v.oy + y/v.zoom
+}
+
+// toView 画布坐标对应的视口内偏移
+func (v viewTransform) toView(cx, cy float64) (float64, float64) {
+	return (cx - v.ox) * v.zoom, (cy - v.oy) * v.zoom
+}
+
+// canvasPixel 视口像素 (x, y) 所在的画布像素（按像素中心换算）
+func (v viewTransform) canvasPixel(x, y int) image.Point {
+	cx, cy := v.toCanvas(float64(x)+0.5, float64(y)+0.5)
+	return image.Pt(int(math.Floor(cx)), int(math.Floor(cy)))
+}
+
+// viewPixel 画布坐标 (cx, cy) 对应的视口像素偏移（四舍五入）
+func (v viewTransform) viewPixel(cx, cy int) image.Point {
+	x, y := v.toView(float64(cx), float64(cy))
+	return image.Pt(int(math.Round(x)), int(math.Round(y)))
+}
+
+// zoomAt 以视口内偏移 (x, y) 为中心缩放到 zoom（该点下的画布位置保持不变）
+func (v viewTransform) zoomAt(zoom, x, y float64) viewTransform {
+	zoom = math.Max(zoomMin, math.Min(zoomMax, zoom))
+	cx, cy := v.toCanvas(x, y)
+	return viewTransform{zoom: zoom, ox: cx - x/zoom, oy: cy - y/zoom}
+}
+
+// clamp 限制平移范围：图片小于视口时居中，否则不露出图片以外的区域
+func (v viewTransform) clamp(img, viewport image.Point) viewTransform {
+	axis := func(o float64, imgLen, vpLen int) float64 {
+		visible := float64(vpLen) / v.zoom
+		if visible >= float64(imgLen) {
+			return -(visible - float64(imgLen)) / 2
+		}
+		return math.Max(0, math.Min(float64(imgLen)-visible, o))
+	}
+	v.ox = axis(v.ox, img.X, viewport.X)
+	v.oy = axis(v.oy, img.Y, viewport.Y)
+	return v
+}
+
+// nextZoom 按 steps 级（正数放大、负数缩小）调整缩放比例，经过 1:1 时停在 1:1
+func nextZoom(zoom float64, steps int) float64 {
+	next := zoom * math.Pow(zoomStep, float64(steps))
+	if (zoom < 1 && next > 1) || (zoom > 1 && next < 1) {
+		next = 1
+	}
+	// 消除浮点误差，便于回到精确的 1:1
+	if math.Abs(next-1) < 1e-6 {
+		next = 1
+	}
+	return math.Max(zoomMin, math.Min(zoomMax, next))
+}
+
+// renderView 将画布按视图变换绘制到 BGRA 像素缓冲区的 dst 区域（origin 为视口左上角）。
+// 放大时取最近像素（保持像素边缘清晰），缩小时按覆盖区域平均，画布以外填充 fill
+func renderView(canvas *image.RGBA, pixels []byte, stride int, dst image.Rectangle, origin image.Point, v viewTransform, fill color.RGBA) {
+	b := canvas.Bounds()
+	xs := viewSpans(dst.Min.X-origin.X, dst.Dx(), v.ox, v.zoom, b.Dx())
+	ys := viewSpans(dst.Min.Y-origin.Y, dst.Dy(), v.oy, v.zoom, b.Dy())
+
+	for j, sy := range ys {
+		row := (dst.Min.Y + j) * stride
+		for i, sx := range xs {
+			di := (row + dst.Min.X + i) * 4
+			if sx[0] >= sx[1] || sy[0] >= sy[1] {
+				pixels[di+0], pixels[di+1], pixels[di+2], pixels[di+3] = fill.B, fill.G, fill.R, 255
+				continue
+			}
+
+			// 单个像素：直接复制
+			if sx[1]-sx[0] == 1 && sy[1]-sy[0] == 1 {
+				si := canvas.PixOffset(b.Min.X+sx[0], b.Min.Y+sy[0])
+				pixels[di+0] = canvas.Pix[si+2]
+				pixels[di+1] = canvas.Pix[si+1]
+				pixels[di+2] = canvas.Pix[si+0]
+				pixels[di+3] = 255
+				continue
+			}
+
+			// 区域平均
+			var r, g, bl, n int
+			for y := sy[0]; y < sy[1]; y++ {
+				si := canvas.PixOffset(b.Min.X+sx[0], b.Min.Y+y)
+				for x := sx[0]; x < sx[1]; x++ {
+					r += int(canvas.Pix[si+0])
+					g += int(canvas.Pix[si+1])
+					bl += int(canvas.Pix[si+2])
+					si += 4
+				}
+				n += sx[1] - sx[0]
+			}
+			pixels[di+0] = uint8((bl + n/2) / n)
+			pixels[di+1] = uint8((g + n/2) / n)
+			pixels[di+2] = uint8((r + n/2) / n)
+			pixels[di+3] = 255
+		}
+	}
+}
+
+// viewSpans 计算视口内从 start 开始的 n 个像素各自覆盖的画布像素范围 [from, to)，
+// 超出画布（0..size）的部分被裁掉，完全在画布外时 from >= to
+func viewSpans(start, n int, o, zoom float64, size int) [][2]int {
+	spans := make([][2]int, n)
+	for i := range spans {
+		p := float64(start + i)
+		var from, to int
+		if zoom >= 1 {
+			// 最近像素：取视口像素中心所在的画布像素
+			from = int(math.Floor(o + (p+0.5)/zoom))
+			to = from + 1
+		} else {
+			from = int(math.Floor(o + p/zoom))
+			to = max(from+1, int(math.Floor(o+(p+1)/zoom)))
+		}
+		spans[i] = [2]int{max(from, 0), min(to, size)}
+	}
+	return spans
+}
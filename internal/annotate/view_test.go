@@ -0,0 +1,155 @@
+package annotate
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestNextZoom(t *testing.T) {
+	tests := []struct {
+		zoom  float64
+		steps int
+		want  float64
+	}{
+		{1, 1, 1.25},
+		{1, -1, 0.8},
+		{0.8, 1, 1},  // 回到精确的 1:1
+		{0.9, 1, 1},  // 放大经过 1:1 时停在 1:1
+		{1.1, -1, 1}, // 缩小经过 1:1 时停在 1:1
+		{0.5, 10, 1}, // 多级跨过 1:1 同样停住
+		{10, 5, zoomMax},
+		{zoomMax, 1, zoomMax},
+		{0.2, -10, zoomMin},
+		{zoomMin, -1, zoomMin},
+	}
+	for _, tt := range tests {
+		if got := nextZoom(tt.zoom, tt.steps); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("nextZoom(%v, %d) = %v，应为 %v", tt.zoom, tt.steps, got, tt.want)
+		}
+	}
+}
+
+func TestViewZoomAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        viewTransform
+		zoom     float64
+		wantZoom float64
+	}{
+		{"放大", viewTransform{zoom: 1}, 2, 2},
+		{"平移后缩小", viewTransform{zoom: 4, ox: 30, oy: 12.5}, 0.5, 0.5},
+		{"超过最大值", viewTransform{zoom: 8}, 100, zoomMax},
+		{"低于最小值", viewTransform{zoom: 0.5}, 0.01, zoomMin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const x, y = 37, 91
+			v := tt.v.zoomAt(tt.zoom, x, y)
+			if v.zoom != tt.wantZoom {
+				t.Errorf("zoom = %v，应为 %v", v.zoom, tt.wantZoom)
+			}
+			// 缩放中心下的画布位置保持不变
+			cx0, cy0 := tt.v.toCanvas(x, y)
+			cx1, cy1 := v.toCanvas(x, y)
+			if math.Abs(cx0-cx1) > 1e-9 || math.Abs(cy0-cy1) > 1e-9 {
+				t.Errorf("缩放中心从 (%v, %v) 移到了 (%v, %v)", cx0, cy0, cx1, cy1)
+			}
+		})
+	}
+}
+
+func TestViewClamp(t *testing.T) {
+	tests := []struct {
+		name           string
+		v              viewTransform
+		img, viewport  image.Point
+		wantOX, wantOY float64
+	}{
+		{"范围内不变", viewTransform{zoom: 1, ox: 20, oy: 30}, image.Pt(100, 100), image.Pt(50, 50), 20, 30},
+		{"不露出左上", viewTransform{zoom: 1, ox: -10, oy: -5}, image.Pt(100, 100), image.Pt(50, 50), 0, 0},
+		{"不露出右下", viewTransform{zoom: 1, ox: 80, oy: 90}, image.Pt(100, 100), image.Pt(50, 50), 50, 50},
+		{"放大后可视范围变小", viewTransform{zoom: 2, ox: 90, oy: 90}, image.Pt(100, 100), image.Pt(50, 50), 75, 75},
+		{"小图居中", viewTransform{zoom: 1, ox: 5, oy: 5}, image.Pt(20, 40), image.Pt(100, 100), -40, -30},
+		{"缩小后居中", viewTransform{zoom: 0.5, ox: 10, oy: 10}, image.Pt(100, 100), image.Pt(100, 100), -50, -50},
+		{"单轴居中", viewTransform{zoom: 1, ox: 30, oy: 200}, image.Pt(20, 300), image.Pt(100, 100), -40, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := tt.v.clamp(tt.img, tt.viewport)
+			if v.ox != tt.wantOX || v.oy != tt.wantOY || v.zoom != tt.v.zoom {
+				t.Errorf("clamp = %+v，应为 ox=%v oy=%v", v, tt.wantOX, tt.wantOY)
+			}
+		})
+	}
+}
+
+// TestViewRoundTrip 画布与视口像素坐标互相换算（编辑器的 screenToCanvas/canvasToScreen）
+func TestViewRoundTrip(t *testing.T) {
+	views := []viewTransform{
+		{zoom: 1},
+		{zoom: 1, ox: 17, oy: -40},
+		{zoom: 2, ox: 10.5, oy: 3},
+		{zoom: 3.3, ox: 7.25, oy: 91.6},
+		{zoom: zoomMax, ox: 123.4, oy: 5},
+		{zoom: 0.8, ox: -12, oy: 4.5},
+		{zoom: 0.3, ox: 50, oy: 0},
+		{zoom: zoomMin, ox: -300, oy: -200},
+	}
+	for _, v := range views {
+		for _, c := range []image.Point{{0, 0}, {1, 1}, {15, 7}, {99, 250}, {1234, 567}} {
+			p := v.viewPixel(c.X, c.Y)
+			if v.zoom >= 1 {
+				// 放大时每个画布像素至少占一个视口像素，换算回来必须是同一个画布像素
+				if got := v.canvasPixel(p.X, p.Y); got != c {
+					t.Errorf("zoom %v 原点 (%v, %v)：画布 %v -> 视口 %v -> 画布 %v", v.zoom, v.ox, v.oy, c, p, got)
+				}
+				continue
+			}
+			// 缩小时多个画布像素落在同一个视口像素，换算回来的视口像素最多相差 1
+			c := v.canvasPixel(p.X, p.Y)
+			got := v.viewPixel(c.X, c.Y)
+			if d := got.Sub(p); abs(d.X) > 1 || abs(d.Y) > 1 {
+				t.Errorf("zoom %v 原点 (%v, %v)：视口 %v -> 画布 -> 视口 %v", v.zoom, v.ox, v.oy, p, got)
+			}
+		}
+	}
+
+	// 1:1 且原点为整数时换算是简单平移
+	v := viewTransform{zoom: 1, ox: 17, oy: -40}
+	if got := v.canvasPixel(3, 4); got != image.Pt(20, -36) {
+		t.Errorf("canvasPixel(3, 4) = %v，应为 (20,-36)", got)
+	}
+}
+
+func TestViewSpans(t *testing.T) {
+	tests := []struct {
+		name     string
+		start, n int
+		o, zoom  float64
+		size     int
+		want     [][2]int
+	}{
+		{"1:1", 0, 3, 0, 1, 10, [][2]int{{0, 1}, {1, 2}, {2, 3}}},
+		{"放大取最近像素", 0, 4, 0, 2, 10, [][2]int{{0, 1}, {0, 1}, {1, 2}, {1, 2}}},
+		{"放大并平移", 0, 3, 4.5, 2, 10, [][2]int{{4, 5}, {5, 6}, {5, 6}}},
+		{"缩小取覆盖区域", 0, 2, 0, 0.5, 10, [][2]int{{0, 2}, {2, 4}}},
+		{"超出画布右侧", 0, 3, 0, 0.5, 4, [][2]int{{0, 2}, {2, 4}, {4, 4}}},
+		{"超出画布左侧", 0, 3, -1, 1, 10, [][2]int{{0, 0}, {0, 1}, {1, 2}}},
+		{"视口偏移", 5, 2, 0, 1, 10, [][2]int{{5, 6}, {6, 7}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := viewSpans(tt.start, tt.n, tt.o, tt.zoom, tt.size)
+			if len(got) != len(tt.want) {
+				t.Fatalf("viewSpans = %v，应为 %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("viewSpans = %v，应为 %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package annotate
+
+import "sort"
+
+// 标注列表的顺序即绘制顺序（z 序）：越靠后越在上层。
+// 同一分组的标注作为一个整体（单元）参与排序和绘制，
+// 单元位于组内最上层成员所在的位置。
+
+// zUnits 将标注划分为按 z 序排列的单元（未分组的标注单独成为一个单元）
+func zUnits(annotations []Annotation) [][]int {
+	// 每个分组以最上层成员的位置作为单元位置
+	top := make(map[int]int)
+	for i, a := range annotations {
+		if a.Group != 0 {
+			top[a.Group] = i
+		}
+	}
+
+	members := make(map[int][]int)
+	for i, a := range annotations {
+		if a.Group != 0 {
+			members[a.Group] = append(members[a.Group], i)
+		}
+	}
+
+	units := make([][]int, 0, len(annotations))
+	for i, a := range annotations {
+		switch {
+		case a.Group == 0:
+			units = append(units, []int{i})
+		case top[a.Group] == i:
+			units = append(units, members[a.Group])
+		}
+	}
+	return units
+}
+
+// drawOrder 返回按 z 序绘制标注的索引顺序（分组成员连续绘制）
+func drawOrder(annotations []Annotation) []int {
+	order := make([]int, 0, len(annotations))
+	for _, u := range zUnits(annotations) {
+		order = append(order, u...)
+	}
+	return order
+}
+
+// GroupMembers 返回索引 i 处标注所在单元的全部成员索引（未分组时只有自身）
+func (h *History) GroupMembers(i int) []int {
+	if i < 0 || i >= len(h.annotations) {
+		return nil
+	}
+	g := h.annotations[i].Group
+	if g == 0 {
+		return []int{i}
+	}
+	var members []int
+	for j, a := range h.annotations {
+		if a.Group == g {
+			members = append(members, j)
+		}
+	}
+	return members
+}
+
+// BringToFront 将选中标注（连同其分组）移到最上层，返回它们的新索引
+func (h *History) BringToFront(indices []int) []int {
+	return h.reorderUnits(indices, func(units [][]int, sel []bool) {
+		moveSelected(units, sel, false)
+	})
+}
+
+// SendToBack 将选中标注（连同其分组）移到最下层，返回它们的新索引
+func (h *History) SendToBack(indices []int) []int {
+	return h.reorderUnits(indices, func(units [][]int, sel []bool) {
+		moveSelected(units, sel, true)
+	})
+}
+
+// BringForward 将选中标注（连同其分组）上移一层，返回它们的新索引
+func (h *History) BringForward(indices []int) []int {
+	return h.reorderUnits(indices, func(units [][]int, sel []bool) {
+		for k := len(units) - 2; k >= 0; k-- {
+			if sel[k] && !sel[k+1] {
+				units[k], units[k+1] = units[k+1], units[k]
+				sel[k], sel[k+1] = sel[k+1], sel[k]
+			}
+		}
+	})
+}
+
+// SendBackward 将选中标注（连同其分组）下移一层，返回它们的新索引
+func (h *History) SendBackward(indices []int) []int {
+	return h.reorderUnits(indices, func(units [][]int, sel []bool) {
+		for k := 1; k < len(units); k++ {
+			if sel[k] && !sel[k-1] {
+				units[k], units[k-1] = units[k-1], units[k]
+				sel[k], sel[k-1] = sel[k-1], sel[k]
+			}
+		}
+	})
+}
+
+// Group 将选中标注编为一组（已在其他分组中的成员一并并入），返回它们的新索引
+func (h *History) Group(indices []int) []int {
+	members := h.expandUnits(indices)
+	if len(members) < 2 {
+		return indices
+	}
+
+	// 分配新的分组 ID
+	newGroup := 1
+	for _, a := range h.annotations {
+		if a.Group >= newGroup {
+			newGroup = a.Group + 1
+		}
+	}
+
+	batch := make(batchCmd, 0, len(members)+1)
+	for _, i := range members {
+		a := h.annotations[i]
+		a.Group = newGroup
+		batch = append(batch, &modifyCmd{index: i, before: h.annotations[i], after: a})
+	}
+
+	// 让组内成员在 z 序上连续
+	grouped := append([]Annotation(nil), h.annotations...)
+	for _, i := range members {
+		grouped[i].Group = newGroup
+	}
+	order := drawOrder(grouped)
+	if !isIdentity(order) {
+		batch = append(batch, &reorderCmd{order: order})
+	}
+
+	h.execute(batch)
+	return newIndices(order, members)
+}
+
+// Ungroup 解散选中标注所在的分组，返回是否成功
+func (h *History) Ungroup(indices []int) bool {
+	var batch batchCmd
+	for _, i := range h.expandUnits(indices) {
+		if h.annotations[i].Group == 0 {
+			continue
+		}
+		a := h.annotations[i]
+		a.Group = 0
+		batch = append(batch, &modifyCmd{index: i, before: h.annotations[i], after: a})
+	}
+	if len(batch) == 0 {
+		return false
+	}
+	h.execute(batch)
+	return true
+}
+
+// expandUnits 将索引扩展为完整单元（包含分组的全部成员），返回升序索引
+func (h *History) expandUnits(indices []int) []int {
+	var all []int
+	for _, i := range indices {
+		all = append(all, h.GroupMembers(i)...)
+	}
+	return uniqueSorted(all)
+}
+
+// reorderUnits 按 z 序单元重排标注，rearrange 原地调整单元顺序（sel 标记选中的单元）
+func (h *History) reorderUnits(indices []int, rearrange func(units [][]int, sel []bool)) []int {
+	selected := make(map[int]bool)
+	for _, i := range h.expandUnits(indices) {
+		selected[i] = true
+	}
+	if len(selected) == 0 {
+		return indices
+	}
+
+	units := zUnits(h.annotations)
+	sel := make([]bool, len(units))
+	for k, u := range units {
+		sel[k] = selected[u[0]]
+	}
+	rearrange(units, sel)
+
+	order := make([]int, 0, len(h.annotations))
+	for _, u := range units {
+		order = append(order, u...)
+	}
+	members := h.expandUnits(indices)
+	if !h.Reorder(order) {
+		return members
+	}
+	return newIndices(order, members)
+}
+
+// moveSelected 将选中的单元整体移到最前（toBack）或最后，保持相对顺序
+func moveSelected(units [][]int, sel []bool, toBack bool) {
+	var picked, rest [][]int
+	for k, u := range units {
+		if sel[k] {
+			picked = append(picked, u)
+		} else {
+			rest = append(rest, u)
+		}
+	}
+	if toBack {
+		copy(units, append(picked, rest...))
+	} else {
+		copy(units, append(rest, picked...))
+	}
+}
+
+// newIndices 根据重排顺序（新第 i 项为旧第 order[i] 项）计算旧索引的新位置
+func newIndices(order []int, old []int) []int {
+	pos := make(map[int]int, len(order))
+	for i, j := range order {
+		pos[j] = i
+	}
+	result := make([]int, 0, len(old))
+	for _, j := range old {
+		result = append(result, pos[j])
+	}
+	sort.Ints(result)
+	return result
+}
+
+// isIdentity 顺序是否未改变
+func isIdentity(order []int) bool {
+	for i, j := range order {
+		if i != j {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueSorted 去重并升序排列
+func uniqueSorted(indices []int) []int {
+	result := append([]int(nil), indices...)
+	sort.Ints(result)
+	n := 0
+	for i, v := range result {
+		if i == 0 || v != result[n-1] {
+			result[n] = v
+			n++
+		}
+	}
+	return result[:n]
+}
@@ -0,0 +1,173 @@
+package beautify
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// Options 美化参数（颜色均为非预乘 alpha）
+type Options struct {
+	Padding       int        // 截图四周的留白（像素）
+	Background    color.RGBA // 背景色（渐变的起始色）
+	Gradient      color.RGBA // 渐变终止色（A=0 时为纯色背景）
+	GradientAngle float64    // 渐变方向（度，0 为从左到右，90 为从上到下）
+	CornerRadius  int        // 截图圆角半径
+	ShadowBlur    int        // 阴影模糊半径（0 表示无阴影）
+	ShadowOffset  int        // 阴影向下的偏移
+	ShadowColor   color.RGBA // 阴影颜色（A 为不透明度）
+}
+
+// Frame 尺寸为 size 的截图美化后在画布上的位置
+func Frame(size image.Point, opts Options) image.Rectangle {
+	pad := max(0, opts.Padding)
+	return image.Rectangle{Min: image.Pt(pad, pad), Max: image.Pt(pad+size.X, pad+size.Y)}
+}
+
+// Apply 将截图放在带留白的背景上，并添加圆角和投影，返回新图片
+func Apply(src image.Image, opts Options) *image.RGBA {
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	pad := max(0, opts.Padding)
+	radius := min(max(0, opts.CornerRadius), w/2, h/2)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w+2*pad, h+2*pad))
+	fillBackground(dst, opts)
+
+	frame := Frame(sb.Size(), opts)
+
+	// 投影：圆角矩形遮罩偏移后模糊，再按阴影颜色合成
+	if opts.ShadowBlur > 0 && opts.ShadowColor.A > 0 {
+		shadow := roundRectMask(dst.Bounds(), frame.Add(image.Pt(0, opts.ShadowOffset)), radius)
+		blurMask(shadow, opts.ShadowBlur)
+		sc := premultiply(opts.ShadowColor)
+		fill := color.RGBA{uint8(sc[0] + 0.5), uint8(sc[1] + 0.5), uint8(sc[2] + 0.5), opts.ShadowColor.A}
+		draw.DrawMask(dst, dst.Bounds(), image.NewUniform(fill), image.Point{}, shadow, image.Point{}, draw.Over)
+	}
+
+	// 截图本身：圆角外的部分透明
+	if radius > 0 {
+		mask := roundRectMask(frame, frame, radius)
+		draw.DrawMask(dst, frame, src, sb.Min, mask, frame.Min, draw.Over)
+	} else {
+		draw.Draw(dst, frame, src, sb.Min, draw.Over)
+	}
+	return dst
+}
+
+// fillBackground 用纯色或线性渐变填充整个画布
+func fillBackground(img *image.RGBA, opts Options) {
+	b := img.Bounds()
+	if opts.Gradient.A == 0 {
+		c := premultiply(opts.Background)
+		fill := color.RGBA{uint8(c[0] + 0.5), uint8(c[1] + 0.5), uint8(c[2] + 0.5), opts.Background.A}
+		draw.Draw(img, b, image.NewUniform(fill), image.Point{}, draw.Src)
+		return
+	}
+
+	// 沿渐变方向投影，映射到 [0,1]
+	sin, cos := math.Sincos(opts.GradientAngle * math.Pi / 180)
+	cx := float64(b.Min.X+b.Max.X) / 2
+	cy := float64(b.Min.Y+b.Max.Y) / 2
+	half := math.Abs(cos)*float64(b.Dx())/2 + math.Abs(sin)*float64(b.Dy())/2
+	if half == 0 {
+		half = 1
+	}
+
+	from := premultiply(opts.Background)
+	to := premultiply(opts.Gradient)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		off := img.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			proj := (float64(x)+0.5-cx)*cos + (float64(y)+0.5-cy)*sin
+			t := math.Max(0, math.Min(1, proj/half/2+0.5))
+			for k := 0; k < 4; k++ {
+				img.Pix[off+k] = uint8(from[k] + (to[k]-from[k])*t + 0.5)
+			}
+			off += 4
+		}
+	}
+}
+
+// premultiply 将颜色转换为预乘 alpha 的浮点分量
+func premultiply(c color.RGBA) [4]float64 {
+	a := float64(c.A) / 255
+	return [4]float64{float64(c.R) * a, float64(c.G) * a, float64(c.B) * a, float64(c.A)}
+}
+
+// roundRectMask 生成范围为 bounds 的遮罩，圆角矩形 r 内不透明（边缘抗锯齿）
+func roundRectMask(bounds, r image.Rectangle, radius int) *image.Alpha {
+	mask := image.NewAlpha(bounds)
+	area := r.Intersect(bounds)
+	rad := float64(radius)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		off := mask.PixOffset(area.Min.X, y)
+		for x := area.Min.X; x < area.Max.X; x++ {
+			// 到最近圆角圆心的偏移（不在圆角区域时为 0）
+			dx := max(float64(r.Min.X)+rad-(float64(x)+0.5), (float64(x)+0.5)-(float64(r.Max.X)-rad), 0)
+			dy := max(float64(r.Min.Y)+rad-(float64(y)+0.5), (float64(y)+0.5)-(float64(r.Max.Y)-rad), 0)
+			cov := 1.0
+			if dx > 0 && dy > 0 {
+				cov = math.Max(0, math.Min(1, rad+0.5-math.Hypot(dx, dy)))
+			}
+			mask.Pix[off] = uint8(cov*255 + 0.5)
+			off++
+		}
+	}
+	return mask
+}
+
+// blurMask 对遮罩做近似高斯模糊（三次盒式模糊，水平和垂直方向分别进行）
+func blurMask(mask *image.Alpha, radius int) {
+	b := mask.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+
+	// 三次盒式模糊的总方差与半径 radius 的高斯模糊接近
+	r := max(1, int(math.Round(float64(radius)/2)))
+
+	buf := make([]float32, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			buf[y*w+x] = float32(mask.Pix[y*mask.Stride+x])
+		}
+	}
+	tmp := make([]float32, max(w, h))
+	for pass := 0; pass < 3; pass++ {
+		for y := 0; y < h; y++ {
+			boxBlur(buf[y*w:], 1, w, r, tmp)
+		}
+		for x := 0; x < w; x++ {
+			boxBlur(buf[x:], w, h, r, tmp)
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			mask.Pix[y*mask.Stride+x] = uint8(math.Min(255, float64(buf[y*w+x])+0.5))
+		}
+	}
+}
+
+// boxBlur 对步长为 stride、长度为 n 的一维数据做半径 r 的盒式模糊（边界外视为 0）
+func boxBlur(data []float32, stride, n, r int, tmp []float32) {
+	for i := 0; i < n; i++ {
+		tmp[i] = data[i*stride]
+	}
+	var sum float32
+	for i := 0; i < r && i < n; i++ {
+		sum += tmp[i]
+	}
+	size := float32(2*r + 1)
+	for i := 0; i < n; i++ {
+		if j := i + r; j < n {
+			sum += tmp[j]
+		}
+		if j := i - r - 1; j >= 0 {
+			sum -= tmp[j]
+		}
+		data[i*stride] = sum / size
+	}
+}
@@ -37,6 +37,24 @@ type Capturer interface {
 	GetFullBounds() Region
 }
 
+// DisplayAt 返回包含点 (x, y)（虚拟屏幕坐标）的显示器
+func DisplayAt(displays []Display, x, y int) (Display, bool) {
+	for _, d := range displays {
+		if x >= d.X && x < d.X+d.Width && y >= d.Y && y < d.Y+d.Height {
+			return d, true
+		}
+	}
+	return Display{}, false
+}
+
+// ScaleFactorAt 返回包含点 (x, y)（虚拟屏幕坐标）的显示器缩放比例，找不到时返回 1
+func ScaleFactorAt(displays []Display, x, y int) float64 {
+	if d, ok := DisplayAt(displays, x, y); ok && d.ScaleFactor > 0 {
+		return d.ScaleFactor
+	}
+	return 1
+}
+
 // BytesPerPixel RGBA 格式每像素字节数
 const BytesPerPixel = 4
 
@@ -20,6 +20,11 @@ func NewCapturer() Capturer {
 	return &DarwinCapturer{}
 }
 
+// ForegroundWindowTitle 获取当前前台窗口的标题（macOS 暂不支持，返回空字符串）
+func ForegroundWindowTitle() string {
+	return ""
+}
+
 // GetDisplays 获取所有显示器信息
 func (c *DarwinCapturer) GetDisplays() ([]Display, error) {
 	// 使用 system_profiler 获取显示器信息
@@ -19,6 +19,9 @@ var (
 	getSystemMetrics  = user32.NewProc("GetSystemMetrics")
 	enumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
 	getMonitorInfoW   = user32.NewProc("GetMonitorInfoW")
+	getForegroundWindow  = user32.NewProc("GetForegroundWindow")
+	getWindowTextW       = user32.NewProc("GetWindowTextW")
+	getWindowTextLengthW = user32.NewProc("GetWindowTextLengthW")
 
 	createCompatibleDC     = gdi32.NewProc("CreateCompatibleDC")
 	createCompatibleBitmap = gdi32.NewProc("CreateCompatibleBitmap")
@@ -85,6 +88,21 @@ func NewCapturer() Capturer {
 	return &WindowsCapturer{}
 }
 
+// ForegroundWindowTitle 获取当前前台窗口的标题（没有时返回空字符串）
+func ForegroundWindowTitle() string {
+	hwnd, _, _ := getForegroundWindow.Call()
+	if hwnd == 0 {
+		return ""
+	}
+	n, _, _ := getWindowTextLengthW.Call(hwnd)
+	if n == 0 {
+		return ""
+	}
+	buf := make([]uint16, n+1)
+	getWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	return syscall.UTF16ToString(buf)
+}
+
 // GetDisplays 获取所有显示器信息
 func (c *WindowsCapturer) GetDisplays() ([]Display, error) {
 	c.displays = []Display{}
@@ -3,6 +3,9 @@
 package clipboard
 
 import (
+	"encoding/binary"
+	"image"
+	"image/draw"
 	"syscall"
 	"unsafe"
 )
@@ -22,9 +25,11 @@ var (
 	globalLock    = kernel32.NewProc("GlobalLock")
 	globalUnlock  = kernel32.NewProc("GlobalUnlock")
 	lstrcpyW      = kernel32.NewProc("lstrcpyW")
+	rtlMoveMemory = kernel32.NewProc("RtlMoveMemory")
 )
 
 const (
+	CF_DIB         = 8
 	CF_UNICODETEXT = 13
 	GMEM_MOVEABLE  = 0x0002
 )
@@ -117,3 +122,62 @@ func (c *WindowsClipboard) GetText() (string, error) {
 
 	return syscall.UTF16ToString(text), nil
 }
+
+// SetImage 设置剪贴板图片（CF_DIB 格式，32 位 BGRA，自底向上）
+func (c *WindowsClipboard) SetImage(img image.Image) error {
+	b := img.Bounds()
+	rgba, ok := img.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	}
+	w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+
+	// BITMAPINFOHEADER + 像素数据
+	const headerSize = 40
+	data := make([]byte, headerSize+w*h*4)
+	binary.LittleEndian.PutUint32(data[0:], headerSize)
+	binary.LittleEndian.PutUint32(data[4:], uint32(w))
+	binary.LittleEndian.PutUint32(data[8:], uint32(h)) // 正数表示自底向上
+	binary.LittleEndian.PutUint16(data[12:], 1)        // biPlanes
+	binary.LittleEndian.PutUint16(data[14:], 32)       // biBitCount
+	binary.LittleEndian.PutUint32(data[20:], uint32(w*h*4))
+	for y := 0; y < h; y++ {
+		src := rgba.Pix[y*rgba.Stride : y*rgba.Stride+w*4]
+		dst := data[headerSize+(h-1-y)*w*4:]
+		for x := 0; x < w; x++ {
+			dst[x*4+0] = src[x*4+2]
+			dst[x*4+1] = src[x*4+1]
+			dst[x*4+2] = src[x*4+0]
+			dst[x*4+3] = src[x*4+3]
+		}
+	}
+
+	// 打开剪贴板
+	ret, _, _ := openClipboard.Call(0)
+	if ret == 0 {
+		return syscall.GetLastError()
+	}
+	defer closeClipboard.Call()
+
+	emptyClipboard.Call()
+
+	hMem, _, _ := globalAlloc.Call(GMEM_MOVEABLE, uintptr(len(data)))
+	if hMem == 0 {
+		return syscall.GetLastError()
+	}
+	ptr, _, _ := globalLock.Call(hMem)
+	if ptr == 0 {
+		globalFree.Call(hMem)
+		return syscall.GetLastError()
+	}
+	rtlMoveMemory.Call(ptr, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)))
+	globalUnlock.Call(hMem)
+
+	ret, _, _ = setClipboardData.Call(CF_DIB, hMem)
+	if ret == 0 {
+		globalFree.Call(hMem)
+		return syscall.GetLastError()
+	}
+	return nil
+}
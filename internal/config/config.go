@@ -2,9 +2,15 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"snapcli/internal/keymap"
+	"snapcli/internal/storage"
 )
 
 // Hotkey 快捷键配置
@@ -16,8 +22,36 @@ type Hotkey struct {
 // Storage 存储配置
 type Storage struct {
 	Directory string `json:"directory"` // 保存目录
-	Format    string `json:"format"`    // 图片格式: png, jpg
+	Format    string `json:"format"`    // 图片格式: png, jpg, gif, bmp, tiff, webp（无损）
 	Quality   int    `json:"quality"`   // jpg质量 1-100
+	Filename  string `json:"filename"`  // 文件名模板: {date} {time} {seq} {w}x{h} {hash} {window}
+	Subdir    string `json:"subdir"`    // 子目录模板，如 {year}/{month}（为空时不分子目录，不支持 {hash}）
+
+	MaxEdge       int     `json:"maxEdge"`       // 最长边上限（0 不限制），如 1568 适合发送给 AI 助手
+	MaxMegapixels float64 `json:"maxMegapixels"` // 总像素上限（百万像素，0 不限制），如 1.15
+	KeepOriginal  bool    `json:"keepOriginal"`  // 缩小时在旁边保留原图
+
+	Colors      int    `json:"colors"`      // PNG 调色板颜色数 2-256（0 保存全彩），界面截图通常可缩小数倍；GIF 同样适用（0 为 256）
+	Dither      bool   `json:"dither"`      // 调色板量化时抖动（适合照片、渐变）
+	Compression string `json:"compression"` // PNG 压缩级别: default, none, speed, best（tiff 为 none 时不压缩）
+
+	MaxBytes int64 `json:"maxBytes"` // jpg 文件大小上限（字节，0 不限制），超出时自动降低质量或缩小
+
+	DedupeMinutes   int `json:"dedupeMinutes"`   // 与这段时间内的截图比较（0 不比较），完全相同时复用已有文件
+	SimilarDistance int `json:"similarDistance"` // 感知哈希距离 0-64，不超过该值时提示几乎相同（0 不提示）
+
+	ThumbSize int `json:"thumbSize"` // 缩略图最长边（像素，0 不生成），保存在 .thumbs 目录，用于 snapcli gallery
+}
+
+// Retention 截图保留策略（只清理索引中由 SnapCLI 保存的截图，各项限制为 0 表示不限制）
+type Retention struct {
+	Enabled    bool `json:"enabled"`         // 是否在后台定期清理
+	MaxAgeDays int  `json:"maxAgeDays"`      // 保留天数
+	MaxCount   int  `json:"maxCount"`        // 最多保留的截图数
+	MaxSizeMB  int  `json:"maxSizeMB"`       // 截图总大小上限（MB）
+	KeepTagged bool `json:"keepTagged"`      // 带标签的截图始终保留
+	Trash      bool `json:"trash"`           // 移到保存目录下的 .trash 文件夹而不是直接删除
+	Interval   int  `json:"intervalMinutes"` // 后台清理间隔（分钟）
 }
 
 // Behavior 行为配置
@@ -27,11 +61,115 @@ type Behavior struct {
 	AutoStart        bool `json:"autoStart"`        // 开机启动
 }
 
+// BeautifyPreset 美化预设：留白背景、圆角和投影
+type BeautifyPreset struct {
+	Padding       int    `json:"padding"`       // 四周留白（像素）
+	Background    string `json:"background"`    // 背景色，如 #ffffff
+	Gradient      string `json:"gradient"`      // 渐变终止色，为空时使用纯色背景
+	GradientAngle int    `json:"gradientAngle"` // 渐变方向（度，0 为从左到右，90 为从上到下）
+	CornerRadius  int    `json:"cornerRadius"`  // 截图圆角半径
+	Shadow        int    `json:"shadow"`        // 阴影模糊半径，0 表示无阴影
+	ShadowOffset  int    `json:"shadowOffset"`  // 阴影向下的偏移
+	ShadowOpacity int    `json:"shadowOpacity"` // 阴影不透明度 0-100
+}
+
+// Beautify 美化配置（标注完成后、保存前执行）
+type Beautify struct {
+	Enabled bool                      `json:"enabled"` // 是否启用
+	Preset  string                    `json:"preset"`  // 使用的预设名称
+	Presets map[string]BeautifyPreset `json:"presets"` // 预设列表
+}
+
+// Watermark 水印配置（保存时叠加在截图上）
+type Watermark struct {
+	Enabled  bool   `json:"enabled"`  // 是否启用
+	Text     string `json:"text"`     // 水印文字，支持 {date}、{user}、{host} 占位符
+	Image    string `json:"image"`    // logo 图片路径（非空时代替文字）
+	Position string `json:"position"` // 位置: top-left, top-right, bottom-left, bottom-right
+	Opacity  int    `json:"opacity"`  // 不透明度 1-100
+	Scale    int    `json:"scale"`    // 大小：占截图较短边的百分比 1-50
+	Margin   int    `json:"margin"`   // 与图片边缘的距离（像素）
+	Color    string `json:"color"`    // 文字颜色，如 #ffffff
+}
+
+// AnnotateStyle 命名的标注样式预设（编辑器中按 Ctrl+1-9 依次应用）
+type AnnotateStyle struct {
+	Name      string `json:"name"`      // 预设名称
+	Tool      string `json:"tool"`      // 应用时切换到的工具，为空时不切换
+	Color     string `json:"color"`     // 颜色，为空时保留当前颜色
+	LineWidth int    `json:"lineWidth"` // 线宽，0 时保留当前线宽
+	FontSize  int    `json:"fontSize"`  // 字号，0 时保留当前字号
+	Opacity   int    `json:"opacity"`   // 不透明度 1-100，0 表示不透明
+	Outline   bool   `json:"outline"`   // 对比色轮廓
+	Filled    bool   `json:"filled"`    // 填充矩形/椭圆
+}
+
+// Annotate 标注编辑器配置
+type Annotate struct {
+	Palette      []string        `json:"palette"`      // 颜色面板，如 #ff0000
+	LineWidths   []int           `json:"lineWidths"`   // 线宽选项
+	FontSizes    []int           `json:"fontSizes"`    // 字号选项
+	DefaultTool  string          `json:"defaultTool"`  // 打开编辑器时选中的工具
+	Presets      []AnnotateStyle `json:"presets"`      // 样式预设
+	Grid         int             `json:"grid"`         // 吸附网格间距（按住 Alt 时生效），0 表示不吸附网格
+	SnapDistance int             `json:"snapDistance"` // 吸附到其他标注边缘/中心的距离，0 表示不吸附
+}
+
+// AnnotateTools 标注工具在配置中的名称
+var AnnotateTools = []string{"rect", "arrow", "line", "text", "pen", "mosaic", "ellipse", "stamp", "measure", "select"}
+
+// 标注配置的数量限制
+const (
+	maxPaletteColors = 16 // 颜色面板最多颜色数
+	maxSizeOptions   = 6  // 线宽/字号最多选项数
+	maxStylePresets  = 9  // 样式预设最多数量（Ctrl+1-9）
+)
+
 // Config 主配置结构
 type Config struct {
-	Hotkey   Hotkey   `json:"hotkey"`
-	Storage  Storage  `json:"storage"`
-	Behavior Behavior `json:"behavior"`
+	Hotkey    Hotkey            `json:"hotkey"`
+	Storage   Storage           `json:"storage"`
+	Behavior  Behavior          `json:"behavior"`
+	Retention Retention         `json:"retention"`
+	Beautify  Beautify          `json:"beautify"`
+	Watermark Watermark         `json:"watermark"`
+	Annotate  Annotate          `json:"annotate"`
+	Keymap    map[string]string `json:"keymap"` // 编辑器快捷键（动作 -> 按键组合，多个用逗号分隔）
+}
+
+// defaultBeautifyPresets 内置美化预设
+func defaultBeautifyPresets() map[string]BeautifyPreset {
+	return map[string]BeautifyPreset{
+		// 紫色渐变背景，适合幻灯片和文档
+		"gradient": {
+			Padding:       64,
+			Background:    "#667eea",
+			Gradient:      "#764ba2",
+			GradientAngle: 45,
+			CornerRadius:  12,
+			Shadow:        24,
+			ShadowOffset:  8,
+			ShadowOpacity: 45,
+		},
+		// 白色背景，适合 PR 描述等浅色页面
+		"light": {
+			Padding:       32,
+			Background:    "#ffffff",
+			CornerRadius:  8,
+			Shadow:        16,
+			ShadowOffset:  4,
+			ShadowOpacity: 30,
+		},
+		// 深色背景
+		"dark": {
+			Padding:       32,
+			Background:    "#1e1e1e",
+			CornerRadius:  8,
+			Shadow:        16,
+			ShadowOffset:  4,
+			ShadowOpacity: 60,
+		},
+	}
 }
 
 // DefaultConfig 返回默认配置
@@ -49,12 +187,53 @@ func DefaultConfig() *Config {
 			Directory: exeDir,
 			Format:    "png",
 			Quality:   90,
+			Filename:  "screenshot_{date}_{time}",
+
+			Compression: "default",
+
+			DedupeMinutes:   30,
+			SimilarDistance: 4,
+
+			ThumbSize: 320,
 		},
 		Behavior: Behavior{
 			ShowNotification: true,
 			PlaySound:        false,
 			AutoStart:        false,
 		},
+		Retention: Retention{
+			Enabled:    false,
+			KeepTagged: true,
+			Trash:      true,
+			Interval:   60,
+		},
+		Beautify: Beautify{
+			Enabled: false,
+			Preset:  "gradient",
+			Presets: defaultBeautifyPresets(),
+		},
+		Watermark: Watermark{
+			Enabled:  false,
+			Text:     "{date} {user}@{host}",
+			Position: "bottom-right",
+			Opacity:  80,
+			Scale:    3,
+			Margin:   12,
+			Color:    "#ffffff",
+		},
+		Annotate: Annotate{
+			Palette:     []string{"#ff0000", "#00b400", "#0078ff", "#ffc800", "#ff8000", "#b400ff", "#ffffff", "#000000"},
+			LineWidths:  []int{2, 4, 8},
+			FontSizes:   []int{16, 20, 28, 36},
+			DefaultTool: "rect",
+			Presets: []AnnotateStyle{
+				{Name: "error", Color: "#ff3b30", LineWidth: 8, Outline: true},
+				{Name: "note", Tool: "rect", Color: "#ffd60a", Opacity: 40, Filled: true},
+			},
+			Grid:         10,
+			SnapDistance: 8,
+		},
+		Keymap: keymap.Defaults(),
 	}
 }
 
@@ -68,6 +247,9 @@ func GetConfigPath() string {
 	return filepath.Join(exeDir, "config.json")
 }
 
+// ErrKeymap 快捷键配置无效（Load 返回的其他配置仍然有效）
+var ErrKeymap = errors.New("快捷键配置无效")
+
 // Load 加载配置
 func Load() (*Config, error) {
 	configPath := GetConfigPath()
@@ -93,6 +275,11 @@ func Load() (*Config, error) {
 	// 验证并修正配置
 	cfg.Validate()
 
+	// 快捷键冲突或无效时返回错误提示（保留原配置，使用时回退到默认快捷键，避免保存配置时覆盖用户的设置）
+	if _, err := keymap.Parse(cfg.Keymap); err != nil {
+		return &cfg, fmt.Errorf("%w，已使用默认快捷键: %v", ErrKeymap, err)
+	}
+
 	return &cfg, nil
 }
 
@@ -107,7 +294,7 @@ func (c *Config) Validate() {
 
 	// 验证图片格式
 	format := strings.ToLower(c.Storage.Format)
-	if format != "png" && format != "jpg" && format != "jpeg" {
+	if !storage.HasFormat(format) {
 		c.Storage.Format = defaults.Storage.Format
 	} else {
 		c.Storage.Format = format
@@ -118,6 +305,36 @@ func (c *Config) Validate() {
 		c.Storage.Directory = defaults.Storage.Directory
 	}
 
+	// 文件名模板不能为空或包含路径
+	c.Storage.Filename = strings.TrimSpace(c.Storage.Filename)
+	if c.Storage.Filename == "" || strings.ContainsAny(c.Storage.Filename, `/\`) {
+		c.Storage.Filename = defaults.Storage.Filename
+	}
+	// {hash} 在写入文件后才确定，不能用于子目录
+	if strings.Contains(c.Storage.Subdir, "..") || strings.Contains(c.Storage.Subdir, "{hash}") {
+		c.Storage.Subdir = defaults.Storage.Subdir
+	}
+
+	// 缩小限制：负数视为不限制
+	c.Storage.MaxEdge = max(0, c.Storage.MaxEdge)
+	c.Storage.MaxMegapixels = max(0, c.Storage.MaxMegapixels)
+
+	c.Storage.MaxBytes = max(0, c.Storage.MaxBytes)
+
+	c.Storage.DedupeMinutes = max(0, c.Storage.DedupeMinutes)
+	c.Storage.SimilarDistance = clamp(c.Storage.SimilarDistance, 0, 64)
+	c.Storage.ThumbSize = clamp(c.Storage.ThumbSize, 0, 1024)
+
+	// 调色板颜色数：0 为全彩，否则限制在 2-256
+	if c.Storage.Colors != 0 {
+		c.Storage.Colors = clamp(c.Storage.Colors, 2, 256)
+	}
+	switch c.Storage.Compression {
+	case "default", "none", "speed", "best":
+	default:
+		c.Storage.Compression = defaults.Storage.Compression
+	}
+
 	// 验证快捷键
 	if c.Hotkey.Key == "" {
 		c.Hotkey = defaults.Hotkey
@@ -136,6 +353,209 @@ func (c *Config) Validate() {
 	} else {
 		c.Hotkey.Modifiers = validatedMods
 	}
+
+	c.validateBeautify(defaults)
+	c.validateWatermark(defaults)
+	c.validateRetention(defaults)
+	c.validateAnnotate(defaults)
+
+	// 未配置快捷键时使用默认值（冲突检测在 Load 中进行）
+	if c.Keymap == nil {
+		c.Keymap = defaults.Keymap
+	}
+}
+
+// validateBeautify 验证美化预设，无效的颜色和数值恢复为默认值
+func (c *Config) validateBeautify(defaults *Config) {
+	b := &c.Beautify
+	if len(b.Presets) == 0 {
+		b.Presets = defaults.Beautify.Presets
+	}
+	if _, ok := b.Presets[b.Preset]; !ok {
+		// 预设不存在：优先使用默认预设，否则关闭美化
+		if _, ok := b.Presets[defaults.Beautify.Preset]; ok {
+			b.Preset = defaults.Beautify.Preset
+		} else {
+			b.Enabled = false
+		}
+	}
+
+	for name, p := range b.Presets {
+		if _, err := ParseHexColor(p.Background); err != nil {
+			p.Background = "#ffffff"
+		}
+		if _, err := ParseHexColor(p.Gradient); p.Gradient != "" && err != nil {
+			p.Gradient = ""
+		}
+		p.Padding = clamp(p.Padding, 0, 512)
+		p.CornerRadius = clamp(p.CornerRadius, 0, 256)
+		p.Shadow = clamp(p.Shadow, 0, 256)
+		p.ShadowOffset = clamp(p.ShadowOffset, -256, 256)
+		p.ShadowOpacity = clamp(p.ShadowOpacity, 0, 100)
+		b.Presets[name] = p
+	}
+}
+
+// validateRetention 验证保留策略：负数视为不限制，清理间隔至少 1 分钟
+func (c *Config) validateRetention(defaults *Config) {
+	r := &c.Retention
+	r.MaxAgeDays = max(0, r.MaxAgeDays)
+	r.MaxCount = max(0, r.MaxCount)
+	r.MaxSizeMB = max(0, r.MaxSizeMB)
+	if r.Interval < 1 {
+		r.Interval = defaults.Retention.Interval
+	}
+}
+
+// validateWatermark 验证水印配置
+func (c *Config) validateWatermark(defaults *Config) {
+	w := &c.Watermark
+	switch strings.ToLower(w.Position) {
+	case "top-left", "top-right", "bottom-left", "bottom-right":
+		w.Position = strings.ToLower(w.Position)
+	default:
+		w.Position = defaults.Watermark.Position
+	}
+	if w.Opacity < 1 || w.Opacity > 100 {
+		w.Opacity = defaults.Watermark.Opacity
+	}
+	if w.Scale < 1 || w.Scale > 50 {
+		w.Scale = defaults.Watermark.Scale
+	}
+	w.Margin = clamp(w.Margin, 0, 512)
+	if _, err := ParseHexColor(w.Color); err != nil {
+		w.Color = defaults.Watermark.Color
+	}
+	// 既没有文字也没有图片时不叠加水印
+	if w.Text == "" && w.Image == "" {
+		w.Enabled = false
+	}
+}
+
+// validateAnnotate 验证标注配置：去掉无效的颜色和数值，列表为空时恢复默认值
+func (c *Config) validateAnnotate(defaults *Config) {
+	a := &c.Annotate
+
+	palette := []string{}
+	for _, s := range a.Palette {
+		if _, err := ParseHexColor(s); err == nil && len(palette) < maxPaletteColors {
+			palette = append(palette, s)
+		}
+	}
+	if len(palette) == 0 {
+		palette = defaults.Annotate.Palette
+	}
+	a.Palette = palette
+
+	a.LineWidths = validSizes(a.LineWidths, 1, 64, defaults.Annotate.LineWidths)
+	a.FontSizes = validSizes(a.FontSizes, 8, 200, defaults.Annotate.FontSizes)
+
+	a.DefaultTool = strings.ToLower(a.DefaultTool)
+	if !isAnnotateTool(a.DefaultTool) {
+		a.DefaultTool = defaults.Annotate.DefaultTool
+	}
+
+	// 配置文件中没有 presets 字段时使用默认预设，显式写 [] 表示不使用预设
+	if a.Presets == nil {
+		a.Presets = defaults.Annotate.Presets
+	}
+	presets := []AnnotateStyle{}
+	for _, p := range a.Presets {
+		if len(presets) == maxStylePresets {
+			break
+		}
+		p.Tool = strings.ToLower(p.Tool)
+		if !isAnnotateTool(p.Tool) {
+			p.Tool = ""
+		}
+		if _, err := ParseHexColor(p.Color); err != nil {
+			p.Color = ""
+		}
+		p.LineWidth = clamp(p.LineWidth, 0, 64)
+		p.FontSize = clamp(p.FontSize, 0, 200)
+		p.Opacity = clamp(p.Opacity, 0, 100)
+		presets = append(presets, p)
+	}
+	a.Presets = presets
+
+	a.Grid = clamp(a.Grid, 0, 200)
+	a.SnapDistance = clamp(a.SnapDistance, 0, 50)
+}
+
+// validSizes 保留 [lo, hi] 范围内的尺寸（最多 maxSizeOptions 个），结果为空时返回默认值
+func validSizes(sizes []int, lo, hi int, defaults []int) []int {
+	valid := []int{}
+	for _, v := range sizes {
+		if v >= lo && v <= hi && len(valid) < maxSizeOptions {
+			valid = append(valid, v)
+		}
+	}
+	if len(valid) == 0 {
+		return defaults
+	}
+	return valid
+}
+
+// isAnnotateTool 是否为有效的标注工具名称
+func isAnnotateTool(name string) bool {
+	for _, t := range AnnotateTools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clamp 将 v 限制在 [lo, hi] 范围内
+func clamp(v, lo, hi int) int {
+	return min(max(v, lo), hi)
+}
+
+// ActiveBeautifyPreset 获取当前启用的美化预设（未启用时返回 false）
+func (c *Config) ActiveBeautifyPreset() (BeautifyPreset, bool) {
+	if !c.Beautify.Enabled {
+		return BeautifyPreset{}, false
+	}
+	p, ok := c.Beautify.Presets[c.Beautify.Preset]
+	return p, ok
+}
+
+// ParseHexColor 解析 #rgb、#rrggbb 或 #rrggbbaa 格式的颜色（# 可省略）
+func ParseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("无效的颜色: %q", s)
+	}
+
+	var v [4]uint8
+	for i := range v {
+		hi, ok1 := hexDigit(hex[i*2])
+		lo, ok2 := hexDigit(hex[i*2+1])
+		if !ok1 || !ok2 {
+			return color.RGBA{}, fmt.Errorf("无效的颜色: %q", s)
+		}
+		v[i] = hi<<4 | lo
+	}
+	return color.RGBA{v[0], v[1], v[2], v[3]}, nil
+}
+
+// hexDigit 解析单个十六进制字符
+func hexDigit(c byte) (uint8, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
 }
 
 // Save 保存配置
@@ -0,0 +1,274 @@
+package keymap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Chord 按键组合（Key 为 Windows 虚拟键码）
+type Chord struct {
+	Key   uint16
+	Ctrl  bool
+	Shift bool
+	Alt   bool
+}
+
+// Keymap 动作到按键组合的映射（一个动作可以绑定多个组合）
+type Keymap map[string][]Chord
+
+// Actions 可配置的动作（按显示顺序）
+var Actions = []string{
+	"tool.rect", "tool.ellipse", "tool.arrow", "tool.line", "tool.pen",
+	"tool.text", "tool.mosaic", "tool.stamp", "tool.measure", "tool.select",
+	"color.next", "color.prev", "width.next", "width.prev",
+	"undo", "redo", "save", "copy", "cancel", "delete", "paste",
+	"crop", "rotate", "rotate.back", "flip.horizontal", "flip.vertical", "pad",
+	"selection.rotate", "selection.rotate.back",
+	"zoom.in", "zoom.out", "zoom.reset",
+	"group", "ungroup", "forward", "front", "backward", "back",
+}
+
+// defaults 默认快捷键（多个组合用逗号分隔）
+var defaults = map[string]string{
+	"tool.rect":             "1",
+	"tool.ellipse":          "2",
+	"tool.arrow":            "3",
+	"tool.line":             "4",
+	"tool.pen":              "5",
+	"tool.text":             "6",
+	"tool.mosaic":           "7",
+	"tool.stamp":            "8",
+	"tool.measure":          "9",
+	"tool.select":           "0",
+	"color.next":            "]",
+	"color.prev":            "[",
+	"width.next":            "=",
+	"width.prev":            "-",
+	"undo":                  "ctrl+z",
+	"redo":                  "ctrl+y, ctrl+shift+z",
+	"save":                  "enter",
+	"copy":                  "ctrl+c",
+	"cancel":                "esc",
+	"delete":                "delete, backspace",
+	"paste":                 "ctrl+v",
+	"crop":                  "c",
+	"rotate":                "t",
+	"rotate.back":           "shift+t",
+	"flip.horizontal":       "h",
+	"flip.vertical":         "v",
+	"pad":                   "p",
+	"selection.rotate":      "r",
+	"selection.rotate.back": "shift+r",
+	"zoom.in":               "ctrl+=, ctrl+numplus",
+	"zoom.out":              "ctrl+-, ctrl+numminus",
+	"zoom.reset":            "ctrl+0",
+	"group":                 "ctrl+g",
+	"ungroup":               "ctrl+shift+g",
+	"forward":               "ctrl+]",
+	"front":                 "ctrl+shift+]",
+	"backward":              "ctrl+[",
+	"back":                  "ctrl+shift+[",
+}
+
+// reserved 编辑器固定使用、不可重新绑定的按键组合
+var reserved = map[string]string{
+	"ctrl+b": "文本粗体",
+	"ctrl+o": "空心字",
+	"ctrl+l": "左对齐",
+	"ctrl+e": "居中",
+	"ctrl+r": "右对齐",
+	"ctrl+t": "文本背景",
+	"ctrl+k": "自动对比色",
+	"ctrl+1": "样式预设", "ctrl+2": "样式预设", "ctrl+3": "样式预设",
+	"ctrl+4": "样式预设", "ctrl+5": "样式预设", "ctrl+6": "样式预设",
+	"ctrl+7": "样式预设", "ctrl+8": "样式预设", "ctrl+9": "样式预设",
+	"space": "平移视图",
+}
+
+// Defaults 返回默认快捷键配置的副本
+func Defaults() map[string]string {
+	m := make(map[string]string, len(defaults))
+	for k, v := range defaults {
+		m[k] = v
+	}
+	return m
+}
+
+// Default 返回解析后的默认快捷键（内置表有误时 panic）
+func Default() Keymap {
+	k, err := Parse(nil)
+	if err != nil {
+		panic("keymap: 默认快捷键无效: " + err.Error())
+	}
+	return k
+}
+
+// Parse 解析快捷键配置（未配置的动作使用默认值，空字符串表示不绑定），
+// 检查未知动作、无效按键、与固定快捷键冲突以及多个动作绑定同一组合
+func Parse(m map[string]string) (Keymap, error) {
+	var problems []string
+	for action := range m {
+		if _, ok := defaults[action]; !ok {
+			problems = append(problems, fmt.Sprintf("未知的动作 %q", action))
+		}
+	}
+
+	k := make(Keymap, len(Actions))
+	owner := make(map[Chord]string)
+	for _, action := range Actions {
+		spec, ok := m[action]
+		if !ok {
+			spec = defaults[action]
+		}
+		for _, part := range strings.Split(spec, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			c, err := ParseChord(part)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", action, err))
+				continue
+			}
+			if what, ok := reserved[c.String()]; ok {
+				problems = append(problems, fmt.Sprintf("%s: %s 已被固定用于%s", action, c, what))
+				continue
+			}
+			if other, ok := owner[c]; ok && other != action {
+				problems = append(problems, fmt.Sprintf("快捷键冲突: %s 同时绑定到 %s 和 %s", c, other, action))
+				continue
+			}
+			owner[c] = action
+			k[action] = append(k[action], c)
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return k, errors.New(strings.Join(problems, "; "))
+	}
+	return k, nil
+}
+
+// Bindings 按键组合到动作的反向映射（用于按键分发）
+func (k Keymap) Bindings() map[Chord]string {
+	b := make(map[Chord]string)
+	for action, chords := range k {
+		for _, c := range chords {
+			b[c] = action
+		}
+	}
+	return b
+}
+
+// ParseChord 解析按键组合，如 "ctrl+shift+z"、"f2"、"enter"（不区分大小写）
+func ParseChord(s string) (Chord, error) {
+	var c Chord
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "+")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if i < len(parts)-1 {
+			switch p {
+			case "ctrl", "control":
+				c.Ctrl = true
+			case "shift":
+				c.Shift = true
+			case "alt":
+				c.Alt = true
+			default:
+				return Chord{}, fmt.Errorf("无效的修饰键 %q", p)
+			}
+			continue
+		}
+		vk, ok := keyCode(p)
+		if !ok {
+			return Chord{}, fmt.Errorf("无效的按键 %q", p)
+		}
+		c.Key = vk
+	}
+	return c, nil
+}
+
+// String 按键组合的规范写法（修饰键顺序为 ctrl、alt、shift）
+func (c Chord) String() string {
+	var sb strings.Builder
+	if c.Ctrl {
+		sb.WriteString("ctrl+")
+	}
+	if c.Alt {
+		sb.WriteString("alt+")
+	}
+	if c.Shift {
+		sb.WriteString("shift+")
+	}
+	sb.WriteString(keyName(c.Key))
+	return sb.String()
+}
+
+// namedKeys 非字母数字按键的名称和虚拟键码（同一键码的第一个名称为规范写法）
+var namedKeys = []struct {
+	name string
+	vk   uint16
+}{
+	{"enter", 0x0D}, {"return", 0x0D},
+	{"esc", 0x1B}, {"escape", 0x1B},
+	{"space", 0x20},
+	{"tab", 0x09},
+	{"backspace", 0x08},
+	{"delete", 0x2E}, {"del", 0x2E},
+	{"insert", 0x2D},
+	{"home", 0x24}, {"end", 0x23},
+	{"pageup", 0x21}, {"pagedown", 0x22},
+	{"left", 0x25}, {"up", 0x26}, {"right", 0x27}, {"down", 0x28},
+	{"=", 0xBB}, {"plus", 0xBB},
+	{"-", 0xBD}, {"minus", 0xBD},
+	{"[", 0xDB}, {"]", 0xDD},
+	{";", 0xBA}, {"'", 0xDE},
+	{",", 0xBC}, {"comma", 0xBC},
+	{".", 0xBE}, {"/", 0xBF}, {"\\", 0xDC}, {"`", 0xC0},
+	{"numplus", 0x6B}, {"numminus", 0x6D},
+}
+
+// keyCode 按键名称对应的虚拟键码
+func keyCode(name string) (uint16, bool) {
+	switch {
+	case len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+		return uint16(name[0] - 'a' + 'A'), true
+	case len(name) == 1 && name[0] >= '0' && name[0] <= '9':
+		return uint16(name[0]), true
+	case len(name) == 4 && strings.HasPrefix(name, "num") && name[3] >= '0' && name[3] <= '9':
+		return 0x60 + uint16(name[3]-'0'), true
+	case len(name) >= 2 && name[0] == 'f':
+		var n int
+		if _, err := fmt.Sscanf(name[1:], "%d", &n); err == nil && n >= 1 && n <= 24 && fmt.Sprint(n) == name[1:] {
+			return 0x70 + uint16(n-1), true
+		}
+	}
+	for _, k := range namedKeys {
+		if k.name == name {
+			return k.vk, true
+		}
+	}
+	return 0, false
+}
+
+// keyName 虚拟键码的规范名称
+func keyName(vk uint16) string {
+	switch {
+	case vk >= 'A' && vk <= 'Z':
+		return string(rune(vk - 'A' + 'a'))
+	case vk >= '0' && vk <= '9':
+		return string(rune(vk))
+	case vk >= 0x60 && vk <= 0x69:
+		return fmt.Sprintf("num%d", vk-0x60)
+	case vk >= 0x70 && vk <= 0x87:
+		return fmt.Sprintf("f%d", vk-0x70+1)
+	}
+	for _, k := range namedKeys {
+		if k.vk == vk {
+			return k.name
+		}
+	}
+	return fmt.Sprintf("0x%02x", vk)
+}
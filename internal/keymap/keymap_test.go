@@ -0,0 +1,62 @@
+package keymap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultsParse(t *testing.T) {
+	k, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("默认快捷键无效: %v", err)
+	}
+	for _, action := range Actions {
+		if _, ok := defaults[action]; !ok {
+			t.Errorf("动作 %s 没有默认快捷键", action)
+		}
+		if len(k[action]) == 0 {
+			t.Errorf("动作 %s 未绑定", action)
+		}
+	}
+	if len(defaults) != len(Actions) {
+		t.Errorf("默认快捷键 %d 项，动作 %d 个", len(defaults), len(Actions))
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]string
+		want string // 错误信息包含的内容，为空表示无错误
+	}{
+		{"覆盖默认值", map[string]string{"undo": "ctrl+u"}, ""},
+		{"解除绑定", map[string]string{"pad": ""}, ""},
+		{"未知动作", map[string]string{"nope": "x"}, "未知的动作"},
+		{"无效按键", map[string]string{"undo": "ctrl+nokey"}, "undo"},
+		{"固定快捷键", map[string]string{"undo": "ctrl+b"}, "已被固定"},
+		{"冲突", map[string]string{"crop": "t"}, "快捷键冲突"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.m)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("意外的错误: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("错误 = %v，应包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestChordRoundTrip(t *testing.T) {
+	for _, s := range []string{"ctrl+shift+z", "f2", "enter", "alt+1", "ctrl+]"} {
+		c, err := ParseChord(s)
+		if err != nil {
+			t.Fatalf("ParseChord(%q): %v", s, err)
+		}
+		if got := c.String(); got != s {
+			t.Errorf("ParseChord(%q).String() = %q", s, got)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"  // 注册 GIF 解码器（建立索引时读取尺寸）
+	_ "image/jpeg" // 注册 JPEG 解码器
+	_ "image/png"  // 注册 PNG 解码器
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "golang.org/x/image/bmp"  // 注册 BMP 解码器
+	_ "golang.org/x/image/tiff" // 注册 TIFF 解码器
+	_ "golang.org/x/image/webp" // 注册 WebP 解码器
+)
+
+// IndexFile 截图索引文件名（位于保存目录下）
+const IndexFile = "index.jsonl"
+
+// lockFile 索引的跨进程锁文件名（位于保存目录下）
+const lockFile = IndexFile + ".lock"
+
+const (
+	lockTimeout = 15 * time.Second // 等待其他进程释放锁的最长时间
+	lockStale   = 10 * time.Second // 锁文件超过该时间未释放视为残留（进程异常退出）
+)
+
+// Entry 索引中的一张截图
+type Entry struct {
+	Path    string    `json:"path"`              // 相对保存目录的路径（/ 分隔）
+	Time    time.Time `json:"time"`              // 截图时间
+	Width   int       `json:"width"`             // 宽度
+	Height  int       `json:"height"`            // 高度
+	Size    int64     `json:"size"`              // 文件大小
+	Hash    string    `json:"hash"`              // 文件内容的 SHA-256
+	PHash   string    `json:"phash,omitempty"`   // 感知哈希（dHash，见 FormatHash）
+	Digest  string    `json:"digest,omitempty"`  // 解码后像素内容的 SHA-256（与格式无关；有损格式保存时不记录，扫描时补全）
+	Similar string    `json:"similar,omitempty"` // 保存时发现的几乎相同的截图路径
+	Window  string    `json:"window,omitempty"`  // 截图时的前台窗口标题
+	Tags    []string  `json:"tags,omitempty"`    // 标签
+	Note    string    `json:"note,omitempty"`    // 备注
+	Source  string    `json:"source,omitempty"`  // 来源：SourceCapture 为 SnapCLI 保存的截图，为空表示扫描目录时发现的文件
+	Deleted bool      `json:"deleted,omitempty"` // 删除标记（Remove 追加的记录）
+}
+
+// SourceCapture 由 Storage.Save 保存的截图（只有这类截图参与保留策略清理）
+const SourceCapture = "capture"
+
+// HasTag 是否带有标签（不区分大小写）
+func (e *Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Catalog 截图索引。索引文件每行一条 JSON 记录，只追加写入：
+// 同一路径以最后一条记录为准，Deleted 记录表示文件已删除。
+// 过期记录过多时重写索引文件。
+// 托盘程序和命令行可能同时修改索引，追加和读取-修改-重写都在锁文件保护下进行（见 lock）
+type Catalog struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewCatalog 创建保存目录 dir 的索引
+func NewCatalog(dir string) *Catalog {
+	return &Catalog{dir: dir}
+}
+
+// Dir 保存目录
+func (c *Catalog) Dir() string {
+	return c.dir
+}
+
+// Abs 索引路径对应的文件路径
+func (c *Catalog) Abs(rel string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(rel))
+}
+
+// Rel 文件路径对应的索引路径，文件不在保存目录下时返回 false
+func (c *Catalog) Rel(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	dir, err := filepath.Abs(c.dir)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Add 添加（或替换）记录
+func (c *Catalog) Add(e Entry) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.append(e)
+}
+
+// Update 修改 path 对应的记录，记录不存在时返回错误
+func (c *Catalog) Update(path string, fn func(e *Entry)) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, stale, err := c.load()
+	if err != nil {
+		return err
+	}
+	e, ok := entries[path]
+	if !ok {
+		return fmt.Errorf("索引中没有 %s", path)
+	}
+	fn(&e)
+	e.Path = path
+	if stale+1 > len(entries) {
+		entries[path] = e
+		return c.rewrite(entries)
+	}
+	return c.append(e)
+}
+
+// Remove 从索引中移除记录
+func (c *Catalog) Remove(paths ...string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for _, p := range paths {
+		if err := c.append(Entry{Path: p, Deleted: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entries 返回所有记录（按时间排序）。
+// 读取不需要锁文件：重写是原子的改名，追加的记录一次写入一行
+func (c *Catalog) Entries() ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, _, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return sortedEntries(entries), nil
+}
+
+// Sync 将保存目录中未建立索引的图片加入索引，并移除已不存在的文件，返回添加和移除的数量。
+// 同时为缺少感知哈希或像素摘要的记录补全（从文件解码计算）。
+// 扫描目录（解码图片）时不持有锁，重写前重新读取索引，保留扫描期间其他进程写入的记录
+func (c *Catalog) Sync() (added, removed int, err error) {
+	c.mu.Lock()
+	base, _, err := c.load()
+	c.mu.Unlock()
+	if err != nil {
+		return 0, 0, err
+	}
+	scanned := make(map[string]Entry, len(base))
+	for path, e := range base {
+		scanned[path] = e
+	}
+	if added, removed, err = c.sync(scanned); err != nil {
+		return added, removed, err
+	}
+
+	unlock, err := c.lock()
+	if err != nil {
+		return added, removed, err
+	}
+	defer unlock()
+	entries, _, err := c.load()
+	if err != nil {
+		return added, removed, err
+	}
+	for path := range base {
+		if _, ok := scanned[path]; !ok {
+			delete(entries, path) // 文件已不存在
+		}
+	}
+	for path, e := range scanned {
+		cur, ok := entries[path]
+		switch {
+		case !ok:
+			if _, indexed := base[path]; !indexed {
+				entries[path] = e // 新发现的文件（扫描期间被移除的记录不恢复）
+			}
+		case cur.PHash == "" || cur.Digest == "":
+			cur.PHash, cur.Digest = e.PHash, e.Digest
+			entries[path] = cur
+		}
+	}
+	return added, removed, c.rewrite(entries)
+}
+
+// Scan 与 Sync 相同地扫描保存目录，但不写入索引文件，返回扫描后的记录（按时间排序）
+func (c *Catalog) Scan() ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, _, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := c.sync(entries); err != nil {
+		return nil, err
+	}
+	return sortedEntries(entries), nil
+}
+
+// sync 按保存目录中的文件更新 entries（路径到记录），返回添加和移除的数量
+func (c *Catalog) sync(entries map[string]Entry) (added, removed int, err error) {
+	for path, e := range entries {
+		if _, err := os.Stat(c.Abs(path)); os.IsNotExist(err) {
+			delete(entries, path)
+			removed++
+			continue
+		}
+		if e.PHash == "" || e.Digest == "" {
+			if scanned, err := ScanFile(c.Abs(path)); err == nil {
+				e.PHash, e.Digest = scanned.PHash, scanned.Digest
+				entries[path] = e
+			}
+		}
+	}
+	err = filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		// 跳过隐藏目录（缩略图、回收站等）
+		if d.IsDir() {
+			if path != c.dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(path)
+		if !HasFormat(strings.TrimPrefix(strings.ToLower(ext), ".")) || strings.HasSuffix(strings.TrimSuffix(d.Name(), ext), "_original") {
+			return nil // 跳过非图片和缩小前保留的原图
+		}
+		rel, ok := c.Rel(path)
+		if !ok {
+			return nil
+		}
+		if _, ok := entries[rel]; ok {
+			return nil
+		}
+		e, err := ScanFile(path)
+		if err != nil {
+			return nil // 无法解码的文件不加入索引
+		}
+		e.Path = rel
+		entries[rel] = e
+		added++
+		return nil
+	})
+	return added, removed, err
+}
+
+// ScanFile 读取图片文件生成索引记录（不含 Path）：尺寸、大小、文件哈希和感知哈希，
+// PNG 中有截图元数据时使用其中的截图时间和窗口标题，否则使用文件修改时间
+func ScanFile(path string) (Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Entry{}, err
+	}
+	sum := sha256.Sum256(data)
+	e := Entry{
+		Time:   st.ModTime(),
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Size:   int64(len(data)),
+		Hash:   hex.EncodeToString(sum[:]),
+		PHash:  FormatHash(DHash(img)),
+		Digest: pixelDigest(img),
+	}
+	if meta, err := ReadMetadata(bytes.NewReader(data)); err == nil {
+		if t, err := time.Parse(time.RFC3339, meta[MetaCreationTime]); err == nil {
+			e.Time = t
+		}
+		e.Window = meta[MetaWindow]
+	}
+	return e, nil
+}
+
+// lock 获取索引的写锁，返回释放锁的函数。进程内使用互斥锁，进程之间以独占方式创建锁文件；
+// 锁文件超过 lockStale 未释放时视为残留并删除，等待超过 lockTimeout 时返回错误
+func (c *Catalog) lock() (func(), error) {
+	c.mu.Lock()
+	path := filepath.Join(c.dir, lockFile)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() {
+				os.Remove(path)
+				c.mu.Unlock()
+			}, nil
+		}
+		// Windows 上锁文件正在被删除时返回拒绝访问，同样等待重试
+		if !os.IsExist(err) && !os.IsPermission(err) {
+			c.mu.Unlock()
+			return nil, err
+		}
+		if st, err := os.Stat(path); err == nil && time.Since(st.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("索引正被其他进程修改（如确认没有其他 snapcli 进程，可删除 %s）", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// append 在索引文件末尾追加一条记录
+func (c *Catalog) append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(c.dir, IndexFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// load 读取索引，返回每个路径的最新记录和被覆盖的过期记录数（无法解析的行跳过）
+func (c *Catalog) load() (map[string]Entry, int, error) {
+	entries := make(map[string]Entry)
+	f, err := os.Open(filepath.Join(c.dir, IndexFile))
+	if os.IsNotExist(err) {
+		return entries, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	stale := 0
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e Entry
+			if json.Unmarshal(line, &e) == nil && e.Path != "" {
+				if _, ok := entries[e.Path]; ok {
+					stale++
+				}
+				if e.Deleted {
+					delete(entries, e.Path)
+					stale++
+				} else {
+					entries[e.Path] = e
+				}
+			}
+		}
+		if err == io.EOF {
+			return entries, stale, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// rewrite 只保留最新记录，重写索引文件（先写临时文件再改名）
+func (c *Catalog) rewrite(entries map[string]Entry) error {
+	tmp, err := os.CreateTemp(c.dir, ".snapcli-*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	for _, e := range sortedEntries(entries) {
+		line, err := json.Marshal(e)
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	err = w.Flush()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, IndexFile))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// sortedEntries 按时间（相同时按路径）排序
+func sortedEntries(entries map[string]Entry) []Entry {
+	list := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Time.Equal(list[j].Time) {
+			return list[i].Time.Before(list[j].Time)
+		}
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
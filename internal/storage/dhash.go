@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// 差值哈希（dHash）：将图片按面积平均缩小为 9x8 的灰度图，每行相邻两格比较亮度得到 64 位。
+// 对缩放、压缩和轻微的颜色变化不敏感，汉明距离越小图片越相似
+
+const (
+	dhashWidth  = 9
+	dhashHeight = 8
+)
+
+// DHash 计算图片的差值哈希
+func DHash(img image.Image) uint64 {
+	src := toRGBA(img)
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	var sum [dhashHeight][dhashWidth]int64
+	var count [dhashHeight][dhashWidth]int64
+	for y := 0; y < h; y++ {
+		cy := y * dhashHeight / h
+		i := src.PixOffset(b.Min.X, b.Min.Y+y)
+		for x := 0; x < w; x++ {
+			cx := x * dhashWidth / w
+			p := src.Pix[i : i+3 : i+3]
+			sum[cy][cx] += 299*int64(p[0]) + 587*int64(p[1]) + 114*int64(p[2])
+			count[cy][cx]++
+			i += 4
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < dhashHeight; y++ {
+		for x := 0; x < dhashWidth-1; x++ {
+			hash <<= 1
+			// 比较平均亮度（交叉相乘避免除法；图片小于 9x8 时部分格子为空）
+			if sum[y][x]*count[y][x+1] < sum[y][x+1]*count[y][x] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// FormatHash 将哈希格式化为 16 位十六进制
+func FormatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParseHash 解析 FormatHash 的结果
+func ParseHash(s string) (uint64, bool) {
+	if len(s) != 16 {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 16, 64)
+	return v, err == nil
+}
+
+// HashDistance 两个哈希的汉明距离（0-64）
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// pixelDigest 图片尺寸和像素内容的 SHA-256（与编码格式和元数据无关，用于判断截图完全相同）
+func pixelDigest(img image.Image) string {
+	src := toRGBA(img)
+	b := src.Bounds()
+	h := sha256.New()
+	var size [8]byte
+	binary.BigEndian.PutUint32(size[:4], uint32(b.Dx()))
+	binary.BigEndian.PutUint32(size[4:], uint32(b.Dy()))
+	h.Write(size[:])
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := src.PixOffset(b.Min.X, y)
+		h.Write(src.Pix[i : i+4*b.Dx()])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Duplicates 将截图（按时间排序）按内容分组，返回包含多张截图的组（组内按时间排序，第一张为保留的截图）。
+// 每张截图只与各组的第一张比较，不会经由中间的截图把差异较大的截图连成一组。
+// distance 为 0 时只合并像素完全相同的截图，否则同时合并感知哈希距离不超过 distance 的截图
+func Duplicates(entries []Entry, distance int) [][]Entry {
+	var groups [][]Entry
+	var hashes []uint64 // 各组第一张截图的感知哈希
+	var valid []bool
+	byDigest := make(map[string]int) // 像素摘要到组的索引（只记录各组第一张截图）
+
+	for _, e := range entries {
+		g := -1
+		if i, ok := byDigest[e.Digest]; ok && e.Digest != "" {
+			g = i
+		} else if hash, ok := ParseHash(e.PHash); ok && distance > 0 {
+			best := distance + 1
+			for i := range groups {
+				if d := HashDistance(hash, hashes[i]); valid[i] && d < best {
+					g, best = i, d
+				}
+			}
+		}
+		if g >= 0 {
+			groups[g] = append(groups[g], e)
+			continue
+		}
+
+		if e.Digest != "" {
+			byDigest[e.Digest] = len(groups)
+		}
+		hash, ok := ParseHash(e.PHash)
+		groups = append(groups, []Entry{e})
+		hashes = append(hashes, hash)
+		valid = append(valid, ok)
+	}
+
+	var dups [][]Entry
+	for _, g := range groups {
+		if len(g) > 1 {
+			dups = append(dups, g)
+		}
+	}
+	return dups
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	e := func(path, digest string, hash uint64) Entry {
+		return Entry{Path: path, Digest: digest, PHash: FormatHash(hash)}
+	}
+	tests := []struct {
+		name     string
+		entries  []Entry
+		distance int
+		want     []string // 各组的路径（逗号分隔）
+	}{
+		{"像素相同", []Entry{e("a", "d1", 0), e("b", "d2", 0), e("c", "d1", 0)}, 0, []string{"a,c"}},
+		{"无摘要不合并", []Entry{e("a", "", 0), e("b", "", 0)}, 0, nil},
+		{"感知哈希相近", []Entry{e("a", "d1", 0), e("b", "d2", 0b11)}, 2, []string{"a,b"}},
+		// b 与 a、c 都相近，但 c 与保留的 a 相差太远，不应连成一组
+		{"不传递", []Entry{e("a", "d1", 0), e("b", "d2", 0b11), e("c", "d3", 0b1111)}, 2, []string{"a,b"}},
+		{"选最近的组", []Entry{e("a", "d1", 0), e("b", "d2", 0xff00), e("c", "d3", 0xff01)}, 4, []string{"b,c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, g := range Duplicates(tt.entries, tt.distance) {
+				var paths []string
+				for _, e := range g {
+					paths = append(paths, e.Path)
+				}
+				got = append(got, strings.Join(paths, ","))
+			}
+			if strings.Join(got, ";") != strings.Join(tt.want, ";") {
+				t.Errorf("Duplicates = %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// jpegMinQuality 按文件大小搜索 JPEG 质量时的最低质量（仍超出限制时改为缩小图片）
+const jpegMinQuality = 30
+
+// EncodeOptions 编码参数（各格式只使用与其相关的字段）
+type EncodeOptions struct {
+	Quality     int                  // jpg：质量 1-100
+	MaxBytes    int64                // jpg：文件大小上限（0 表示不限制），最低质量仍超出时按最低质量编码
+	Colors      int                  // png：调色板颜色数（0 表示全彩）；gif：颜色数（0 表示 256）
+	Dither      bool                 // png/gif：调色板量化时抖动
+	Compression png.CompressionLevel // png：压缩级别；tiff：NoCompression 时不压缩，否则 Deflate
+}
+
+// Encoder 图片编码器
+type Encoder func(w io.Writer, img image.Image, opts EncodeOptions) error
+
+// encoders 按格式名称（即文件扩展名）注册的编码器
+var encoders = map[string]Encoder{
+	"png":  encodePNG,
+	"jpg":  encodeJPEG,
+	"jpeg": encodeJPEG,
+	"gif":  encodeGIF,
+	"bmp":  encodeBMP,
+	"tiff": encodeTIFF,
+	"webp": encodeWebP,
+}
+
+// RegisterEncoder 注册（或替换）格式的编码器
+func RegisterEncoder(format string, enc Encoder) {
+	encoders[format] = enc
+}
+
+// HasFormat 是否支持该格式
+func HasFormat(format string) bool {
+	_, ok := encoders[format]
+	return ok
+}
+
+// Formats 支持的格式名称（排序后）
+func Formats() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// encodePNG 编码 PNG，设置了颜色数时先量化为调色板图片
+func encodePNG(w io.Writer, img image.Image, opts EncodeOptions) error {
+	if opts.Colors > 0 {
+		img = Quantize(img, opts.Colors, opts.Dither)
+	}
+	enc := png.Encoder{CompressionLevel: opts.Compression}
+	return enc.Encode(w, img)
+}
+
+// encodeGIF 编码 GIF（使用中位切分量化，不使用标准库的固定调色板）
+func encodeGIF(w io.Writer, img image.Image, opts EncodeOptions) error {
+	colors := opts.Colors
+	if colors <= 0 {
+		colors = 256
+	}
+	return gif.Encode(w, Quantize(img, colors, opts.Dither), nil)
+}
+
+// encodeBMP 编码 BMP
+func encodeBMP(w io.Writer, img image.Image, _ EncodeOptions) error {
+	return bmp.Encode(w, img)
+}
+
+// encodeTIFF 编码 TIFF
+func encodeTIFF(w io.Writer, img image.Image, opts EncodeOptions) error {
+	compression := tiff.Deflate
+	if opts.Compression == png.NoCompression {
+		compression = tiff.Uncompressed
+	}
+	return tiff.Encode(w, img, &tiff.Options{Compression: compression})
+}
+
+// encodeJPEG 编码 JPEG。设置了 MaxBytes 时查找不超过限制的最高质量（不高于 Quality），
+// 最低质量仍超出时使用最低质量（缩小图片由 fitJPEGSize 在编码前完成）
+func encodeJPEG(w io.Writer, img image.Image, opts EncodeOptions) error {
+	if opts.MaxBytes <= 0 {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: opts.Quality})
+	}
+	data, _, err := fitQuality(img, min(jpegMinQuality, opts.Quality), opts.Quality, opts.MaxBytes)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// fitJPEGSize 以最低质量编码仍超出 maxBytes 时按比例缩小图片，返回缩小后的图片（最长边不小于 16）
+func fitJPEGSize(img image.Image, quality int, maxBytes int64) (image.Image, error) {
+	for {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: min(jpegMinQuality, quality)}); err != nil {
+			return nil, err
+		}
+		b := img.Bounds()
+		if int64(buf.Len()) <= maxBytes || max(b.Dx(), b.Dy()) <= 16 {
+			return img, nil
+		}
+		// 文件大小与像素数近似成正比，按比例缩小并留 10% 余量
+		scale := math.Sqrt(float64(maxBytes)/float64(buf.Len())) * 0.9
+		img = Downscale(img, max(1, int(float64(max(b.Dx(), b.Dy()))*scale)), 0)
+	}
+}
+
+// fitQuality 二分查找编码后不超过 maxBytes 的最高质量（lo-hi），返回该质量的编码结果；
+// 最低质量也超出时返回最低质量的结果和 false
+func fitQuality(img image.Image, lo, hi int, maxBytes int64) ([]byte, bool, error) {
+	encode := func(q int) ([]byte, error) {
+		var buf bytes.Buffer
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q})
+		return buf.Bytes(), err
+	}
+
+	best, err := encode(hi)
+	if err != nil || int64(len(best)) <= maxBytes {
+		return best, err == nil, err
+	}
+	best, err = encode(lo)
+	if err != nil || int64(len(best)) > maxBytes {
+		return best, false, err
+	}
+	// lo 满足限制，hi 超出
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		data, err := encode(mid)
+		if err != nil {
+			return nil, false, err
+		}
+		if int64(len(data)) <= maxBytes {
+			lo, best = mid, data
+		} else {
+			hi = mid
+		}
+	}
+	return best, true, nil
+}
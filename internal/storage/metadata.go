@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// Metadata 写入 PNG 的文本元数据（键名 -> 内容），保存为其他格式时忽略
+type Metadata map[string]string
+
+// 元数据键名（Creation Time、Software 为 PNG 标准关键字）
+const (
+	MetaCreationTime = "Creation Time"       // 截图时间（RFC 3339）
+	MetaSoftware     = "Software"            // 软件名称和版本
+	MetaWindow       = "SnapCLI:Window"      // 截图时的前台窗口标题
+	MetaRegion       = "SnapCLI:Region"      // 选区（虚拟屏幕坐标）：x,y,宽x高
+	MetaDisplay      = "SnapCLI:Display"     // 选区所在显示器序号
+	MetaScale        = "SnapCLI:Scale"       // 显示器缩放比例
+	MetaAnnotations  = "SnapCLI:Annotations" // 标注列表（Annotation 的 JSON 数组，图片像素坐标）
+	MetaTransform    = "SnapCLI:Transform"   // 虚拟屏幕坐标到图片像素坐标的变换（见 Transform.String）
+)
+
+const (
+	pngHeaderSize     = 33   // 签名（8 字节）+ IHDR 块（25 字节）
+	pngCompressAbove  = 1024 // 超过该长度的内容压缩存储（iTXt 压缩标志）
+	maxPNGKeywordSize = 79   // 关键字最大长度
+	maxPNGChunkSize   = 1 << 26
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngTextWriter 在 PNG 的 IHDR 块之后插入文本块。
+// 输出不是 PNG 时原样写出（编码器不关心元数据，任何格式都可以经过该 Writer）
+type pngTextWriter struct {
+	w      io.Writer
+	chunks []byte // 待插入的文本块
+	head   []byte // 缓存的文件头
+	done   bool
+}
+
+// newPNGTextWriter 创建插入文本块的 Writer，写完后需调用 flush
+func newPNGTextWriter(w io.Writer, meta Metadata) *pngTextWriter {
+	return &pngTextWriter{w: w, chunks: textChunks(meta)}
+}
+
+func (t *pngTextWriter) Write(p []byte) (int, error) {
+	if t.done {
+		return t.w.Write(p)
+	}
+	n := min(len(p), pngHeaderSize-len(t.head))
+	t.head = append(t.head, p[:n]...)
+	if len(t.head) < pngHeaderSize {
+		return len(p), nil
+	}
+	if err := t.flush(); err != nil {
+		return 0, err
+	}
+	if _, err := t.w.Write(p[n:]); err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+// flush 写出缓存的文件头（是 PNG 时附加文本块）
+func (t *pngTextWriter) flush() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	out := t.head
+	if len(out) == pngHeaderSize && bytes.HasPrefix(out, pngSignature) && string(out[12:16]) == "IHDR" {
+		out = append(out, t.chunks...)
+	}
+	_, err := t.w.Write(out)
+	return err
+}
+
+// textChunks 按键名顺序生成文本块：ASCII 内容使用 tEXt，其他使用 iTXt（UTF-8），较长的内容压缩
+func textChunks(meta Metadata) []byte {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		if k != "" && len(k) <= maxPNGKeywordSize && isASCII(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		v := meta[k]
+		if isASCII(v) && len(v) <= pngCompressAbove {
+			writeChunk(&buf, "tEXt", []byte(k+"\x00"+v))
+			continue
+		}
+		// iTXt：关键字、压缩标志、压缩方法、语言标签、翻译后的关键字、内容
+		data := []byte(k + "\x00")
+		text := []byte(v)
+		if len(v) > pngCompressAbove {
+			var z bytes.Buffer
+			zw := zlib.NewWriter(&z)
+			zw.Write(text)
+			zw.Close()
+			data = append(data, 1, 0)
+			text = z.Bytes()
+		} else {
+			data = append(data, 0, 0)
+		}
+		data = append(data, 0, 0)
+		writeChunk(&buf, "iTXt", append(data, text...))
+	}
+	return buf.Bytes()
+}
+
+// writeChunk 写入 PNG 块（长度、类型、数据、CRC）
+func writeChunk(buf *bytes.Buffer, typ string, data []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(data)))
+	buf.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	buf.WriteString(typ)
+	buf.Write(data)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	buf.Write(n[:])
+}
+
+// isASCII 是否只包含 ASCII 字符（tEXt 使用 Latin-1，非 ASCII 内容改用 iTXt）
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadMetadata 读取 PNG 中的文本元数据（tEXt、zTXt、iTXt）
+func ReadMetadata(r io.Reader) (Metadata, error) {
+	sig := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, sig); err != nil || !bytes.Equal(sig, pngSignature) {
+		return nil, errors.New("不是 PNG 文件")
+	}
+
+	meta := Metadata{}
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return meta, fmt.Errorf("PNG 文件不完整: %v", err)
+		}
+		size := binary.BigEndian.Uint32(hdr[:4])
+		typ := string(hdr[4:8])
+		if size > maxPNGChunkSize {
+			return meta, fmt.Errorf("PNG 块 %q 过大", typ)
+		}
+		switch typ {
+		case "IEND":
+			return meta, nil
+		case "tEXt", "zTXt", "iTXt":
+			data := make([]byte, size+4)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return meta, fmt.Errorf("PNG 文件不完整: %v", err)
+			}
+			crc := crc32.NewIEEE()
+			crc.Write(hdr[4:8])
+			crc.Write(data[:size])
+			if crc.Sum32() != binary.BigEndian.Uint32(data[size:]) {
+				return meta, fmt.Errorf("PNG 块 %q 校验失败", typ)
+			}
+			if k, v, err := parseTextChunk(typ, data[:size]); err == nil {
+				meta[k] = v
+			}
+		default:
+			// 跳过数据和 CRC
+			if _, err := io.CopyN(io.Discard, r, int64(size)+4); err != nil {
+				return meta, fmt.Errorf("PNG 文件不完整: %v", err)
+			}
+		}
+	}
+}
+
+// parseTextChunk 解析文本块，返回关键字和内容
+func parseTextChunk(typ string, data []byte) (string, string, error) {
+	key, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", "", errors.New("缺少关键字")
+	}
+	switch typ {
+	case "tEXt":
+		return string(key), latin1(rest), nil
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", errors.New("缺少压缩方法")
+		}
+		text, err := inflate(rest[1:])
+		return string(key), latin1(text), err
+	}
+
+	// iTXt
+	if len(rest) < 2 {
+		return "", "", errors.New("缺少压缩标志")
+	}
+	compressed := rest[0] == 1
+	_, rest, ok = bytes.Cut(rest[2:], []byte{0}) // 语言标签
+	if ok {
+		_, rest, ok = bytes.Cut(rest, []byte{0}) // 翻译后的关键字
+	}
+	if !ok {
+		return "", "", errors.New("iTXt 格式错误")
+	}
+	if compressed {
+		text, err := inflate(rest)
+		return string(key), string(text), err
+	}
+	return string(key), string(rest), nil
+}
+
+// inflate 解压 zlib 数据
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxPNGChunkSize))
+}
+
+// latin1 将 Latin-1 字节转换为 UTF-8 字符串
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
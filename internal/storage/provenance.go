@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Annotation 写入元数据的标注（MetaAnnotations 为其 JSON 数组）。
+// 格式与编辑器内部的结构无关：工具使用配置文件中的名称，坐标为保存的图片的像素坐标。
+// 标注已绘制在图片中，记录只用于查看来源，不能导回编辑器重新编辑
+type Annotation struct {
+	Tool     string   `json:"tool"`               // 工具名称，如 rect、arrow、text
+	Points   [][2]int `json:"points"`             // 路径点
+	Color    string   `json:"color"`              // 颜色，如 #ff0000ff
+	Width    int      `json:"width,omitempty"`    // 线宽
+	Text     string   `json:"text,omitempty"`     // 文本内容
+	FontSize int      `json:"fontSize,omitempty"` // 字号
+	Filled   bool     `json:"filled,omitempty"`   // 是否填充
+	Opacity  int      `json:"opacity,omitempty"`  // 不透明度百分比（0 表示不透明）
+	Rotation float64  `json:"rotation,omitempty"` // 旋转角度（度）
+}
+
+// scale 按图片的缩放比例换算坐标、线宽和字号
+func (a Annotation) scale(sx, sy float64) Annotation {
+	if sx == 1 && sy == 1 {
+		return a
+	}
+	points := make([][2]int, len(a.Points))
+	for i, p := range a.Points {
+		points[i] = [2]int{int(math.Round(float64(p[0]) * sx)), int(math.Round(float64(p[1]) * sy))}
+	}
+	a.Points = points
+	s := (sx + sy) / 2
+	if a.Width > 0 {
+		a.Width = max(1, int(math.Round(float64(a.Width)*s)))
+	}
+	if a.FontSize > 0 {
+		a.FontSize = max(1, int(math.Round(float64(a.FontSize)*s)))
+	}
+	return a
+}
+
+// ReadAnnotations 解析元数据中的标注列表（没有标注时返回 nil）
+func ReadAnnotations(meta Metadata) ([]Annotation, error) {
+	v, ok := meta[MetaAnnotations]
+	if !ok {
+		return nil, nil
+	}
+	var anns []Annotation
+	if err := json.Unmarshal([]byte(v), &anns); err != nil {
+		return nil, err
+	}
+	return anns, nil
+}
+
+// Transform 仿射变换：(x, y) 映射为 (A*x + B*y + C, D*x + E*y + F)
+type Transform struct {
+	A, B, C float64
+	D, E, F float64
+}
+
+// Translate 平移变换
+func Translate(dx, dy float64) Transform {
+	return Transform{A: 1, C: dx, E: 1, F: dy}
+}
+
+// Then 先做 t 再做 u 的组合变换
+func (t Transform) Then(u Transform) Transform {
+	return Transform{
+		A: u.A*t.A + u.B*t.D,
+		B: u.A*t.B + u.B*t.E,
+		C: u.A*t.C + u.B*t.F + u.C,
+		D: u.D*t.A + u.E*t.D,
+		E: u.D*t.B + u.E*t.E,
+		F: u.D*t.C + u.E*t.F + u.F,
+	}
+}
+
+// Apply 映射一个点
+func (t Transform) Apply(x, y float64) (float64, float64) {
+	return t.A*x + t.B*y + t.C, t.D*x + t.E*y + t.F
+}
+
+// String 格式化为 "A,B,C,D,E,F"（MetaTransform 的格式）
+func (t Transform) String() string {
+	vals := []float64{t.A, t.B, t.C, t.D, t.E, t.F}
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// metadata 生成写入图片的元数据：图片相对传入 Save 的图片缩放了 sx/sy 倍时，
+// 标注和坐标变换随之换算，保证元数据中的坐标与保存的像素一致
+func (info SaveInfo) metadata(sx, sy float64) Metadata {
+	if len(info.Annotations) == 0 && info.Transform == nil {
+		return info.Metadata
+	}
+	meta := make(Metadata, len(info.Metadata)+2)
+	for k, v := range info.Metadata {
+		meta[k] = v
+	}
+	if info.Transform != nil {
+		meta[MetaTransform] = info.Transform.Then(Transform{A: sx, E: sy}).String()
+	}
+	if len(info.Annotations) > 0 {
+		anns := make([]Annotation, len(info.Annotations))
+		for i, a := range info.Annotations {
+			anns[i] = a.scale(sx, sy)
+		}
+		if data, err := json.Marshal(anns); err == nil {
+			meta[MetaAnnotations] = string(data)
+		}
+	}
+	return meta
+}
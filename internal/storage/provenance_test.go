@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"image"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestSaveScalesProvenance(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStorage(Options{Directory: dir, Format: "png", MaxEdge: 100})
+
+	// 200x100 的图片缩小为 100x50：元数据中的坐标随之减半
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	transform := Translate(-1000, -500)
+	res, err := s.Save(img, SaveInfo{
+		Metadata:    Metadata{MetaWindow: "w"},
+		Annotations: []Annotation{{Tool: "rect", Points: [][2]int{{20, 10}, {120, 60}}, Width: 4}},
+		Transform:   &transform,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(res.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := ReadMetadata(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	anns, err := ReadAnnotations(meta)
+	if err != nil || len(anns) != 1 {
+		t.Fatalf("ReadAnnotations = %v, %v", anns, err)
+	}
+	if got := anns[0]; got.Points[0] != [2]int{10, 5} || got.Points[1] != [2]int{60, 30} || got.Width != 2 {
+		t.Errorf("标注 = %+v，应缩小一半", got)
+	}
+	if meta[MetaTransform] != "0.5,0,-500,0,0.5,-250" {
+		t.Errorf("变换 = %q", meta[MetaTransform])
+	}
+	if meta[MetaWindow] != "w" {
+		t.Errorf("其他元数据丢失: %v", meta)
+	}
+}
+
+func TestTransformThen(t *testing.T) {
+	// 平移后逆时针旋转 90°（x' = y，y' = -x），再放大 2 倍
+	tr := Translate(1, 2).Then(Transform{B: 1, D: -1}).Then(Transform{A: 2, E: 2})
+	x, y := tr.Apply(3, 4)
+	if math.Abs(x-12) > 1e-9 || math.Abs(y+8) > 1e-9 {
+		t.Errorf("Apply(3, 4) = (%v, %v)，应为 (12, -8)", x, y)
+	}
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// 中位切分量化：颜色先按每通道 5 位（alpha 3 位）归并为直方图，
+// 再反复沿范围最大的通道在加权中位数处切分颜色盒，每个盒的加权平均色作为调色板颜色。
+// 截图中的颜色数不超过上限时直接使用原色，结果无损。
+
+// bucket 直方图中的一格（归并后的颜色）
+type bucket struct {
+	sum   [4]int // 各通道累加值（预乘 RGBA）
+	count int    // 像素数
+	mean  [4]int // 平均颜色
+}
+
+// colorBox 中位切分中的颜色盒
+type colorBox struct {
+	buckets []*bucket
+	count   int
+	ch, rng int // 取值范围最大的通道及其范围
+}
+
+// newBox 创建颜色盒并计算切分通道
+func newBox(buckets []*bucket, count int) colorBox {
+	box := colorBox{buckets: buckets, count: count}
+	box.ch, box.rng = widestChannel(buckets)
+	return box
+}
+
+// Quantize 将图片量化为不超过 colors 种颜色的调色板图片，dither 为 true 时使用 Floyd-Steinberg 抖动
+func Quantize(img image.Image, colors int, dither bool) *image.Paletted {
+	colors = max(2, min(256, colors))
+	src := toRGBA(img)
+	b := src.Bounds()
+
+	// 颜色数不超过上限：直接使用原色
+	if pal, ok := exactPalette(src, colors); ok {
+		dst := image.NewPaletted(b, pal)
+		index := make(map[color.RGBA]uint8, len(pal))
+		for i, c := range pal {
+			index[c.(color.RGBA)] = uint8(i)
+		}
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			si := src.PixOffset(b.Min.X, y)
+			di := dst.PixOffset(b.Min.X, y)
+			for x := b.Min.X; x < b.Max.X; x++ {
+				p := src.Pix[si : si+4 : si+4]
+				dst.Pix[di] = index[color.RGBA{p[0], p[1], p[2], p[3]}]
+				si += 4
+				di++
+			}
+		}
+		return dst
+	}
+
+	pal := medianCut(histogram(src), colors)
+	dst := image.NewPaletted(b, pal)
+	if dither {
+		ditherFS(dst, src, newMapper(pal, true))
+		return dst
+	}
+	m := newMapper(pal, false)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		si := src.PixOffset(b.Min.X, y)
+		di := dst.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := src.Pix[si : si+4 : si+4]
+			dst.Pix[di] = m.index(int(p[0]), int(p[1]), int(p[2]), int(p[3]))
+			si += 4
+			di++
+		}
+	}
+	return dst
+}
+
+// toRGBA 转换为 *image.RGBA（已是时直接返回）
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, img, b.Min, draw.Src)
+	return rgba
+}
+
+// exactPalette 收集图片中的全部颜色，超过 limit 种时返回 false
+func exactPalette(img *image.RGBA, limit int) (color.Palette, bool) {
+	seen := make(map[color.RGBA]struct{}, limit+1)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			seen[color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}] = struct{}{}
+			if len(seen) > limit {
+				return nil, false
+			}
+			i += 4
+		}
+	}
+	pal := make(color.Palette, 0, len(seen))
+	for c := range seen {
+		pal = append(pal, c)
+	}
+	return pal, true
+}
+
+// reducedKey 归并后的颜色键（RGB 各 5 位，alpha 3 位）
+func reducedKey(r, g, b, a int) int {
+	return r>>3<<13 | g>>3<<8 | b>>3<<3 | a>>5
+}
+
+// histogram 统计归并后的颜色直方图
+func histogram(img *image.RGBA) []*bucket {
+	hist := make(map[int]*bucket)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := img.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := img.Pix[i : i+4 : i+4]
+			k := reducedKey(int(p[0]), int(p[1]), int(p[2]), int(p[3]))
+			h := hist[k]
+			if h == nil {
+				h = &bucket{}
+				hist[k] = h
+			}
+			for c := 0; c < 4; c++ {
+				h.sum[c] += int(p[c])
+			}
+			h.count++
+			i += 4
+		}
+	}
+
+	buckets := make([]*bucket, 0, len(hist))
+	for _, h := range hist {
+		for c := 0; c < 4; c++ {
+			h.mean[c] = (h.sum[c] + h.count/2) / h.count
+		}
+		buckets = append(buckets, h)
+	}
+	return buckets
+}
+
+// medianCut 将直方图切分为不超过 n 个颜色盒，返回各盒的平均颜色
+func medianCut(buckets []*bucket, n int) color.Palette {
+	total := 0
+	for _, h := range buckets {
+		total += h.count
+	}
+	boxes := []colorBox{newBox(buckets, total)}
+
+	for len(boxes) < n {
+		// 选择 范围 × 像素数 最大、可以切分的盒
+		best, bestScore := -1, 0
+		for i, box := range boxes {
+			if score := box.rng * box.count; box.rng > 0 && score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		// 按该通道排序，在加权中位数处切分
+		box := boxes[best]
+		bestCh := box.ch
+		sort.Slice(box.buckets, func(i, j int) bool {
+			return box.buckets[i].mean[bestCh] < box.buckets[j].mean[bestCh]
+		})
+		acc, cut := 0, 1
+		for i, h := range box.buckets[:len(box.buckets)-1] {
+			acc += h.count
+			cut = i + 1
+			if acc*2 >= box.count {
+				break
+			}
+		}
+		boxes[best] = newBox(box.buckets[:cut], acc)
+		boxes = append(boxes, newBox(box.buckets[cut:], box.count-acc))
+	}
+
+	pal := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [4]int
+		for _, h := range box.buckets {
+			for c := 0; c < 4; c++ {
+				sum[c] += h.sum[c]
+			}
+		}
+		var v [4]uint8
+		for c := 0; c < 4; c++ {
+			v[c] = uint8((sum[c] + box.count/2) / box.count)
+		}
+		// 预乘颜色的分量不能超过 alpha
+		pal = append(pal, color.RGBA{min(v[0], v[3]), min(v[1], v[3]), min(v[2], v[3]), v[3]})
+	}
+	return pal
+}
+
+// widestChannel 颜色盒中取值范围最大的通道及其范围
+func widestChannel(buckets []*bucket) (ch, rng int) {
+	for c := 0; c < 4; c++ {
+		lo, hi := 255, 0
+		for _, h := range buckets {
+			lo = min(lo, h.mean[c])
+			hi = max(hi, h.mean[c])
+		}
+		if hi-lo > rng {
+			ch, rng = c, hi-lo
+		}
+	}
+	return ch, rng
+}
+
+// mapper 颜色到调色板索引的映射（缓存已查找过的颜色）。
+// 抖动后的颜色种类很多，按归并后的颜色缓存；否则按原色缓存，保证大面积纯色映射到最接近的颜色
+type mapper struct {
+	pal     [][4]int
+	reduced bool
+	cache   map[int]uint8
+}
+
+func newMapper(pal color.Palette, reduced bool) *mapper {
+	m := &mapper{reduced: reduced, cache: make(map[int]uint8)}
+	for _, c := range pal {
+		rgba := c.(color.RGBA)
+		m.pal = append(m.pal, [4]int{int(rgba.R), int(rgba.G), int(rgba.B), int(rgba.A)})
+	}
+	return m
+}
+
+// index 距离颜色最近的调色板索引
+func (m *mapper) index(r, g, b, a int) uint8 {
+	k := r<<24 | g<<16 | b<<8 | a
+	if m.reduced {
+		k = reducedKey(r, g, b, a)
+	}
+	if i, ok := m.cache[k]; ok {
+		return i
+	}
+	if m.reduced {
+		// 用归并格的中心查找，使缓存结果与格内位置无关
+		r, g, b, a = r|4, g|4, b|4, a|16
+	}
+	best, bestDist := 0, 1<<30
+	for i, p := range m.pal {
+		dr, dg, db, da := r-p[0], g-p[1], b-p[2], a-p[3]
+		if d := dr*dr + dg*dg + db*db + da*da; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	m.cache[k] = uint8(best)
+	return uint8(best)
+}
+
+// ditherFS Floyd-Steinberg 抖动：将每个像素的量化误差扩散到右侧和下一行
+func ditherFS(dst *image.Paletted, src *image.RGBA, m *mapper) {
+	b := src.Bounds()
+	w := b.Dx()
+	// 当前行和下一行的累积误差（两侧各留一格，省去边界判断）
+	cur := make([][3]int, w+2)
+	next := make([][3]int, w+2)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		si := src.PixOffset(b.Min.X, y)
+		di := dst.PixOffset(b.Min.X, y)
+		for x := 0; x < w; x++ {
+			var v [3]int
+			for c := 0; c < 3; c++ {
+				v[c] = max(0, min(255, int(src.Pix[si+c])+cur[x+1][c]/16))
+			}
+			// alpha 不抖动，避免透明区域出现噪点
+			idx := m.index(v[0], v[1], v[2], int(src.Pix[si+3]))
+			dst.Pix[di] = idx
+			p := m.pal[idx]
+			for c := 0; c < 3; c++ {
+				e := v[c] - p[c]
+				cur[x+2][c] += e * 7
+				next[x][c] += e * 3
+				next[x+1][c] += e * 5
+				next[x+2][c] += e
+			}
+			si += 4
+			di++
+		}
+		cur, next = next, cur
+		for i := range next {
+			next[i] = [3]int{}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// FitSize 计算 w x h 按比例缩小到最长边不超过 maxEdge、总像素不超过 maxMegapixels 百万后的尺寸
+// （限制为 0 表示不限制，不会放大）
+func FitSize(w, h, maxEdge int, maxMegapixels float64) (int, int) {
+	if w <= 0 || h <= 0 {
+		return w, h
+	}
+	scale := 1.0
+	if maxEdge > 0 {
+		scale = math.Min(scale, float64(maxEdge)/float64(max(w, h)))
+	}
+	if maxMegapixels > 0 {
+		scale = math.Min(scale, math.Sqrt(maxMegapixels*1e6/float64(w*h)))
+	}
+	if scale >= 1 {
+		return w, h
+	}
+	// 向下取整，保证不超过限制
+	return max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+}
+
+// Downscale 将图片缩小到限制以内（Catmull-Rom 插值），未超出限制时原样返回
+func Downscale(img image.Image, maxEdge int, maxMegapixels float64) image.Image {
+	b := img.Bounds()
+	w, h := FitSize(b.Dx(), b.Dy(), maxEdge, maxMegapixels)
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
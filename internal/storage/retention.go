@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TrashDir 回收站目录名（位于保存目录下）
+const TrashDir = ".trash"
+
+// RetentionPolicy 截图保留策略（各项为 0 表示不限制）
+type RetentionPolicy struct {
+	MaxAge     time.Duration // 最长保留时间
+	MaxCount   int           // 最多保留的截图数
+	MaxBytes   int64         // 截图总大小上限
+	KeepTagged bool          // 带标签的截图始终保留（不计入数量和大小）
+	Trash      bool          // 移到回收站而不是删除
+}
+
+// Enabled 是否设置了任何限制
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxCount > 0 || p.MaxBytes > 0
+}
+
+// Expired 按保留策略选出需要清理的截图：从最新的截图开始保留，
+// 超出时间、数量或总大小限制的较旧截图全部清理。
+// 只处理由 Storage.Save 保存的截图（Source 为 SourceCapture），扫描目录时加入索引的文件不会被清理
+func (c *Catalog) Expired(p RetentionPolicy, now time.Time) ([]Entry, error) {
+	if !p.Enabled() {
+		return nil, nil
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Entry
+	count, size := 0, int64(0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Source != SourceCapture || p.KeepTagged && len(e.Tags) > 0 {
+			continue
+		}
+		count++
+		size += e.Size
+		if p.MaxAge > 0 && now.Sub(e.Time) > p.MaxAge ||
+			p.MaxCount > 0 && count > p.MaxCount ||
+			p.MaxBytes > 0 && size > p.MaxBytes {
+			expired = append(expired, e)
+		}
+	}
+	// 按时间顺序返回
+	for i, j := 0, len(expired)-1; i < j; i, j = i+1, j-1 {
+		expired[i], expired[j] = expired[j], expired[i]
+	}
+	return expired, nil
+}
+
+// Clean 删除（或移到回收站）截图及缩小前保留的原图，删除缩略图并从索引中移除，返回成功清理的记录。
+// 文件已不存在时只移除索引记录
+func (c *Catalog) Clean(entries []Entry, trash bool) ([]Entry, error) {
+	var cleaned []Entry
+	var firstErr error
+	for _, e := range entries {
+		files := []string{e.Path}
+		ext := path.Ext(e.Path)
+		if original := strings.TrimSuffix(e.Path, ext) + "_original" + ext; fileExists(c.Abs(original)) {
+			files = append(files, original)
+		}
+
+		var err error
+		for _, f := range files {
+			if err = c.removeFile(f, trash); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		os.Remove(c.ThumbPath(e.Path))
+		if err := c.Remove(e.Path); err != nil {
+			return cleaned, err
+		}
+		cleaned = append(cleaned, e)
+	}
+	return cleaned, firstErr
+}
+
+// removeFile 删除保存目录下的文件，trash 为 true 时移到回收站中的相同相对路径（重名时加序号）
+func (c *Catalog) removeFile(rel string, trash bool) error {
+	src := c.Abs(rel)
+	if !fileExists(src) {
+		return nil
+	}
+	if !trash {
+		return os.Remove(src)
+	}
+	dir := filepath.Join(c.dir, TrashDir, filepath.FromSlash(path.Dir(rel)))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ext := path.Ext(rel)
+	_, err := rename(src, dir, strings.TrimSuffix(path.Base(rel), ext), strings.TrimPrefix(ext, "."))
+	return err
+}
+
+// fileExists 文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
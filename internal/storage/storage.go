@@ -1,28 +1,115 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"image"
-	"image/jpeg"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
+// DefaultFilename 默认文件名模板（不含扩展名）
+const DefaultFilename = "screenshot_{date}_{time}"
+
+// maxWindowTitle 文件名中窗口标题的最大长度（字符）
+const maxWindowTitle = 60
+
+// Options 存储参数
+type Options struct {
+	Directory string // 保存目录
+	Format    string // 图片格式（见 Formats）
+	Quality   int    // jpg质量 1-100
+	Filename  string // 文件名模板（不含扩展名），为空时使用 DefaultFilename
+	Subdir    string // 子目录模板（可用 / 分隔多级），为空时直接保存在 Directory 下；{hash} 在写入文件后才确定，子目录中不可用
+
+	MaxEdge       int     // 最长边上限（0 表示不限制），超出时按比例缩小
+	MaxMegapixels float64 // 总像素上限（百万像素，0 表示不限制）
+	KeepOriginal  bool    // 缩小时是否在旁边保留原图（文件名加 _original）
+
+	Colors      int    // PNG/GIF 调色板颜色数 2-256（PNG 为 0 时保存全彩）
+	Dither      bool   // 调色板量化时是否抖动
+	Compression string // PNG 压缩级别: default, none, speed, best（TIFF 为 none 时不压缩）
+
+	MaxBytes int64 // JPEG 文件大小上限（0 表示不限制），超出时降低质量，必要时缩小图片
+
+	DedupeWindow    time.Duration // 与该时间内保存的截图比较（0 表示不比较）：完全相同时不再保存新文件
+	SimilarDistance int           // 感知哈希距离不超过该值时视为几乎相同（0 表示不检查）
+
+	ThumbSize int // 缩略图最长边（0 表示不生成），保存在 .thumbs 目录下
+}
+
+// SaveResult 保存结果
+type SaveResult struct {
+	Path    string // 文件路径
+	Reused  bool   // 与最近的截图完全相同，未保存新文件，Path 为已有截图
+	Similar string // 与最近的某张截图几乎相同时为该截图的路径
+}
+
+// SaveInfo 截图的附加信息（用于展开文件名模板和写入元数据）
+type SaveInfo struct {
+	Time     time.Time // 截图时间（零值时使用当前时间）
+	Window   string    // 截图时的前台窗口标题
+	Metadata Metadata  // 写入 PNG 文本块的元数据（其他格式忽略）
+
+	// 标注和虚拟屏幕坐标到图片坐标的变换（坐标相对于传入 Save 的图片），
+	// 图片被缩小时随之换算后写入 MetaAnnotations 和 MetaTransform
+	Annotations []Annotation
+	Transform   *Transform
+}
+
 // Storage 存储管理
 type Storage struct {
 	directory string
 	format    string
-	quality   int
+	filename  string
+	subdir    string
+
+	maxEdge       int
+	maxMegapixels float64
+	keepOriginal  bool
+
+	dedupeWindow    time.Duration
+	similarDistance int
+	thumbSize       int
+
+	encodeOpts EncodeOptions
+	catalog    *Catalog
 }
 
 // NewStorage 创建存储管理器
-func NewStorage(directory, format string, quality int) *Storage {
+func NewStorage(opts Options) *Storage {
+	if opts.Filename == "" {
+		opts.Filename = DefaultFilename
+	}
 	return &Storage{
-		directory: directory,
-		format:    format,
-		quality:   quality,
+		directory: opts.Directory,
+		format:    opts.Format,
+		filename:  opts.Filename,
+		subdir:    opts.Subdir,
+
+		maxEdge:       opts.MaxEdge,
+		maxMegapixels: opts.MaxMegapixels,
+		keepOriginal:  opts.KeepOriginal,
+
+		dedupeWindow:    opts.DedupeWindow,
+		similarDistance: opts.SimilarDistance,
+		thumbSize:       opts.ThumbSize,
+
+		encodeOpts: EncodeOptions{
+			Quality:     opts.Quality,
+			MaxBytes:    opts.MaxBytes,
+			Colors:      opts.Colors,
+			Dither:      opts.Dither,
+			Compression: compressionLevel(opts.Compression),
+		},
+		catalog: NewCatalog(opts.Directory),
 	}
 }
 
@@ -35,72 +122,320 @@ func (s *Storage) SetDirectory(dir string) error {
 	}
 
 	s.directory = dir
+	s.catalog = NewCatalog(dir)
 	return os.MkdirAll(dir, 0755)
 }
 
-// Save 保存图片，返回文件路径
-func (s *Storage) Save(img image.Image) (string, error) {
-	// 确保目录存在
-	if err := os.MkdirAll(s.directory, 0755); err != nil {
-		return "", fmt.Errorf("无法创建目录: %v", err)
+// Save 保存图片并加入索引。
+// 超出尺寸限制或 JPEG 文件大小限制时先缩小（{w}x{h} 为缩小后的尺寸），需要时在旁边保留原图（原图不加入索引）。
+// 与最近保存的截图完全相同时直接返回已有文件，几乎相同时在结果和索引中标记
+func (s *Storage) Save(img image.Image, info SaveInfo) (SaveResult, error) {
+	if info.Time.IsZero() {
+		info.Time = time.Now()
+	}
+	original := img
+	img = Downscale(img, s.maxEdge, s.maxMegapixels)
+	img, err := s.fitSize(img)
+	if err != nil {
+		return SaveResult{}, fmt.Errorf("无法保存图片: %v", err)
 	}
 
-	// 生成文件名
-	timestamp := time.Now().Format("20060102_150405")
-	ext := s.format
-	if ext == "" {
-		ext = "png"
+	entry := Entry{Time: info.Time, Window: info.Window, Source: SourceCapture, PHash: FormatHash(DHash(img))}
+	if s.lossless() {
+		// 有损格式解码后的像素与保存前不同，不记录摘要（扫描索引时从文件解码计算）
+		entry.Digest = pixelDigest(img)
+	}
+	same, similar := s.findRecent(entry)
+	if same != "" {
+		return SaveResult{Path: s.catalog.Abs(same), Reused: true}, nil
+	}
+	entry.Similar = similar
+
+	b := img.Bounds()
+	vars := map[string]string{
+		"date":   info.Time.Format("20060102"),
+		"time":   info.Time.Format("150405"),
+		"year":   info.Time.Format("2006"),
+		"month":  info.Time.Format("01"),
+		"day":    info.Time.Format("02"),
+		"w":      strconv.Itoa(b.Dx()),
+		"h":      strconv.Itoa(b.Dy()),
+		"window": windowName(info.Window),
+	}
+
+	// 确保目录存在
+	dir := filepath.Join(s.directory, subdirPath(expand(s.subdir, vars)))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return SaveResult{}, fmt.Errorf("无法创建目录: %v", err)
 	}
-	filename := fmt.Sprintf("screenshot_%s.%s", timestamp, ext)
-	filepath := filepath.Join(s.directory, filename)
 
-	// 创建文件
-	file, err := os.Create(filepath)
+	sx := float64(b.Dx()) / float64(original.Bounds().Dx())
+	sy := float64(b.Dy()) / float64(original.Bounds().Dy())
+	path, hash, err := s.write(img, dir, s.filename, vars, info.metadata(sx, sy))
 	if err != nil {
-		return "", fmt.Errorf("无法创建文件: %v", err)
+		return SaveResult{}, err
 	}
-	defer file.Close()
+	entry.Width, entry.Height, entry.Hash = b.Dx(), b.Dy(), hash
+	s.index(path, entry, img)
+
+	result := SaveResult{Path: path}
+	if similar != "" {
+		result.Similar = s.catalog.Abs(similar)
+	}
+
+	// 原图与缩小后的文件同名，加 _original 后缀
+	if s.keepOriginal && img.Bounds().Size() != original.Bounds().Size() {
+		base := strings.TrimSuffix(filepath.Base(path), "."+s.ext()) + "_original"
+		if _, _, err := s.write(original, dir, base, nil, info.metadata(1, 1)); err != nil {
+			return result, fmt.Errorf("无法保存原图: %v", err)
+		}
+	}
+	return result, nil
+}
 
-	// 编码并保存
+// lossless 保存格式是否无损（解码后的像素与保存前相同）
+func (s *Storage) lossless() bool {
 	switch s.format {
-	case "jpg", "jpeg":
-		err = jpeg.Encode(file, img, &jpeg.Options{Quality: s.quality})
-	default:
-		err = png.Encode(file, img)
+	case "jpg", "jpeg", "gif":
+		return false
+	case "bmp", "tiff", "webp":
+		return true
+	}
+	return s.encodeOpts.Colors == 0 // PNG（未注册的格式同样保存为 PNG）
+}
+
+// fitSize JPEG 设置了文件大小上限时，按最低质量编码仍超出则缩小图片。
+// 在生成文件名和索引之前确定最终尺寸，保证文件名、索引和缩略图与保存的文件一致
+func (s *Storage) fitSize(img image.Image) (image.Image, error) {
+	if s.encodeOpts.MaxBytes <= 0 || s.format != "jpg" && s.format != "jpeg" {
+		return img, nil
 	}
+	return fitJPEGSize(img, s.encodeOpts.Quality, s.encodeOpts.MaxBytes)
+}
 
+// findRecent 在 dedupeWindow 内保存的截图中查找与 e 像素完全相同的截图（e 有像素摘要时），
+// 以及感知哈希距离最小且不超过 similarDistance 的截图，返回索引路径
+func (s *Storage) findRecent(e Entry) (same, similar string) {
+	if s.dedupeWindow <= 0 {
+		return "", ""
+	}
+	entries, err := s.catalog.Entries()
 	if err != nil {
-		return "", fmt.Errorf("无法保存图片: %v", err)
+		return "", ""
 	}
+	hash, _ := ParseHash(e.PHash)
+	best := s.similarDistance + 1
+	for i := len(entries) - 1; i >= 0; i-- {
+		r := entries[i]
+		if e.Time.Sub(r.Time) > s.dedupeWindow {
+			break
+		}
+		if e.Digest != "" && r.Digest == e.Digest && fileExists(s.catalog.Abs(r.Path)) {
+			return r.Path, ""
+		}
+		if h, ok := ParseHash(r.PHash); ok && s.similarDistance > 0 {
+			if d := HashDistance(hash, h); d < best {
+				best, similar = d, r.Path
+			}
+		}
+	}
+	return "", similar
+}
 
-	return filepath, nil
+// index 将保存的截图加入索引并生成缩略图。
+// 索引或缩略图写入失败不影响截图本身，之后可用 snapcli index 重新扫描（缩略图在生成图库时补全）
+func (s *Storage) index(path string, e Entry, img image.Image) {
+	rel, ok := s.catalog.Rel(path)
+	if !ok {
+		return
+	}
+	e.Path = rel
+	if st, err := os.Stat(path); err == nil {
+		e.Size = st.Size()
+	}
+	s.catalog.Add(e)
+	s.catalog.WriteThumbnail(rel, img, s.thumbSize)
+}
+
+// Catalog 截图索引
+func (s *Storage) Catalog() *Catalog {
+	return s.catalog
 }
 
-// Cleanup 清理旧截图
-func (s *Storage) Cleanup(olderThan time.Duration) error {
-	entries, err := os.ReadDir(s.directory)
+// write 将图片写入 dir 下由模板 tmpl 生成的文件，返回文件路径和内容的 SHA-256。
+// 先编码到同目录下的临时文件，完成后再改名为目标文件名（重名时添加序号），
+// 保证目标路径上不会出现写了一半的文件
+func (s *Storage) write(img image.Image, dir, tmpl string, vars map[string]string, meta Metadata) (string, string, error) {
+	// 编码到临时文件，同时计算内容哈希
+	tmp, err := os.CreateTemp(dir, ".snapcli-*.tmp")
+	if err != nil {
+		return "", "", fmt.Errorf("无法创建文件: %v", err)
+	}
+	tmpPath := tmp.Name()
+	hash := sha256.New()
+	err = s.encode(io.MultiWriter(tmp, hash), img, meta)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", "", fmt.Errorf("无法保存图片: %v", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if vars != nil {
+		vars["hash"] = sum[:8]
+	}
+
+	path, err := rename(tmpPath, dir, expand(tmpl, vars), s.ext())
 	if err != nil {
+		os.Remove(tmpPath)
+		return "", "", fmt.Errorf("无法保存图片: %v", err)
+	}
+	return path, sum, nil
+}
+
+// encode 按配置的格式编码图片（未注册的格式使用 PNG），输出为 PNG 时写入元数据
+func (s *Storage) encode(w io.Writer, img image.Image, meta Metadata) error {
+	enc, ok := encoders[s.format]
+	if !ok {
+		enc = encodePNG
+	}
+	if len(meta) == 0 {
+		return enc(w, img, s.encodeOpts)
+	}
+	tw := newPNGTextWriter(w, meta)
+	if err := enc(tw, img, s.encodeOpts); err != nil {
 		return err
 	}
+	return tw.flush()
+}
+
+// compressionLevel 压缩级别名称对应的 PNG 压缩级别
+func compressionLevel(name string) png.CompressionLevel {
+	switch name {
+	case "none":
+		return png.NoCompression
+	case "speed":
+		return png.BestSpeed
+	case "best":
+		return png.BestCompression
+	default:
+		return png.DefaultCompression
+	}
+}
 
-	cutoff := time.Now().Add(-olderThan)
+// ext 文件扩展名
+func (s *Storage) ext() string {
+	if s.format == "" {
+		return "png"
+	}
+	return s.format
+}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+// rename 将临时文件改名为 dir 下的 base.ext。
+// base 含 {seq} 时从 001 开始取第一个未使用的序号，否则重名时依次尝试 base_2、base_3 …
+// 先以独占方式创建目标文件占位，避免同时保存的截图互相覆盖
+func rename(tmpPath, dir, base, ext string) (string, error) {
+	base = sanitize(base)
+	hasSeq := strings.Contains(base, "{seq}")
+	for n := 1; n <= 9999; n++ {
+		name := base
+		if hasSeq {
+			name = strings.ReplaceAll(base, "{seq}", fmt.Sprintf("%03d", n))
+		} else if n > 1 {
+			name = fmt.Sprintf("%s_%d", base, n)
 		}
+		if name == "" {
+			name = "screenshot"
+		}
+		path := filepath.Join(dir, name+"."+ext)
 
-		info, err := entry.Info()
-		if err != nil {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
 			continue
 		}
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+
+		if err := os.Rename(tmpPath, path); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("文件名 %s 的可用序号已用完", base)
+}
 
-		if info.ModTime().Before(cutoff) {
-			os.Remove(filepath.Join(s.directory, entry.Name()))
+// expand 展开模板中的 {name} 占位符（未知占位符保持不变）
+func expand(tmpl string, vars map[string]string) string {
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(tmpl, '{')
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(tmpl[i:], '}')
+		if j < 0 {
+			break
 		}
+		sb.WriteString(tmpl[:i])
+		if v, ok := vars[tmpl[i+1:i+j]]; ok {
+			sb.WriteString(v)
+		} else {
+			sb.WriteString(tmpl[i : i+j+1])
+		}
+		tmpl = tmpl[i+j+1:]
 	}
+	sb.WriteString(tmpl)
+	return sb.String()
+}
 
-	return nil
+// subdirPath 将展开后的子目录模板转换为相对路径（去掉空段和 . / ..）
+func subdirPath(s string) string {
+	var parts []string
+	for _, p := range strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == '\\' }) {
+		p = sanitize(p)
+		if p == "" || p == "." || p == ".." {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	return filepath.Join(parts...)
+}
+
+// windowName 窗口标题转换为可用于文件名的形式（截断过长的标题）
+func windowName(title string) string {
+	title = strings.Join(strings.Fields(sanitize(title)), " ")
+	if utf8.RuneCountInString(title) > maxWindowTitle {
+		title = strings.TrimSpace(string([]rune(title)[:maxWindowTitle]))
+	}
+	return title
+}
+
+// sanitize 替换文件名中不允许的字符，并去掉首尾的空格和点（Windows 不允许）
+func sanitize(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.Trim(name, " .")
+}
+
+// Cleanup 按保留策略清理截图（只处理索引中由 SnapCLI 保存的截图），返回清理的记录。
+// dryRun 为 true 时只返回将被清理的记录
+func (s *Storage) Cleanup(p RetentionPolicy, dryRun bool) ([]Entry, error) {
+	expired, err := s.catalog.Expired(p, time.Now())
+	if err != nil || dryRun {
+		return expired, err
+	}
+	return s.catalog.Clean(expired, p.Trash)
 }
 
 // GetDirectory 获取保存目录
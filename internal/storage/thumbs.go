@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+)
+
+// ThumbDir 缩略图目录名（位于保存目录下，与截图保持相同的相对路径）
+const ThumbDir = ".thumbs"
+
+// thumbQuality 缩略图的 JPEG 质量
+const thumbQuality = 80
+
+// ThumbPath 截图（索引路径）对应的缩略图文件路径：保留原扩展名再加 .jpg（a.png -> a.png.jpg），
+// 避免同名不同格式的截图共用一个缩略图
+func (c *Catalog) ThumbPath(rel string) string {
+	return filepath.Join(c.dir, ThumbDir, filepath.FromSlash(rel+".jpg"))
+}
+
+// WriteThumbnail 生成截图的缩略图（最长边不超过 size，JPEG，透明部分填充白色）
+func (c *Catalog) WriteThumbnail(rel string, img image.Image, size int) error {
+	b := img.Bounds()
+	if size <= 0 || b.Empty() {
+		return nil
+	}
+	small := Downscale(img, size, 0)
+	sb := small.Bounds()
+	thumb := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(thumb, thumb.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(thumb, thumb.Bounds(), small, sb.Min, draw.Over)
+
+	dst := c.ThumbPath(rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".snapcli-*.tmp")
+	if err != nil {
+		return err
+	}
+	err = jpeg.Encode(tmp, thumb, &jpeg.Options{Quality: thumbQuality})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("无法生成缩略图: %v", err)
+	}
+	return nil
+}
+
+// Thumbnail 返回截图的缩略图路径，缩略图不存在或比截图旧时从截图生成
+func (c *Catalog) Thumbnail(rel string, size int) (string, error) {
+	dst := c.ThumbPath(rel)
+	src, err := os.Stat(c.Abs(rel))
+	if err != nil {
+		return "", err
+	}
+	if st, err := os.Stat(dst); err == nil && !st.ModTime().Before(src.ModTime()) {
+		return dst, nil
+	}
+
+	f, err := os.Open(c.Abs(rel))
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", err
+	}
+	return dst, c.WriteThumbnail(rel, img, size)
+}
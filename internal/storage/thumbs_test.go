@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestThumbPath 同名不同格式的截图使用不同的缩略图
+func TestThumbPath(t *testing.T) {
+	c := NewCatalog("shots")
+	png, jpg := c.ThumbPath("2024/a.png"), c.ThumbPath("2024/a.jpg")
+	if png == jpg {
+		t.Fatalf("a.png 与 a.jpg 的缩略图相同: %s", png)
+	}
+	if want := filepath.Join("shots", ThumbDir, "2024", "a.png.jpg"); png != want {
+		t.Errorf("ThumbPath = %s，应为 %s", png, want)
+	}
+}
@@ -0,0 +1,652 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// 无损 WebP（VP8L）编码：依次做减绿变换和预测变换（每 16x16 块选择残差最小的预测方式），
+// 再用 LZ77 反向引用（哈希链查找）和颜色缓存压缩像素，每张图片使用一组前缀码。
+
+const (
+	vp8lMaxSize     = 1 << 14 // 宽高上限
+	vp8lMaxLength   = 4096    // 反向引用的最大长度
+	vp8lMinLength   = 3       // 短于该长度时直接输出像素
+	vp8lMaxDistance = 1<<20 - 120
+	vp8lMaxCodeBits = 15 // 前缀码最大码长
+	vp8lLengthCodes = 24 // 长度前缀码数量
+	vp8lDistCodes   = 40 // 距离前缀码数量
+	vp8lCacheBits   = 10 // 颜色缓存大小（位数）
+	vp8lBlockBits   = 4  // 预测变换的块大小（位数）
+	vp8lHashBits    = 16 // LZ77 哈希表大小（位数）
+	vp8lChainDepth  = 32 // 每个位置最多比较的候选数
+
+	// 距离编码：1-120 为二维邻域（1 为正上方，2 为左侧），更大的值减去 120 为线性距离
+	vp8lDistAbove = 1
+	vp8lDistLeft  = 2
+	vp8lDistBase  = 120
+)
+
+// vp8lPredictors 预测变换候选的预测方式（左、上、右上、左上、左上平均、钳位梯度）
+var vp8lPredictors = []int{1, 2, 3, 4, 7, 12}
+
+// codeLengthOrder 码长前缀码的码长写入顺序
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lToken 像素、颜色缓存命中或反向引用
+type vp8lToken struct {
+	argb   uint32 // 像素（length 为 0 时）
+	cache  int    // 颜色缓存索引 + 1（0 表示未命中）
+	length int    // 反向引用长度
+	dist   int    // 反向引用距离编码
+}
+
+// encodeWebP 编码为无损 WebP
+func encodeWebP(w io.Writer, img image.Image, _ EncodeOptions) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return errors.New("WebP 图片尺寸必须在 1-16384 之间")
+	}
+
+	// 转换为非预乘 ARGB 并做减绿变换
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	pix := make([]uint32, width*height)
+	alpha := false
+	for i := range pix {
+		p := nrgba.Pix[i*4 : i*4+4 : i*4+4]
+		r, g, bl, a := p[0]-p[1], p[1], p[2]-p[1], p[3]
+		pix[i] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(bl)
+		alpha = alpha || a != 0xff
+	}
+
+	bw := &bitWriter{}
+	// 文件头：签名、宽高、alpha 标志、版本
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	// 变换：减绿（类型 2）
+	bw.write(1, 1)
+	bw.write(2, 2)
+	// 变换：预测（类型 0），块大小和每块的预测方式作为子图片写入
+	modes, mw := choosePredictors(pix, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(vp8lBlockBits-2, 3)
+	writeImageData(bw, modes, mw, 0, false)
+	pix = predictResiduals(pix, width, height, modes, mw)
+	bw.write(0, 1)
+
+	writeImageData(bw, pix, width, vp8lCacheBits, true)
+	data := bw.bytes()
+
+	// RIFF 容器
+	size := len(data)
+	pad := size & 1
+	var hdr [20]byte
+	copy(hdr[0:], "RIFF")
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(4+8+size+pad))
+	copy(hdr[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(size))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if pad != 0 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// writeImageData 写入熵编码的图片数据（颜色缓存信息、前缀码和像素），main 为主图片时写入分区前缀码标志
+func writeImageData(bw *bitWriter, pix []uint32, width, cacheBits int, main bool) {
+	tokens := vp8lTokens(pix, width)
+	applyColorCache(tokens, pix, cacheBits)
+
+	if cacheBits > 0 {
+		bw.write(1, 1)
+		bw.write(uint32(cacheBits), 4)
+	} else {
+		bw.write(0, 1)
+	}
+	if main {
+		bw.write(0, 1) // 不使用分区前缀码
+	}
+
+	// 统计各前缀码的符号频率：绿色（含长度码和颜色缓存）、红、蓝、alpha、距离
+	var hist [5][]int
+	hist[0] = make([]int, 256+vp8lLengthCodes+cacheSize(cacheBits))
+	for i := 1; i < 4; i++ {
+		hist[i] = make([]int, 256)
+	}
+	hist[4] = make([]int, vp8lDistCodes)
+	for _, t := range tokens {
+		switch {
+		case t.length > 0:
+			lc, _, _ := prefixEncode(t.length)
+			dc, _, _ := prefixEncode(t.dist)
+			hist[0][256+lc]++
+			hist[4][dc]++
+		case t.cache > 0:
+			hist[0][256+vp8lLengthCodes+t.cache-1]++
+		default:
+			hist[0][t.argb>>8&0xff]++
+			hist[1][t.argb>>16&0xff]++
+			hist[2][t.argb&0xff]++
+			hist[3][t.argb>>24]++
+		}
+	}
+
+	var codes [5]prefixCode
+	for i := range hist {
+		codes[i] = writePrefixCode(bw, hist[i])
+	}
+
+	for _, t := range tokens {
+		switch {
+		case t.length > 0:
+			lc, lbits, lextra := prefixEncode(t.length)
+			codes[0].write(bw, 256+lc)
+			bw.write(lextra, lbits)
+			dc, dbits, dextra := prefixEncode(t.dist)
+			codes[4].write(bw, dc)
+			bw.write(dextra, dbits)
+		case t.cache > 0:
+			codes[0].write(bw, 256+vp8lLengthCodes+t.cache-1)
+		default:
+			codes[0].write(bw, int(t.argb>>8&0xff))
+			codes[1].write(bw, int(t.argb>>16&0xff))
+			codes[2].write(bw, int(t.argb&0xff))
+			codes[3].write(bw, int(t.argb>>24))
+		}
+	}
+}
+
+// cacheSize 颜色缓存的条目数
+func cacheSize(bits int) int {
+	if bits == 0 {
+		return 0
+	}
+	return 1 << bits
+}
+
+// applyColorCache 模拟解码器的颜色缓存，将命中缓存的像素改为缓存索引
+func applyColorCache(tokens []vp8lToken, pix []uint32, bits int) {
+	if bits == 0 {
+		return
+	}
+	cache := make([]uint32, 1<<bits)
+	valid := make([]bool, 1<<bits)
+	insert := func(argb uint32) {
+		k := (0x1e35a7bd * argb) >> (32 - bits)
+		cache[k], valid[k] = argb, true
+	}
+	pos := 0
+	for i := range tokens {
+		t := &tokens[i]
+		if t.length > 0 {
+			for _, p := range pix[pos : pos+t.length] {
+				insert(p)
+			}
+			pos += t.length
+			continue
+		}
+		k := (0x1e35a7bd * t.argb) >> (32 - bits)
+		if valid[k] && cache[k] == t.argb {
+			t.cache = int(k) + 1
+		}
+		insert(t.argb)
+		pos++
+	}
+}
+
+// vp8lTokens LZ77 贪心匹配：先比较左侧像素和上一行，再沿哈希链查找更早出现的相同像素序列
+func vp8lTokens(pix []uint32, width int) []vp8lToken {
+	n := len(pix)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (pix[i]*0x1e35a7bd ^ pix[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLen := func(i, dist int) int {
+		l := 0
+		for l < vp8lMaxLength && i+l < n && pix[i+l] == pix[i+l-dist] {
+			l++
+		}
+		return l
+	}
+
+	var tokens []vp8lToken
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+		for _, d := range []int{1, width} {
+			if d <= i {
+				if l := matchLen(i, d); l > bestLen {
+					bestLen, bestDist = l, d
+				}
+			}
+		}
+		if i+1 < n && bestLen < vp8lMaxLength {
+			for j, depth := head[hash(i)], 0; j >= 0 && depth < vp8lChainDepth; j, depth = prev[j], depth+1 {
+				d := i - int(j)
+				if d > vp8lMaxDistance {
+					break
+				}
+				if pix[int(j)+bestLen] != pix[min(i+bestLen, n-1)] {
+					continue
+				}
+				if l := matchLen(i, d); l > bestLen {
+					bestLen, bestDist = l, d
+				}
+			}
+		}
+
+		if bestLen < vp8lMinLength {
+			tokens = append(tokens, vp8lToken{argb: pix[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, vp8lToken{length: bestLen, dist: distanceCode(bestDist, width)})
+		for k := i; k < i+bestLen; k++ {
+			insert(k)
+		}
+		i += bestLen
+	}
+	return tokens
+}
+
+// distanceCode 线性距离对应的距离编码
+func distanceCode(dist, width int) int {
+	switch dist {
+	case width:
+		return vp8lDistAbove
+	case 1:
+		return vp8lDistLeft
+	}
+	return dist + vp8lDistBase
+}
+
+// choosePredictors 为每个块选择残差绝对值之和最小的预测方式，返回预测方式子图片及其宽度
+func choosePredictors(pix []uint32, width, height int) ([]uint32, int) {
+	size := 1 << vp8lBlockBits
+	mw := (width + size - 1) >> vp8lBlockBits
+	mh := (height + size - 1) >> vp8lBlockBits
+	modes := make([]uint32, mw*mh)
+	for by := 0; by < mh; by++ {
+		for bx := 0; bx < mw; bx++ {
+			best, bestCost := vp8lPredictors[0], -1
+			for _, mode := range vp8lPredictors {
+				cost := 0
+				for y := by * size; y < min(height, (by+1)*size); y++ {
+					for x := bx * size; x < min(width, (bx+1)*size); x++ {
+						cost += residualCost(pix[y*width+x], predict(pix, width, x, y, mode))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			// 预测方式保存在绿色通道
+			modes[by*mw+bx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+	return modes, mw
+}
+
+// predictResiduals 计算预测残差（逐通道相减，模 256）
+func predictResiduals(pix []uint32, width, height int, modes []uint32, mw int) []uint32 {
+	res := make([]uint32, len(pix))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := int(modes[(y>>vp8lBlockBits)*mw+x>>vp8lBlockBits] >> 8 & 0xff)
+			res[y*width+x] = subPixels(pix[y*width+x], predict(pix, width, x, y, mode))
+		}
+	}
+	return res
+}
+
+// predict 按预测方式计算 (x, y) 的预测值（第一个像素、第一行和第一列使用固定的预测方式）
+func predict(pix []uint32, width, x, y, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pix[i-1]
+	case x == 0:
+		return pix[i-width]
+	}
+	left, top, topLeft := pix[i-1], pix[i-width], pix[i-width-1]
+	switch mode {
+	case 1:
+		return left
+	case 2:
+		return top
+	case 3:
+		// 最右一列的右上像素为当前行最左侧像素（按内存顺序）
+		return pix[i-width+1]
+	case 4:
+		return topLeft
+	case 7:
+		return average2(left, top)
+	case 12:
+		return clampAddSubtract(left, top, topLeft)
+	}
+	return 0xff000000
+}
+
+// average2 逐通道平均（向下取整）
+func average2(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + (a & b)
+}
+
+// clampAddSubtract 逐通道计算 a + b - c 并钳位到 0-255
+func clampAddSubtract(a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		out |= uint32(max(0, min(255, v))) << shift
+	}
+	return out
+}
+
+// subPixels 逐通道相减（模 256）
+func subPixels(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		out |= uint32(uint8(a>>shift)-uint8(b>>shift)) << shift
+	}
+	return out
+}
+
+// residualCost 残差的代价：各通道按有符号值取绝对值之和
+func residualCost(a, b uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += abs(int(int8(uint8(a>>shift) - uint8(b>>shift))))
+	}
+	return cost
+}
+
+// abs 整数绝对值
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// prefixEncode 将长度或距离（>= 1）编码为前缀码、附加位数和附加位
+func prefixEncode(v int) (code, bits int, extra uint32) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := 31
+	for v>>high == 0 {
+		high--
+	}
+	second := v >> (high - 1) & 1
+	bits = high - 1
+	return 2*high + second, bits, uint32(v & (1<<bits - 1))
+}
+
+// bitWriter 低位在前的位写入器
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits int
+}
+
+func (bw *bitWriter) write(v uint32, n int) {
+	bw.acc |= uint64(v) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc >>= 8
+		bw.nbits -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.acc))
+		bw.acc, bw.nbits = 0, 0
+	}
+	return bw.buf
+}
+
+// prefixCode 规范前缀码（codes 已按写入顺序位反转）
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (c *prefixCode) write(bw *bitWriter, sym int) {
+	bw.write(c.codes[sym], c.lengths[sym])
+}
+
+// writePrefixCode 根据符号频率生成前缀码并写入码长，返回用于写入符号的前缀码
+func writePrefixCode(bw *bitWriter, freq []int) prefixCode {
+	var used []int
+	for s, f := range freq {
+		if f > 0 {
+			used = append(used, s)
+		}
+	}
+
+	// 不超过两个符号且都小于 256：使用简单码
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		lengths := make([]int, len(freq))
+		bw.write(1, 1)
+		switch len(used) {
+		case 0:
+			bw.write(0, 1)
+			bw.write(0, 1)
+			bw.write(0, 1)
+		case 1:
+			bw.write(0, 1)
+			writeSimpleSymbol(bw, used[0])
+		case 2:
+			bw.write(1, 1)
+			writeSimpleSymbol(bw, used[0])
+			bw.write(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+	}
+
+	lengths := codeLengths(freq, vp8lMaxCodeBits)
+	writeCodeLengths(bw, lengths)
+	return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// writeSimpleSymbol 写入简单码的第一个符号（小于 2 时用 1 位，否则 8 位）
+func writeSimpleSymbol(bw *bitWriter, sym int) {
+	if sym < 2 {
+		bw.write(0, 1)
+		bw.write(uint32(sym), 1)
+		return
+	}
+	bw.write(1, 1)
+	bw.write(uint32(sym), 8)
+}
+
+// writeCodeLengths 用码长前缀码写入普通前缀码的码长（连续的 0 用 17/18 压缩）
+func writeCodeLengths(bw *bitWriter, lengths []int) {
+	// 码长序列转换为码长符号
+	type clSym struct {
+		sym, extra, bits int
+	}
+	var syms []clSym
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			syms = append(syms, clSym{sym: lengths[i]})
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			syms = append(syms, clSym{sym: 18, extra: run - 11, bits: 7})
+		case run >= 3:
+			syms = append(syms, clSym{sym: 17, extra: run - 3, bits: 3})
+		default:
+			run = 1
+			syms = append(syms, clSym{sym: 0})
+		}
+		i += run
+	}
+
+	freq := make([]int, 19)
+	for _, s := range syms {
+		freq[s.sym]++
+	}
+	clLengths := codeLengths(freq, 7)
+	clCodes := canonicalCodes(clLengths)
+
+	n := len(codeLengthOrder)
+	for n > 4 && clLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(0, 1) // 普通码
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		bw.write(uint32(clLengths[s]), 3)
+	}
+	bw.write(0, 1) // 写入全部符号的码长
+	for _, s := range syms {
+		bw.write(clCodes[s.sym], clLengths[s.sym])
+		bw.write(uint32(s.extra), s.bits)
+	}
+}
+
+// codeLengths 计算码长不超过 maxBits 的 Huffman 码长（至少两个符号有码长，保证码完整）
+func codeLengths(freq []int, maxBits int) []int {
+	f := make([]int, len(freq))
+	copy(f, freq)
+	used := 0
+	for _, v := range f {
+		if v > 0 {
+			used++
+		}
+	}
+	for s := 0; used < 2 && s < len(f); s++ {
+		if f[s] == 0 {
+			f[s] = 1
+			used++
+		}
+	}
+
+	for {
+		lengths := huffmanLengths(f)
+		longest := 0
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if longest <= maxBits {
+			return lengths
+		}
+		// 码长超出上限：压平频率后重试
+		for i, v := range f {
+			if v > 0 {
+				f[i] = max(1, v>>1)
+			}
+		}
+	}
+}
+
+// huffmanLengths 标准 Huffman 树的码长（频率为 0 的符号码长为 0）
+func huffmanLengths(freq []int) []int {
+	type node struct {
+		weight      int
+		sym         int // 叶子节点的符号，内部节点为 -1
+		left, right int
+	}
+	var nodes []node
+	var queue []int
+	for s, f := range freq {
+		if f > 0 {
+			nodes = append(nodes, node{weight: f, sym: s})
+			queue = append(queue, len(nodes)-1)
+		}
+	}
+	for len(queue) > 1 {
+		sort.SliceStable(queue, func(i, j int) bool { return nodes[queue[i]].weight < nodes[queue[j]].weight })
+		a, b := queue[0], queue[1]
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, sym: -1, left: a, right: b})
+		queue = append(queue[2:], len(nodes)-1)
+	}
+
+	lengths := make([]int, len(freq))
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if nodes[i].sym >= 0 {
+			lengths[nodes[i].sym] = max(1, depth)
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	if len(queue) == 1 {
+		walk(queue[0], 0)
+	}
+	return lengths
+}
+
+// canonicalCodes 按码长分配规范前缀码，并按低位在前的写入顺序反转
+func canonicalCodes(lengths []int) []uint32 {
+	var count [vp8lMaxCodeBits + 1]int
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	var next [vp8lMaxCodeBits + 2]uint32
+	code := uint32(0)
+	for l := 1; l <= vp8lMaxCodeBits; l++ {
+		code = (code + uint32(count[l-1])) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var rev uint32
+		for i := 0; i < l; i++ {
+			rev = rev<<1 | c>>i&1
+		}
+		codes[s] = rev
+	}
+	return codes
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gen := func(w, h int, fn func(x, y int) color.NRGBA) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.SetNRGBA(x, y, fn(x, y))
+			}
+		}
+		return img
+	}
+	palette := []color.NRGBA{{255, 0, 0, 255}, {0, 128, 255, 255}, {255, 255, 255, 255}, {20, 20, 20, 255}}
+
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"1x1", gen(1, 1, func(x, y int) color.NRGBA { return color.NRGBA{1, 2, 3, 255} })},
+		{"不透明渐变", gen(97, 61, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 2), uint8(y * 4), uint8(x + y), 255}
+		})},
+		{"半透明", gen(64, 48, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(x * 3), uint8(y * 5), 200, uint8(x * y)}
+		})},
+		{"少量颜色（颜色缓存和反向引用）", gen(150, 80, func(x, y int) color.NRGBA {
+			return palette[(x/7+y/5)%len(palette)]
+		})},
+		{"超过 256 种颜色", gen(120, 90, func(x, y int) color.NRGBA {
+			return color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+		})},
+		{"大面积纯色（长反向引用）", gen(800, 600, func(x, y int) color.NRGBA {
+			if x == y {
+				return color.NRGBA{0, 0, 0, 255}
+			}
+			return color.NRGBA{255, 255, 255, 255}
+		})},
+		{"界面截图", gen(300, 200, func(x, y int) color.NRGBA {
+			switch {
+			case y < 30:
+				return color.NRGBA{40, 40, 48, 255}
+			case x%50 < 2 || y%40 < 2:
+				return color.NRGBA{200, 200, 200, 255}
+			}
+			return color.NRGBA{uint8(250 - y%3), 250, 250, 255}
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, tt.img, EncodeOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("解码失败: %v", err)
+			}
+			b := decoded.Bounds()
+			if b.Size() != tt.img.Bounds().Size() {
+				t.Fatalf("尺寸 = %v，应为 %v", b.Size(), tt.img.Bounds().Size())
+			}
+			got := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+			draw.Draw(got, got.Bounds(), decoded, b.Min, draw.Src)
+			if !bytes.Equal(got.Pix, tt.img.Pix) {
+				for i := range got.Pix {
+					if got.Pix[i] != tt.img.Pix[i] {
+						p := i / 4
+						t.Fatalf("像素 (%d, %d) = %v，应为 %v", p%b.Dx(), p/b.Dx(), got.Pix[p*4:p*4+4], tt.img.Pix[p*4:p*4+4])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWebPSize(t *testing.T) {
+	if err := encodeWebP(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, vp8lMaxSize+1, 1)), EncodeOptions{}); err == nil {
+		t.Error("超出尺寸上限时应返回错误")
+	}
+}
@@ -0,0 +1,77 @@
+package vision
+
+import "math"
+
+// Estimate 图片在某个模型中的 token 估算
+type Estimate struct {
+	Model  string // 模型系列
+	Width  int    // 服务端缩放后实际处理的宽度
+	Height int    // 服务端缩放后实际处理的高度
+	Tokens int    // 估算的 token 数
+}
+
+// 各模型的缩放规则（按公开文档估算，实际计费以服务端为准）
+const (
+	claudeMaxEdge   = 1568        // Claude：最长边上限
+	claudeMaxPixels = 1092 * 1092 // Claude：总像素上限（约 1.19 MP）
+	claudePerToken  = 750         // Claude：每 token 对应的像素数
+
+	openaiMaxEdge   = 2048 // GPT-4o（high detail）：先缩放到 2048x2048 以内
+	openaiShortEdge = 768  // 再缩放到较短边不超过 768
+	openaiTile      = 512  // 按 512x512 分块
+	openaiBase      = 85   // 基础 token
+	openaiPerTile   = 170  // 每块 token
+
+	geminiSmall   = 384 // Gemini：两边都不超过 384 时按一块计
+	geminiTile    = 768 // 否则按 768x768 分块
+	geminiPerTile = 258 // 每块 token
+)
+
+// Estimates 估算 w x h 的图片在各模型中的 token 开销
+func Estimates(w, h int) []Estimate {
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	return []Estimate{claude(w, h), openai(w, h), gemini(w, h)}
+}
+
+// claude 按像素数计费：tokens ≈ 宽 × 高 / 750
+func claude(w, h int) Estimate {
+	scale := math.Min(1, float64(claudeMaxEdge)/float64(max(w, h)))
+	scale = math.Min(scale, math.Sqrt(float64(claudeMaxPixels)/float64(w*h)))
+	sw, sh := scaled(w, h, scale)
+	tokens := (sw*sh + claudePerToken - 1) / claudePerToken
+	return Estimate{Model: "Claude", Width: sw, Height: sh, Tokens: tokens}
+}
+
+// openai 按 512x512 分块计费
+func openai(w, h int) Estimate {
+	scale := math.Min(1, float64(openaiMaxEdge)/float64(max(w, h)))
+	sw, sh := scaled(w, h, scale)
+	scale = math.Min(1, float64(openaiShortEdge)/float64(min(sw, sh)))
+	sw, sh = scaled(sw, sh, scale)
+	tiles := ceilDiv(sw, openaiTile) * ceilDiv(sh, openaiTile)
+	return Estimate{Model: "GPT-4o", Width: sw, Height: sh, Tokens: openaiBase + openaiPerTile*tiles}
+}
+
+// gemini 小图按一块计费，大图按 768x768 分块
+func gemini(w, h int) Estimate {
+	tiles := 1
+	if w > geminiSmall || h > geminiSmall {
+		tiles = ceilDiv(w, geminiTile) * ceilDiv(h, geminiTile)
+	}
+	return Estimate{Model: "Gemini", Width: w, Height: h, Tokens: geminiPerTile * tiles}
+}
+
+// scaled 按比例缩放尺寸（至少 1 像素）
+func scaled(w, h int, scale float64) (int, int) {
+	if scale >= 1 {
+		return w, h
+	}
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// ceilDiv 向上取整的整数除法
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
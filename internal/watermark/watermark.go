@@ -0,0 +1,136 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg" // 注册 JPEG 解码器（读取 logo 尺寸）
+	_ "image/png"  // 注册 PNG 解码器（读取 logo 尺寸）
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"snapcli/internal/annotate"
+)
+
+// Position 水印所在的角落
+type Position string
+
+const (
+	TopLeft     Position = "top-left"     // 左上角
+	TopRight    Position = "top-right"    // 右上角
+	BottomLeft  Position = "bottom-left"  // 左下角
+	BottomRight Position = "bottom-right" // 右下角
+)
+
+// DateFormat {date} 占位符的时间格式
+const DateFormat = "2006-01-02 15:04:05"
+
+// Options 水印参数
+type Options struct {
+	Text      string     // 水印文字（已展开占位符），ImagePath 非空时忽略
+	ImagePath string     // logo 图片路径
+	Position  Position   // 所在角落
+	Opacity   int        // 不透明度百分比 1-100
+	Scale     int        // 大小：文字高度或 logo 高度占截图较短边的百分比
+	Margin    int        // 与图片边缘的距离
+	Color     color.RGBA // 文字颜色（自动添加对比色轮廓）
+}
+
+// Expand 展开文字中的 {date}、{user} 和 {host} 占位符
+func Expand(text string, now time.Time) string {
+	if strings.Contains(text, "{user}") {
+		text = strings.ReplaceAll(text, "{user}", currentUser())
+	}
+	if strings.Contains(text, "{host}") {
+		host, _ := os.Hostname()
+		text = strings.ReplaceAll(text, "{host}", host)
+	}
+	return strings.ReplaceAll(text, "{date}", now.Format(DateFormat))
+}
+
+// currentUser 当前用户名（去掉 Windows 的域名前缀）
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return os.Getenv("USERNAME")
+	}
+	name := u.Username
+	if i := strings.LastIndexAny(name, `\/`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// Apply 在图片副本的指定角落叠加水印，返回新图片
+func Apply(src image.Image, opts Options) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+
+	short := min(b.Dx(), b.Dy())
+	height := max(12, short*opts.Scale/100)
+
+	var a annotate.Annotation
+	if opts.ImagePath != "" {
+		a = logoAnnotation(opts.ImagePath, height)
+	} else if opts.Text != "" {
+		a = annotate.Annotation{
+			Type:     annotate.ToolText,
+			Points:   []image.Point{{}},
+			Color:    opts.Color,
+			Text:     opts.Text,
+			FontSize: height,
+			Outline:  true,
+			Style:    annotate.TextStyle{Background: annotate.TextBgNone},
+		}
+	}
+	if len(a.Points) == 0 {
+		return dst
+	}
+	a.Opacity = opts.Opacity
+
+	// 先在原点计算范围，再移动到目标角落
+	box := a.Bounds()
+	target := cornerRect(dst.Bounds(), box.Size(), opts.Position, opts.Margin)
+	d := target.Min.Sub(box.Min)
+	a.Translate(d.X, d.Y)
+
+	annotate.RenderSingleAnnotation(dst, &a)
+	return dst
+}
+
+// logoAnnotation 构造高度为 height、保持宽高比的 logo 标注（无法读取时返回空标注）
+func logoAnnotation(path string, height int) annotate.Annotation {
+	f, err := os.Open(path)
+	if err != nil {
+		return annotate.Annotation{}
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return annotate.Annotation{}
+	}
+	width := max(1, cfg.Width*height/cfg.Height)
+	return annotate.Annotation{
+		Type:      annotate.ToolImage,
+		Points:    []image.Point{{}, {X: width, Y: height}},
+		ImagePath: path,
+	}
+}
+
+// cornerRect 在 bounds 的指定角落放置 size 大小的矩形，与边缘保持 margin 距离
+func cornerRect(bounds image.Rectangle, size image.Point, pos Position, margin int) image.Rectangle {
+	x := bounds.Max.X - margin - size.X
+	y := bounds.Max.Y - margin - size.Y
+	switch pos {
+	case TopLeft:
+		x, y = bounds.Min.X+margin, bounds.Min.Y+margin
+	case TopRight:
+		y = bounds.Min.Y + margin
+	case BottomLeft:
+		x = bounds.Min.X + margin
+	}
+	return image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(size)}
+}